@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/config"
+)
+
+// runCommand handles the validate and print-config subcommands. It returns
+// false when args do not start with a known subcommand.
+func runCommand(args []string) (exitCode int, handled bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+	switch args[0] {
+	case "validate":
+		return validateCmd(args[1:], os.Stdout), true
+	case "print-config":
+		return printConfigCmd(args[1:], os.Stdout), true
+	default:
+		return 0, false
+	}
+}
+
+// validateCmd parses and validates the config, then runs the deeper checks.
+// Exit code 1 on parse/validation errors or error findings (or any finding
+// with -strict).
+func validateCmd(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	path := fs.String("config.file", "/config/config.yaml", "Path to config file")
+	strict := fs.Bool("strict", false, "Treat warnings as errors")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, _, err := config.LoadFromFile(*path)
+	if err != nil {
+		fmt.Fprintf(out, "error: %s: %v\n", *path, err)
+		return 1
+	}
+	findings := cfg.Check()
+	for _, f := range findings {
+		fmt.Fprintln(out, f.String())
+	}
+	if config.HasErrors(findings) || (*strict && len(findings) > 0) {
+		fmt.Fprintf(out, "%s: invalid\n", *path)
+		return 1
+	}
+	fmt.Fprintf(out, "%s: ok (config_hash %s)\n", *path, cfg.Hash)
+	return 0
+}
+
+// printConfigCmd dumps the effective config (defaults applied, references
+// expanded, secrets redacted).
+func printConfigCmd(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("print-config", flag.ContinueOnError)
+	path := fs.String("config.file", "/config/config.yaml", "Path to config file")
+	format := fs.String("format", "yaml", "Output format: yaml|json")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, _, err := config.LoadFromFile(*path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s: %v\n", *path, err)
+		return 1
+	}
+	switch *format {
+	case "yaml":
+		enc := yaml.NewEncoder(out)
+		enc.SetIndent(2)
+		if err := enc.Encode(cfg.WithoutSecrets()); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		_ = enc.Close()
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(cfg.RuntimeView())
+	default:
+		fmt.Fprintf(os.Stderr, "error: unsupported format %q\n", *format)
+		return 2
+	}
+	return 0
+}
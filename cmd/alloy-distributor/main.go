@@ -3,7 +3,7 @@ package main
 import (
 	"context"
 	"flag"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
@@ -12,7 +12,9 @@ import (
 	// Updated to local module path
 	"github.com/DeveloperDarkhan/loki-producer/internal/buildinfo"
 	"github.com/DeveloperDarkhan/loki-producer/internal/config"
+	"github.com/DeveloperDarkhan/loki-producer/internal/logging"
 	"github.com/DeveloperDarkhan/loki-producer/internal/server"
+	"github.com/DeveloperDarkhan/loki-producer/internal/tracing"
 )
 
 var (
@@ -21,6 +23,10 @@ var (
 )
 
 func main() {
+	// Subcommands: validate, print-config
+	if code, ok := runCommand(os.Args[1:]); ok {
+		os.Exit(code)
+	}
 	flag.Parse()
 
 	if *listBalancers {
@@ -30,22 +36,37 @@ func main() {
 		return
 	}
 
-	cfg, rawBytes, err := config.LoadFromFile(*configFile)
+	cfg, _, err := config.LoadFromFile(*configFile)
+	if err != nil {
+		fatal("failed to load config", "error", err.Error(), "path", *configFile)
+	}
+	if err := logging.Setup(cfg.LogFormat, cfg.LogLevel, cfg.Quiet); err != nil {
+		fatal("failed to init logging", "error", err.Error())
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Enabled:     cfg.TracingEnabled,
+		Endpoint:    cfg.TracingOTLPEndpoint,
+		URLPath:     cfg.TracingOTLPURLPath,
+		Insecure:    cfg.TracingOTLPInsecure,
+		SampleRatio: cfg.TracingSampleRatio,
+		ServiceName: cfg.TracingServiceName,
+	})
 	if err != nil {
-		log.Fatalf(`{"level":"fatal","msg":"failed to load config","error":%q,"path":%q}`, err.Error(), *configFile)
+		fatal("failed to init tracing", "error", err.Error())
 	}
 
 	srv, err := server.New(*configFile, cfg)
 	if err != nil {
-		log.Fatalf(`{"level":"fatal","msg":"failed to init server","error":%q}`, err.Error())
+		fatal("failed to init server", "error", err.Error())
 	}
 
-	// Log startup (structured) including raw config hash
-	buildinfo.LogStartup(*cfg, rawBytes)
+	// Log startup (structured) including config hash
+	buildinfo.LogStartup(*cfg)
 
 	go func() {
 		if err := srv.Start(); err != nil {
-			log.Fatalf(`{"level":"fatal","msg":"server exited with error","error":%q}`, err.Error())
+			fatal("server exited with error", "error", err.Error())
 		}
 	}()
 
@@ -57,21 +78,29 @@ func main() {
 		sig := <-sigCh
 		switch sig {
 		case syscall.SIGHUP:
-			log.Println(`{"level":"info","msg":"received SIGHUP, reloading config"}`)
-			if err := srv.Reload(); err != nil {
-				log.Printf(`{"level":"error","msg":"reload failed","error":%q}`, err.Error())
+			slog.Info("received SIGHUP, reloading config")
+			if err := srv.Reload(server.ReloadSourceSignal); err != nil {
+				slog.Error("reload failed", "error", err.Error())
 			} else {
-				log.Println(`{"level":"info","msg":"reload completed"}`)
+				slog.Info("reload completed")
 			}
 		case syscall.SIGINT, syscall.SIGTERM:
-			log.Printf(`{"level":"info","msg":"shutdown signal","signal":%q}`, sig.String())
+			slog.Info("shutdown signal", "signal", sig.String())
 			ctx, cancel := context.WithTimeout(context.Background(), 25*time.Second)
 			defer cancel()
 			if err := srv.Stop(ctx); err != nil {
-				log.Printf(`{"level":"warn","msg":"graceful stop error","error":%q}`, err.Error())
+				slog.Warn("graceful stop error", "error", err.Error())
+			}
+			if err := shutdownTracing(ctx); err != nil {
+				slog.Warn("tracing shutdown error", "error", err.Error())
 			}
-			log.Println(`{"level":"info","msg":"exiting"}`)
+			slog.Info("exiting")
 			return
 		}
 	}
 }
+
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
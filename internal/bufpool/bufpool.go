@@ -0,0 +1,100 @@
+// Package bufpool pools byte buffers in power-of-two size classes, so the
+// push path reuses body memory instead of allocating it per request.
+package bufpool
+
+import (
+	"io"
+	"math/bits"
+	"sync"
+)
+
+const (
+	minClassBits = 10 // 1 KiB, the smallest class
+	maxClassBits = 26 // 64 MiB; larger buffers are allocated and dropped
+
+	// DefaultSize is the first buffer of a body without Content-Length.
+	DefaultSize = 32 << 10
+)
+
+var pools [maxClassBits - minClassBits + 1]sync.Pool
+
+// Buffer is a pooled byte slice. B may be used up to its capacity; a Buffer
+// must not be used after Put.
+type Buffer struct {
+	B     []byte
+	class int // index into pools, -1 when too large to pool
+	probe [1]byte
+}
+
+func classFor(size int) int {
+	if size <= 1<<minClassBits {
+		return 0
+	}
+	c := bits.Len(uint(size-1)) - minClassBits
+	if c >= len(pools) {
+		return -1
+	}
+	return c
+}
+
+// Get returns an empty buffer with capacity for at least size bytes.
+func Get(size int) *Buffer {
+	c := classFor(size)
+	if c < 0 {
+		return &Buffer{B: make([]byte, 0, size), class: -1}
+	}
+	if v := pools[c].Get(); v != nil {
+		b := v.(*Buffer)
+		b.B = b.B[:0]
+		return b
+	}
+	return &Buffer{B: make([]byte, 0, 1<<(c+minClassBits)), class: c}
+}
+
+// Put returns b to its size class. Nothing may reference b.B afterwards.
+func Put(b *Buffer) {
+	if b == nil || b.class < 0 {
+		return
+	}
+	pools[b.class].Put(b)
+}
+
+// ReadAll reads r until EOF into a pooled buffer of at least sizeHint bytes
+// (DefaultSize when not positive). A body of exactly sizeHint bytes, as with
+// an accurate Content-Length, fits without growing. On error the buffer is
+// already returned to the pool.
+func ReadAll(r io.Reader, sizeHint int) (*Buffer, error) {
+	if sizeHint <= 0 {
+		sizeHint = DefaultSize
+	}
+	b := Get(sizeHint)
+	for {
+		if len(b.B) == cap(b.B) {
+			// Full: probe for EOF before moving to the next class
+			n, err := r.Read(b.probe[:])
+			if n > 0 {
+				nb := Get(2 * cap(b.B))
+				nb.B = append(append(nb.B, b.B...), b.probe[0])
+				Put(b)
+				b = nb
+			}
+			if err == io.EOF {
+				return b, nil
+			}
+			if err != nil {
+				Put(b)
+				return nil, err
+			}
+			continue
+		}
+		n, err := r.Read(b.B[len(b.B):cap(b.B)])
+		b.B = b.B[:len(b.B)+n]
+		if err == io.EOF {
+			return b, nil
+		}
+		if err != nil {
+			Put(b)
+			return nil, err
+		}
+	}
+}
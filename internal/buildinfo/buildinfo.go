@@ -1,11 +1,7 @@
 package buildinfo
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
-	"encoding/json"
-	"fmt"
-	"log"
+	"log/slog"
 	"runtime"
 
 	// Updated to local module path
@@ -19,34 +15,26 @@ var (
 	Date    = "unknown"
 )
 
-var buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-	Name: "pulse_loki_produce_build_info",
-	Help: "Build information",
-}, []string{"version", "commit", "date", "go_version"})
-
-func init() {
-	prometheus.MustRegister(buildInfo)
+// Collector returns the pulse_loki_produce_build_info gauge, to be
+// registered on the server's registry.
+func Collector() prometheus.Collector {
+	buildInfo := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pulse_loki_produce_build_info",
+		Help: "Build information",
+	}, []string{"version", "commit", "date", "go_version"})
 	buildInfo.WithLabelValues(Version, Commit, Date, runtime.Version()).Set(1)
+	return buildInfo
 }
 
-func LogStartup(cfg config.Config, raw []byte) {
-	hash := sha256.Sum256(raw)
-	rawHash := hex.EncodeToString(hash[:8])
-	type logged struct {
-		Version   string             `json:"version"`
-		Commit    string             `json:"commit"`
-		Date      string             `json:"date"`
-		ConfigRef string             `json:"config_hash"`
-		Config    config.RuntimeView `json:"config_effective"`
-	}
-	l := logged{
-		Version:   Version,
-		Commit:    Commit,
-		Date:      Date,
-		ConfigRef: rawHash,
-		Config:    cfg.RuntimeView(),
-	}
-	b, _ := json.Marshal(l)
-	log.Println(string(b))
-	fmt.Println()
+// LogStartup logs version info and the effective config. The config hash is
+// taken over the redacted view, so it never depends on secret values.
+func LogStartup(cfg config.Config) {
+	slog.Info("starting",
+		"version", Version,
+		"commit", Commit,
+		"date", Date,
+		"go_version", runtime.Version(),
+		"config_hash", cfg.Hash,
+		"config_effective", cfg.RuntimeView(),
+	)
 }
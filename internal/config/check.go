@@ -0,0 +1,179 @@
+package config
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Finding is a problem reported by Check.
+type Finding struct {
+	Severity string // error|warning
+	Field    string
+	Message  string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Severity, f.Field, f.Message)
+}
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Check runs deeper checks than Validate: option combinations, files the
+// config refers to and duration sanity. It is meant for CI (the validate
+// subcommand); the server itself only requires Validate to pass.
+func (c *Config) Check() []Finding {
+	var out []Finding
+	errf := func(field, format string, args ...any) {
+		out = append(out, Finding{SeverityError, field, fmt.Sprintf(format, args...)})
+	}
+	warnf := func(field, format string, args ...any) {
+		out = append(out, Finding{SeverityWarning, field, fmt.Sprintf(format, args...)})
+	}
+
+	// Balancer / acks
+	switch c.KafkaRequiredAcks {
+	case -1, 1:
+	case 0:
+		warnf("kafka_required_acks", "0 is fire-and-forget: kafka errors, kafka_error results and health gating will not see failed writes")
+		if c.KafkaProbeEnabled && c.KafkaProbeWrite {
+			warnf("kafka_probe_write", "probe write cannot verify delivery with kafka_required_acks=0")
+		}
+	default:
+		errf("kafka_required_acks", "must be -1 (all), 0 or 1, got %d", c.KafkaRequiredAcks)
+	}
+	if c.KafkaBalancer == "hash" && c.KafkaRequiredAcks == 0 {
+		warnf("kafka_balancer", "hash keeps per-tenant ordering only for acknowledged writes; use kafka_required_acks 1 or -1")
+	}
+	for i, b := range c.KafkaBrokers {
+		if !strings.Contains(b, ":") {
+			errf(fmt.Sprintf("kafka_brokers[%d]", i), "%q has no port", b)
+		}
+	}
+
+	// TLS
+	if c.KafkaTLSCAFile != "" {
+		if !c.KafkaTLSEnabled {
+			warnf("kafka_tls_ca_file", "set but kafka_tls_enabled is false, the file is ignored")
+		} else if pem, err := os.ReadFile(c.KafkaTLSCAFile); err != nil {
+			errf("kafka_tls_ca_file", "not readable: %v", err)
+		} else if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			errf("kafka_tls_ca_file", "%s contains no PEM certificates", c.KafkaTLSCAFile)
+		}
+	}
+	if c.KafkaTLSEnabled && c.KafkaTLSInsecureSkipVerify {
+		warnf("kafka_tls_insecure_skip_verify", "broker certificates are not verified")
+	}
+
+	// SASL
+	if c.KafkaSASLEnabled {
+		if c.KafkaSASLPassword == "" && os.Getenv("KAFKA_SASL_PASSWORD") == "" {
+			errf("kafka_sasl_password", "SASL enabled but no password in config or env KAFKA_SASL_PASSWORD")
+		}
+		if !c.KafkaTLSEnabled {
+			warnf("kafka_sasl_enabled", "SASL without TLS: traffic (including usernames) is unencrypted")
+		}
+	} else if c.KafkaSASLUsername != "" || c.KafkaSASLPassword != "" {
+		warnf("kafka_sasl_enabled", "SASL credentials set but kafka_sasl_enabled is false")
+	}
+
+	// Durations
+	if c.KafkaWriteTimeout <= c.KafkaBatchTimeout {
+		errf("kafka_write_timeout", "%s must exceed kafka_batch_timeout %s or writes time out before the batch is flushed", c.KafkaWriteTimeout, c.KafkaBatchTimeout)
+	}
+	// A Kafka write that outlives the HTTP write timeout can no longer be answered
+	if c.KafkaWriteTimeout >= c.HTTPWriteTimeout {
+		warnf("kafka_write_timeout", "%s is not below http_write_timeout %s; clients may see a dropped connection instead of 503", c.KafkaWriteTimeout, c.HTTPWriteTimeout)
+	}
+	if c.HTTPReadTimeout < c.HTTPReadHeaderTimeout {
+		warnf("http_read_timeout", "%s is below http_read_header_timeout %s", c.HTTPReadTimeout, c.HTTPReadHeaderTimeout)
+	}
+	if c.KafkaBatchTimeout > time.Second {
+		warnf("kafka_batch_timeout", "%s adds up to that much latency to every push", c.KafkaBatchTimeout)
+	}
+	if c.KafkaMetadataRefreshInterval > 0 && c.KafkaMetadataRefreshInterval < time.Second {
+		warnf("kafka_metadata_refresh_interval", "%s polls cluster metadata very often", c.KafkaMetadataRefreshInterval)
+	}
+	if c.KafkaWriterDrainTimeout < c.KafkaWriteTimeout {
+		warnf("kafka_writer_drain_timeout", "%s is below kafka_write_timeout %s; writes in flight during a writer rebuild may be cut off", c.KafkaWriterDrainTimeout, c.KafkaWriteTimeout)
+	}
+	if c.KafkaProbeEnabled && c.KafkaProbeTimeout > time.Minute {
+		warnf("kafka_probe_timeout", "%s delays startup failure detection", c.KafkaProbeTimeout)
+	}
+	if c.HealthEvalPeriod < time.Second {
+		warnf("health_eval_period", "%s is too short for a meaningful error rate", c.HealthEvalPeriod)
+	}
+	if c.ConfigWatchEnabled && c.ConfigWatchDebounce > time.Minute {
+		warnf("config_watch_debounce", "%s delays ConfigMap rollouts", c.ConfigWatchDebounce)
+	}
+
+	if c.SLOEnabled && c.SLOLatencyThreshold <= c.KafkaBatchTimeout {
+		warnf("slo_latency_threshold", "%s is not above kafka_batch_timeout %s; most requests will count as slow", c.SLOLatencyThreshold, c.KafkaBatchTimeout)
+	}
+	if c.SLOReadiness && !c.SLOEnabled {
+		warnf("slo_readiness", "set but slo_enabled is false")
+	}
+
+	// Sizes
+	if c.MaxBodyBytes > int64(c.KafkaBatchBytes) {
+		warnf("max_body_bytes", "%d exceeds kafka_batch_bytes %d; larger pushes are rejected by the writer as too large", c.MaxBodyBytes, c.KafkaBatchBytes)
+	}
+	if c.HTTP2Enabled && c.MaxInflightBytes == 0 {
+		warnf("http2_enabled", "without max_inflight_bytes one connection may hold %d bodies of up to max_body_bytes in memory", c.HTTP2MaxConcurrentStreams)
+	}
+	if c.MaxInflightBytes > 0 && c.MaxInflightBytesWait+c.KafkaWriteTimeout >= c.HTTPWriteTimeout {
+		warnf("max_inflight_bytes_wait", "%s plus kafka_write_timeout %s is not below http_write_timeout %s; queued pushes may time out before they are answered", c.MaxInflightBytesWait, c.KafkaWriteTimeout, c.HTTPWriteTimeout)
+	}
+
+	// Rate limits
+	if c.RateLimitEnabled && c.RateLimitGlobalRPS == 0 && c.RateLimitPerTenantRPS == 0 {
+		warnf("rate_limit_enabled", "enabled but both global and per-tenant RPS are 0 (no limits)")
+	}
+	if c.RateLimitGlobalRPS > 0 && c.RateLimitPerTenantRPS > c.RateLimitGlobalRPS {
+		warnf("rate_limit_per_tenant_rps", "%.0f exceeds rate_limit_global_rps %.0f", c.RateLimitPerTenantRPS, c.RateLimitGlobalRPS)
+	}
+
+	if c.UsageKafkaTopic != "" {
+		if c.UsageKafkaTopic == c.KafkaTopic {
+			errf("usage_kafka_topic", "must differ from kafka_topic, usage records would be consumed as log pushes")
+		}
+		if !c.UsageEnabled {
+			warnf("usage_kafka_topic", "set but usage_enabled is false, nothing is published")
+		}
+	}
+
+	if c.ConcurrencyLimitEnabled && c.ConcurrencyLimitLatencyTarget <= c.KafkaBatchTimeout {
+		warnf("concurrency_limit_latency_target", "%s is not above kafka_batch_timeout %s; every write looks slow and the limit stays at its minimum", c.ConcurrencyLimitLatencyTarget, c.KafkaBatchTimeout)
+	}
+
+	// Files written by the server
+	if c.AccessLogEnabled {
+		switch c.AccessLogOutput {
+		case "", "stdout", "stderr":
+		default:
+			if fi, err := os.Stat(filepath.Dir(c.AccessLogOutput)); err != nil || !fi.IsDir() {
+				errf("access_log_output", "directory of %s does not exist", c.AccessLogOutput)
+			}
+		}
+	}
+	if c.AdminToken == "" && c.AdminPort == "" && os.Getenv("ADMIN_TOKEN") == "" {
+		warnf("admin_port", "admin routes (reload, pprof) are served unauthenticated on the ingest port")
+	}
+	return out
+}
+
+// HasErrors reports whether any finding has error severity.
+func HasErrors(findings []Finding) bool {
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
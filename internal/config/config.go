@@ -1,6 +1,9 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +14,8 @@ import (
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/logproto"
 )
 
 type Config struct {
@@ -26,6 +31,12 @@ type Config struct {
 	KafkaBatchSize    int           `yaml:"kafka_batch_size"`    // max messages per batch
 	KafkaBatchBytes   int           `yaml:"kafka_batch_bytes"`   // max bytes per batch
 
+	// Partition leader lookup (feeds the broker label of per-partition metrics)
+	KafkaMetadataRefreshInterval time.Duration `yaml:"kafka_metadata_refresh_interval"` // 0 disables leader tracking
+
+	// How long a writer replaced by reload may finish in-flight writes before it is closed
+	KafkaWriterDrainTimeout time.Duration `yaml:"kafka_writer_drain_timeout"`
+
 	// Security
 	KafkaSASLEnabled           bool   `yaml:"kafka_sasl_enabled"`
 	KafkaSASLMechanism         string `yaml:"kafka_sasl_mechanism"` // scram-sha-512|scram-sha-256
@@ -42,25 +53,154 @@ type Config struct {
 	KafkaProbeWrite    bool          `yaml:"kafka_probe_write"` // if true, send a tiny test message at startup
 
 	// Mutable
-	MaxBodyBytes             int64  `yaml:"max_body_bytes"`
-	AllowEmptyTenant         bool   `yaml:"allow_empty_tenant"`
-	DefaultTenant            string `yaml:"default_tenant"`
-	MetricsEnableTenantLabel bool   `yaml:"metrics_enable_tenant_label"`
+	MaxBodyBytes             int64         `yaml:"max_body_bytes"`
+	MaxInflightBytes         int64         `yaml:"max_inflight_bytes"`      // bodies held in memory across all pushes, 0 = unlimited
+	MaxInflightBytesWait     time.Duration `yaml:"max_inflight_bytes_wait"` // queue for budget before rejecting, 0 = reject at once
+	MaxDecodedBodyBytes      int64         `yaml:"max_decoded_body_bytes"`  // decompressed body of converting endpoints (OTLP, ...)
+	AllowEmptyTenant         bool          `yaml:"allow_empty_tenant"`
+	DefaultTenant            string        `yaml:"default_tenant"`
+	MetricsEnableTenantLabel bool          `yaml:"metrics_enable_tenant_label"`
+	MetricsTenantMaxSeries   int           `yaml:"metrics_tenant_max_series"` // top tenants by bytes keep their label; the rest fold into "__other__"
+
+	MetricsEnablePartitionLabels bool `yaml:"metrics_enable_partition_labels"` // topic/partition/broker produce metrics
+	MetricsPartitionMaxSeries    int  `yaml:"metrics_partition_max_series"`    // cardinality guard; extra series fold into "__other__"
 
 	HealthErrorRateThreshold        float64       `yaml:"health_error_rate_threshold"`
 	HealthConsecutiveErrorThreshold int           `yaml:"health_consecutive_error_threshold"`
 	HealthEvalPeriod                time.Duration `yaml:"health_eval_period"`
 	SLAGaugeEnable                  bool          `yaml:"sla_gauge_enable"`
 
+	// In-process SLO evaluation (multi-window, multi-burn-rate)
+	SLOEnabled               bool          `yaml:"slo_enabled"`                // applied at startup
+	SLOAvailabilityObjective float64       `yaml:"slo_availability_objective"` // share of requests without a server-side error
+	SLOLatencyObjective      float64       `yaml:"slo_latency_objective"`      // share of successful requests under the threshold
+	SLOLatencyThreshold      time.Duration `yaml:"slo_latency_threshold"`
+	SLOBudgetWindow          time.Duration `yaml:"slo_budget_window"` // applied at startup
+	SLOReadiness             bool          `yaml:"slo_readiness"`     // fail /ready while the availability page rule fires
+	SLOMinRequests           int           `yaml:"slo_min_requests"`  // per window before a rule may fire
+
 	RateLimitEnabled        bool    `yaml:"rate_limit_enabled"`
 	RateLimitGlobalRPS      float64 `yaml:"rate_limit_global_rps"`
 	RateLimitGlobalBurst    int     `yaml:"rate_limit_global_burst"`
 	RateLimitPerTenantRPS   float64 `yaml:"rate_limit_per_tenant_rps"`
 	RateLimitPerTenantBurst int     `yaml:"rate_limit_per_tenant_burst"`
 
-	LogLevel string `yaml:"log_level"` // info|debug
-	Quiet    bool   `yaml:"quiet"`
-	Port     string `yaml:"port"`
+	// Adaptive concurrency limit (AIMD on Kafka write latency) with load shedding
+	ConcurrencyLimitEnabled        bool          `yaml:"concurrency_limit_enabled"`
+	ConcurrencyLimitInitial        int           `yaml:"concurrency_limit_initial"`
+	ConcurrencyLimitMin            int           `yaml:"concurrency_limit_min"`
+	ConcurrencyLimitMax            int           `yaml:"concurrency_limit_max"`
+	ConcurrencyLimitLatencyTarget  time.Duration `yaml:"concurrency_limit_latency_target"` // slower Kafka writes shrink the limit
+	ConcurrencyLimitBackoff        float64       `yaml:"concurrency_limit_backoff"`        // multiplicative decrease, 0..1
+	ConcurrencyLimitTenantFairness bool          `yaml:"concurrency_limit_tenant_fairness"`
+
+	// Tracing (OTLP/HTTP export; applied at startup)
+	TracingEnabled      bool    `yaml:"tracing_enabled"`
+	TracingOTLPEndpoint string  `yaml:"tracing_otlp_endpoint"` // host:port of the collector
+	TracingOTLPURLPath  string  `yaml:"tracing_otlp_url_path"` // default /v1/traces
+	TracingOTLPInsecure bool    `yaml:"tracing_otlp_insecure"` // plain HTTP
+	TracingSampleRatio  float64 `yaml:"tracing_sample_ratio"`  // parent-based, 0..1
+	TracingServiceName  string  `yaml:"tracing_service_name"`
+
+	LogLevel          string        `yaml:"log_level"`           // debug|info|warn|error
+	LogFormat         string        `yaml:"log_format"`          // json|text (applied at startup)
+	LogSampleInterval time.Duration `yaml:"log_sample_interval"` // window for repetitive warnings, 0 disables sampling
+	LogSampleBurst    int           `yaml:"log_sample_burst"`    // lines per key per window
+	Quiet             bool          `yaml:"quiet"`               // raise info to warn
+	Port              string        `yaml:"port"`
+
+	// Ingest HTTP listener; a reload that changes these starts a new listener
+	// and drains the old one
+	HTTPReadHeaderTimeout time.Duration `yaml:"http_read_header_timeout"`
+	HTTPReadTimeout       time.Duration `yaml:"http_read_timeout"`
+	HTTPWriteTimeout      time.Duration `yaml:"http_write_timeout"`
+	HTTPIdleTimeout       time.Duration `yaml:"http_idle_timeout"`
+	HTTPMaxHeaderBytes    int           `yaml:"http_max_header_bytes"`
+
+	// h2c (HTTP/2 without TLS) next to HTTP/1.1 on the ingest port
+	HTTP2Enabled                  bool   `yaml:"http2_enabled"`
+	HTTP2MaxConcurrentStreams     uint32 `yaml:"http2_max_concurrent_streams"`       // per connection
+	HTTP2MaxReadFrameSize         uint32 `yaml:"http2_max_read_frame_size"`          // 16 KiB..16 MiB
+	HTTP2MaxUploadBufferPerStream int32  `yaml:"http2_max_upload_buffer_per_stream"` // initial flow-control window
+
+	// Access log (one line per ingest request, separate from application logs)
+	AccessLogEnabled            bool     `yaml:"access_log_enabled"`
+	AccessLogOutput             string   `yaml:"access_log_output"`               // stdout|stderr|<file path> (rotated)
+	AccessLogFormat             string   `yaml:"access_log_format"`               // json|text
+	AccessLogFields             []string `yaml:"access_log_fields"`               // empty = all fields
+	AccessLogSuccessSampleRatio float64  `yaml:"access_log_success_sample_ratio"` // share of successful requests logged
+	AccessLogMaxSizeMB          int      `yaml:"access_log_max_size_mb"`          // file rotation
+	AccessLogMaxBackups         int      `yaml:"access_log_max_backups"`
+	AccessLogMaxAgeDays         int      `yaml:"access_log_max_age_days"`
+	AccessLogCompress           bool     `yaml:"access_log_compress"`
+
+	// Config file watching (ConfigMap updates trigger Reload automatically)
+	ConfigWatchEnabled  bool          `yaml:"config_watch_enabled"`
+	ConfigWatchDebounce time.Duration `yaml:"config_watch_debounce"`
+
+	// Per-tenant usage accounting (/usage, optional usage records topic); applied at startup
+	UsageEnabled         bool            `yaml:"usage_enabled"`
+	UsageWindows         []time.Duration `yaml:"usage_windows"`          // rolling windows reported by /usage
+	UsageKafkaTopic      string          `yaml:"usage_kafka_topic"`      // empty disables publishing
+	UsagePublishInterval time.Duration   `yaml:"usage_publish_interval"` // one record per active tenant per interval
+
+	// Hash of the effective config with secrets redacted (safe to log/export)
+	Hash string `yaml:"-"`
+	// Hash of the raw file the config was loaded from (set by LoadFromFile)
+	FileHash string `yaml:"-"`
+
+	// Admin listener (metrics, configz, reload, pprof); empty port keeps them on Port
+	AdminPort  string `yaml:"admin_port"`
+	AdminToken string `yaml:"admin_token"` // can be empty if provided via env ADMIN_TOKEN
+
+	// gRPC logproto.Pusher listener
+	GRPCEnabled        bool   `yaml:"grpc_enabled"`
+	GRPCPort           string `yaml:"grpc_port"`
+	GRPCMaxRecvMsgSize int    `yaml:"grpc_max_recv_msg_size"` // uncompressed PushRequest
+
+	// OTLP logs (/otlp/v1/logs): attributes promoted to stream labels, the
+	// rest goes to structured metadata
+	OTLPResourceLabels []string `yaml:"otlp_resource_labels"` // empty = Loki's defaults
+	OTLPLogLabels      []string `yaml:"otlp_log_labels"`      // log record attributes; mind the cardinality
+
+	// Elasticsearch bulk API (/_bulk, /{index}/_bulk): document fields
+	ESMessageField   string   `yaml:"es_message_field"`   // log line; empty = remaining fields as JSON
+	ESTimestampField string   `yaml:"es_timestamp_field"` // RFC 3339 or epoch millis
+	ESLabelFields    []string `yaml:"es_label_fields"`    // promoted to labels next to index
+
+	// Raw line push (/loki/api/v1/raw): NDJSON field with the entry time
+	RawTimestampField string `yaml:"raw_timestamp_field"` // RFC 3339 or epoch millis; empty = receive time
+
+	// Syslog listeners (RFC 5424/3164 over TCP or UDP); applied at startup
+	SyslogListeners       []SyslogListener `yaml:"syslog_listeners"`
+	SyslogBatchSize       int              `yaml:"syslog_batch_size"`        // lines per push
+	SyslogBatchWait       time.Duration    `yaml:"syslog_batch_wait"`        // max age of a batch before it is pushed
+	SyslogMaxMessageBytes int              `yaml:"syslog_max_message_bytes"` // longer messages are dropped
+
+	// Fluent Forward listeners (Fluentd/Fluent Bit forward output); listeners
+	// apply at startup, the record mapping on reload
+	ForwardListeners  []ForwardListener `yaml:"forward_listeners"`
+	ForwardMessageKey string            `yaml:"forward_message_key"` // record key of the line; empty = whole record
+	ForwardLabelKeys  []string          `yaml:"forward_label_keys"`  // record keys promoted to labels next to tag
+}
+
+// SyslogListener is one syslog socket; all its messages go to one tenant.
+type SyslogListener struct {
+	Name     string            `yaml:"name" json:"name"`
+	Protocol string            `yaml:"protocol" json:"protocol"` // tcp|udp
+	Address  string            `yaml:"address" json:"address"`   // host:port to bind
+	Tenant   string            `yaml:"tenant" json:"tenant"`
+	Labels   map[string]string `yaml:"labels" json:"labels"` // static labels of every stream
+}
+
+// ForwardListener is one Forward protocol (TCP) socket; all its records go
+// to one tenant.
+type ForwardListener struct {
+	Name      string            `yaml:"name" json:"name"`
+	Address   string            `yaml:"address" json:"address"` // host:port to bind
+	Tenant    string            `yaml:"tenant" json:"tenant"`
+	SharedKey string            `yaml:"shared_key" json:"shared_key"` // enables the handshake
+	Labels    map[string]string `yaml:"labels" json:"labels"`         // static labels of every stream
 }
 
 var defaultConfig = Config{
@@ -70,6 +210,8 @@ var defaultConfig = Config{
 	KafkaBatchTimeout:               200 * time.Millisecond,
 	KafkaBatchSize:                  100,
 	KafkaBatchBytes:                 200000,
+	KafkaMetadataRefreshInterval:    30 * time.Second,
+	KafkaWriterDrainTimeout:         30 * time.Second,
 	KafkaSASLEnabled:                false,
 	KafkaSASLMechanism:              "scram-sha-512",
 	KafkaTLSEnabled:                 false,
@@ -78,13 +220,62 @@ var defaultConfig = Config{
 	KafkaProbeRequired:              true,
 	KafkaProbeTimeout:               5 * time.Second,
 	MaxBodyBytes:                    5 << 20,
+	MaxDecodedBodyBytes:             64 << 20,
 	DefaultTenant:                   "anonymous",
+	MetricsEnablePartitionLabels:    true,
+	MetricsPartitionMaxSeries:       256,
+	MetricsTenantMaxSeries:          100,
 	HealthErrorRateThreshold:        0.05,
 	HealthConsecutiveErrorThreshold: 5,
 	HealthEvalPeriod:                30 * time.Second,
 	SLAGaugeEnable:                  true,
+	SLOAvailabilityObjective:        0.999,
+	SLOLatencyObjective:             0.99,
+	SLOLatencyThreshold:             500 * time.Millisecond,
+	SLOBudgetWindow:                 30 * 24 * time.Hour,
+	SLOMinRequests:                  100,
+	ConcurrencyLimitInitial:         100,
+	ConcurrencyLimitMin:             10,
+	ConcurrencyLimitMax:             1000,
+	ConcurrencyLimitLatencyTarget:   500 * time.Millisecond,
+	ConcurrencyLimitBackoff:         0.9,
+	ConcurrencyLimitTenantFairness:  true,
+	TracingOTLPEndpoint:             "localhost:4318",
+	TracingSampleRatio:              1,
+	TracingServiceName:              "alloy-distributor",
 	LogLevel:                        "info",
+	LogFormat:                       "json",
+	AccessLogOutput:                 "stdout",
+	AccessLogFormat:                 "json",
+	AccessLogSuccessSampleRatio:     1,
+	AccessLogMaxSizeMB:              100,
+	AccessLogMaxBackups:             5,
+	AccessLogMaxAgeDays:             7,
+	ConfigWatchEnabled:              true,
+	ConfigWatchDebounce:             2 * time.Second,
+	UsageEnabled:                    true,
+	UsageWindows:                    []time.Duration{time.Hour, 24 * time.Hour},
+	UsagePublishInterval:            time.Minute,
+	LogSampleInterval:               10 * time.Second,
+	LogSampleBurst:                  5,
 	Port:                            "3101",
+	HTTPReadHeaderTimeout:           4 * time.Second,
+	HTTPReadTimeout:                 25 * time.Second,
+	HTTPWriteTimeout:                25 * time.Second,
+	HTTPIdleTimeout:                 90 * time.Second,
+	HTTPMaxHeaderBytes:              1 << 20,
+	HTTP2MaxConcurrentStreams:       250,
+	HTTP2MaxReadFrameSize:           1 << 20,
+	HTTP2MaxUploadBufferPerStream:   1 << 20,
+	GRPCPort:                        "9095",
+	GRPCMaxRecvMsgSize:              16 << 20,
+	ESMessageField:                  "message",
+	ESTimestampField:                "@timestamp",
+	RawTimestampField:               "timestamp",
+	SyslogBatchSize:                 1000,
+	ForwardMessageKey:               "log",
+	SyslogBatchWait:                 time.Second,
+	SyslogMaxMessageBytes:           64 << 10,
 }
 
 func LoadFromFile(path string) (*Config, []byte, error) {
@@ -101,19 +292,32 @@ func LoadFromFile(path string) (*Config, []byte, error) {
 	if err != nil {
 		return nil, b, err
 	}
+	cfg.FileHash = Hash(b)
 	return cfg, b, nil
 }
 
+// Hash returns a short content hash of a raw config file. The raw file may
+// hold literal secrets, so only use it for change detection.
+func Hash(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:8])
+}
+
 func Parse(data []byte) (*Config, error) {
 	var c Config = defaultConfig
 	if err := yaml.Unmarshal(data, &c); err != nil {
 		return nil, fmt.Errorf("yaml unmarshal: %w", err)
 	}
+	// ${VAR}, ${VAR:-default} and file: references, before validation
+	if err := expandStrings(&c); err != nil {
+		return nil, fmt.Errorf("expand: %w", err)
+	}
 	// Normalize legacy/alternative balancer names
 	c.KafkaBalancer = normalizeBalancer(c.KafkaBalancer)
 	if err := c.Validate(); err != nil {
 		return nil, err
 	}
+	c.Hash = c.RuntimeView().Hash()
 	return &c, nil
 }
 
@@ -163,6 +367,12 @@ func (c *Config) Validate() error {
 	if c.KafkaBatchBytes <= 0 {
 		return errors.New("kafka_batch_bytes must be > 0")
 	}
+	if c.KafkaMetadataRefreshInterval < 0 {
+		return errors.New("kafka_metadata_refresh_interval must be >= 0")
+	}
+	if c.KafkaWriterDrainTimeout <= 0 {
+		return errors.New("kafka_writer_drain_timeout must be > 0")
+	}
 	if c.KafkaSASLEnabled {
 		switch strings.ToLower(strings.TrimSpace(c.KafkaSASLMechanism)) {
 		case "scram-sha-512", "scram-sha-256":
@@ -179,26 +389,293 @@ func (c *Config) Validate() error {
 	if c.MaxBodyBytes <= 0 {
 		return errors.New("max_body_bytes must be > 0")
 	}
+	if c.MaxInflightBytes < 0 {
+		return errors.New("max_inflight_bytes must be >= 0")
+	}
+	if c.MaxInflightBytesWait < 0 {
+		return errors.New("max_inflight_bytes_wait must be >= 0")
+	}
+	if c.MaxDecodedBodyBytes < c.MaxBodyBytes {
+		return errors.New("max_decoded_body_bytes must be >= max_body_bytes")
+	}
+	// A converted push holds its body and the decoded body at once; it has
+	// to fit the budget even on an idle server
+	if c.MaxInflightBytes > 0 && c.MaxInflightBytes < c.MaxBodyBytes+c.MaxDecodedBodyBytes {
+		return fmt.Errorf("max_inflight_bytes must be >= max_body_bytes + max_decoded_body_bytes (%d)", c.MaxBodyBytes+c.MaxDecodedBodyBytes)
+	}
+	if c.MetricsEnableTenantLabel && c.MetricsTenantMaxSeries <= 0 {
+		return errors.New("metrics_tenant_max_series must be > 0 when tenant label enabled")
+	}
+	if c.MetricsEnablePartitionLabels && c.MetricsPartitionMaxSeries <= 0 {
+		return errors.New("metrics_partition_max_series must be > 0 when partition labels enabled")
+	}
 	if c.HealthEvalPeriod <= 0 {
 		return errors.New("health_eval_period must be > 0")
 	}
 	if c.HealthErrorRateThreshold < 0 || c.HealthErrorRateThreshold > 1 {
 		return errors.New("health_error_rate_threshold must be between 0 and 1")
 	}
+	if c.SLOAvailabilityObjective <= 0 || c.SLOAvailabilityObjective >= 1 ||
+		c.SLOLatencyObjective <= 0 || c.SLOLatencyObjective >= 1 {
+		return errors.New("slo objectives must be between 0 and 1 (exclusive)")
+	}
+	if c.SLOLatencyThreshold <= 0 {
+		return errors.New("slo_latency_threshold must be > 0")
+	}
+	if c.SLOBudgetWindow < time.Hour {
+		return errors.New("slo_budget_window must be >= 1h")
+	}
+	if c.SLOMinRequests < 0 {
+		return errors.New("slo_min_requests must be >= 0")
+	}
 	if c.RateLimitGlobalRPS < 0 || c.RateLimitPerTenantRPS < 0 {
 		return errors.New("rate limits RPS must be >= 0")
 	}
 	if c.RateLimitGlobalBurst < 0 || c.RateLimitPerTenantBurst < 0 {
 		return errors.New("rate limit bursts must be >= 0")
 	}
+	if c.ConcurrencyLimitEnabled {
+		if c.ConcurrencyLimitMin <= 0 || c.ConcurrencyLimitMax < c.ConcurrencyLimitMin {
+			return errors.New("concurrency_limit_min must be > 0 and <= concurrency_limit_max")
+		}
+		if c.ConcurrencyLimitInitial < c.ConcurrencyLimitMin || c.ConcurrencyLimitInitial > c.ConcurrencyLimitMax {
+			return errors.New("concurrency_limit_initial must be between concurrency_limit_min and concurrency_limit_max")
+		}
+		if c.ConcurrencyLimitLatencyTarget <= 0 {
+			return errors.New("concurrency_limit_latency_target must be > 0")
+		}
+		if c.ConcurrencyLimitBackoff <= 0 || c.ConcurrencyLimitBackoff >= 1 {
+			return errors.New("concurrency_limit_backoff must be between 0 and 1 (exclusive)")
+		}
+	}
+	if c.TracingEnabled && strings.TrimSpace(c.TracingOTLPEndpoint) == "" {
+		return errors.New("tracing_otlp_endpoint required when tracing enabled")
+	}
+	if c.TracingSampleRatio < 0 || c.TracingSampleRatio > 1 {
+		return errors.New("tracing_sample_ratio must be between 0 and 1")
+	}
+	switch c.AccessLogFormat {
+	case "json", "text":
+	default:
+		return fmt.Errorf("invalid access_log_format: %s", c.AccessLogFormat)
+	}
+	for _, f := range c.AccessLogFields {
+		if !contains(AccessLogFields, f) {
+			return fmt.Errorf("unknown access_log_fields entry: %s", f)
+		}
+	}
+	if c.AccessLogSuccessSampleRatio < 0 || c.AccessLogSuccessSampleRatio > 1 {
+		return errors.New("access_log_success_sample_ratio must be between 0 and 1")
+	}
+	if c.AccessLogMaxSizeMB < 0 || c.AccessLogMaxBackups < 0 || c.AccessLogMaxAgeDays < 0 {
+		return errors.New("access log rotation settings must be >= 0")
+	}
+	if c.ConfigWatchDebounce < 0 {
+		return errors.New("config_watch_debounce must be >= 0")
+	}
+	if c.HTTPReadHeaderTimeout <= 0 || c.HTTPReadTimeout <= 0 || c.HTTPWriteTimeout <= 0 || c.HTTPIdleTimeout <= 0 {
+		return errors.New("http_*_timeout must be > 0")
+	}
+	if c.HTTPMaxHeaderBytes <= 0 {
+		return errors.New("http_max_header_bytes must be > 0")
+	}
+	if c.HTTP2Enabled {
+		if c.HTTP2MaxConcurrentStreams == 0 {
+			return errors.New("http2_max_concurrent_streams must be > 0")
+		}
+		if c.HTTP2MaxReadFrameSize < 16<<10 || c.HTTP2MaxReadFrameSize > 16<<20-1 {
+			return errors.New("http2_max_read_frame_size must be between 16384 and 16777215")
+		}
+		if c.HTTP2MaxUploadBufferPerStream <= 0 {
+			return errors.New("http2_max_upload_buffer_per_stream must be > 0")
+		}
+	}
+	for _, w := range c.UsageWindows {
+		if w < time.Minute {
+			return fmt.Errorf("usage_windows entry %s must be >= 1m", w)
+		}
+	}
+	if c.UsageKafkaTopic != "" && c.UsagePublishInterval <= 0 {
+		return errors.New("usage_publish_interval must be > 0 when usage_kafka_topic set")
+	}
+	if c.AdminPort != "" && c.AdminPort == c.Port {
+		return errors.New("admin_port must differ from port")
+	}
+	if c.GRPCEnabled {
+		if c.GRPCPort == "" {
+			return errors.New("grpc_port required when grpc enabled")
+		}
+		if c.GRPCPort == c.Port || c.GRPCPort == c.AdminPort {
+			return errors.New("grpc_port must differ from port and admin_port")
+		}
+		if c.GRPCMaxRecvMsgSize <= 0 {
+			return errors.New("grpc_max_recv_msg_size must be > 0")
+		}
+	}
+	if err := c.validateSyslog(); err != nil {
+		return err
+	}
+	if err := c.validateForward(); err != nil {
+		return err
+	}
+	if err := promotedLabels("es_label_fields", c.ESLabelFields, nil, "index"); err != nil {
+		return err
+	}
 	switch c.LogLevel {
-	case "info", "debug":
+	case "debug", "info", "warn", "error":
 	default:
 		return fmt.Errorf("invalid log_level: %s", c.LogLevel)
 	}
+	switch c.LogFormat {
+	case "json", "text":
+	default:
+		return fmt.Errorf("invalid log_format: %s", c.LogFormat)
+	}
+	if c.LogSampleInterval < 0 || c.LogSampleBurst < 0 {
+		return errors.New("log_sample_interval and log_sample_burst must be >= 0")
+	}
 	return nil
 }
 
+func (c *Config) validateSyslog() error {
+	if len(c.SyslogListeners) == 0 {
+		return nil
+	}
+	if c.SyslogBatchSize <= 0 || c.SyslogBatchWait <= 0 {
+		return errors.New("syslog_batch_size and syslog_batch_wait must be > 0")
+	}
+	if c.SyslogMaxMessageBytes <= 0 {
+		return errors.New("syslog_max_message_bytes must be > 0")
+	}
+	names := make(map[string]bool)
+	for _, l := range c.SyslogListeners {
+		if l.Name == "" || names[l.Name] {
+			return fmt.Errorf("syslog listener name %q must be unique and not empty", l.Name)
+		}
+		names[l.Name] = true
+		if l.Protocol != "tcp" && l.Protocol != "udp" {
+			return fmt.Errorf("syslog listener %s: protocol must be tcp or udp", l.Name)
+		}
+		if l.Address == "" {
+			return fmt.Errorf("syslog listener %s: address required", l.Name)
+		}
+		if l.Tenant == "" {
+			return fmt.Errorf("syslog listener %s: tenant required", l.Name)
+		}
+		for k := range l.Labels {
+			if !validLabelName(k) {
+				return fmt.Errorf("syslog listener %s: invalid label name %q", l.Name, k)
+			}
+			if syslogLabels[k] {
+				return fmt.Errorf("syslog listener %s: label %q is set from the message", l.Name, k)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateForward() error {
+	names := make(map[string]bool)
+	for _, l := range c.ForwardListeners {
+		if l.Name == "" || names[l.Name] {
+			return fmt.Errorf("forward listener name %q must be unique and not empty", l.Name)
+		}
+		names[l.Name] = true
+		if l.Address == "" {
+			return fmt.Errorf("forward listener %s: address required", l.Name)
+		}
+		if l.Tenant == "" {
+			return fmt.Errorf("forward listener %s: tenant required", l.Name)
+		}
+		for k := range l.Labels {
+			if !validLabelName(k) {
+				return fmt.Errorf("forward listener %s: invalid label name %q", l.Name, k)
+			}
+			if k == "tag" {
+				return fmt.Errorf("forward listener %s: label %q is set from the message", l.Name, k)
+			}
+		}
+		if err := promotedLabels("forward_label_keys", c.ForwardLabelKeys, l.Labels, "tag"); err != nil {
+			return fmt.Errorf("forward listener %s: %w", l.Name, err)
+		}
+	}
+	return promotedLabels("forward_label_keys", c.ForwardLabelKeys, nil, "tag")
+}
+
+// syslogLabels are the labels syslog listeners set from each message.
+var syslogLabels = map[string]bool{"hostname": true, "app": true, "facility": true, "severity": true}
+
+// promotedLabels checks record fields promoted to labels: the label names
+// they become must be unique and not taken by static labels or by labels
+// the endpoint sets itself. A stream with a label twice is rejected by Loki.
+func promotedLabels(option string, fields []string, static map[string]string, reserved ...string) error {
+	seen := make(map[string]string, len(fields))
+	for _, f := range fields {
+		if f == "" {
+			return fmt.Errorf("%s: empty field name", option)
+		}
+		name := logproto.SanitizeLabelName(f)
+		if prev, ok := seen[name]; ok {
+			return fmt.Errorf("%s: %q and %q both become label %q", option, prev, f, name)
+		}
+		seen[name] = f
+		if _, ok := static[name]; ok {
+			return fmt.Errorf("%s: %q becomes label %q, also set in labels", option, f, name)
+		}
+		for _, r := range reserved {
+			if name == r {
+				return fmt.Errorf("%s: %q becomes label %q, which the endpoint sets itself", option, f, name)
+			}
+		}
+	}
+	return nil
+}
+
+func validLabelName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// OTLPResourceLabels are the resource attributes Loki indexes by default,
+// used when otlp_resource_labels is empty.
+var OTLPResourceLabels = []string{
+	"service.name", "service.namespace", "service.instance.id",
+	"deployment.environment", "cloud.region", "cloud.availability_zone",
+	"k8s.cluster.name", "k8s.namespace.name", "k8s.pod.name", "k8s.container.name",
+	"container.name", "k8s.replicaset.name", "k8s.deployment.name",
+	"k8s.statefulset.name", "k8s.daemonset.name", "k8s.cronjob.name", "k8s.job.name",
+}
+
+// AccessLogFields lists every field the access log can emit, in output order.
+var AccessLogFields = []string{
+	"tenant", "endpoint", "status", "result", "bytes", "duration_ms",
+	"kafka_ms", "client_ip", "user_agent", "request_id",
+}
+
+func durationStrings(ds []time.Duration) []string {
+	out := make([]string, len(ds))
+	for i, d := range ds {
+		out[i] = d.String()
+	}
+	return out
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
 // ImmutableSubset returns a struct containing only immutable config fields.
 type ImmutableSubset struct {
 	KafkaBrokers               []string
@@ -209,13 +686,13 @@ type ImmutableSubset struct {
 	KafkaBatchTimeout          time.Duration
 	KafkaBatchSize             int
 	KafkaBatchBytes            int
+	KafkaMetadataRefresh       time.Duration
 	KafkaSASLEnabled           bool
 	KafkaSASLMechanism         string
 	KafkaSASLUsername          string
 	KafkaTLSEnabled            bool
 	KafkaTLSInsecureSkipVerify bool
 	KafkaTLSCAFile             string
-	MetricsEnableTenantLabel   bool
 }
 
 func (c *Config) ImmutableSubset() ImmutableSubset {
@@ -228,13 +705,13 @@ func (c *Config) ImmutableSubset() ImmutableSubset {
 		KafkaBatchTimeout:          c.KafkaBatchTimeout,
 		KafkaBatchSize:             c.KafkaBatchSize,
 		KafkaBatchBytes:            c.KafkaBatchBytes,
+		KafkaMetadataRefresh:       c.KafkaMetadataRefreshInterval,
 		KafkaSASLEnabled:           c.KafkaSASLEnabled,
 		KafkaSASLMechanism:         c.KafkaSASLMechanism,
 		KafkaSASLUsername:          c.KafkaSASLUsername,
 		KafkaTLSEnabled:            c.KafkaTLSEnabled,
 		KafkaTLSInsecureSkipVerify: c.KafkaTLSInsecureSkipVerify,
 		KafkaTLSCAFile:             c.KafkaTLSCAFile,
-		MetricsEnableTenantLabel:   c.MetricsEnableTenantLabel,
 	}
 }
 
@@ -252,35 +729,122 @@ type RuntimeView struct {
 	KafkaBatchTimeout          string   `json:"kafka_batch_timeout"`
 	KafkaBatchSize             int      `json:"kafka_batch_size"`
 	KafkaBatchBytes            int      `json:"kafka_batch_bytes"`
+	KafkaMetadataRefresh       string   `json:"kafka_metadata_refresh_interval"`
+	KafkaWriterDrainTimeout    string   `json:"kafka_writer_drain_timeout"`
 	KafkaSASLEnabled           bool     `json:"kafka_sasl_enabled"`
 	KafkaSASLMechanism         string   `json:"kafka_sasl_mechanism"`
 	KafkaSASLUsername          string   `json:"kafka_sasl_username"`
+	KafkaSASLPassword          string   `json:"kafka_sasl_password"` // redacted
 	KafkaTLSEnabled            bool     `json:"kafka_tls_enabled"`
 	KafkaTLSInsecureSkipVerify bool     `json:"kafka_tls_insecure_skip_verify"`
 	KafkaTLSCAFile             string   `json:"kafka_tls_ca_file"`
 
 	MaxBodyBytes             int64  `json:"max_body_bytes"`
+	MaxInflightBytes         int64  `json:"max_inflight_bytes"`
+	MaxInflightBytesWait     string `json:"max_inflight_bytes_wait"`
+	MaxDecodedBodyBytes      int64  `json:"max_decoded_body_bytes"`
 	AllowEmptyTenant         bool   `json:"allow_empty_tenant"`
 	DefaultTenant            string `json:"default_tenant"`
 	MetricsEnableTenantLabel bool   `json:"metrics_enable_tenant_label"`
+	MetricsTenantMaxSeries   int    `json:"metrics_tenant_max_series"`
+
+	MetricsEnablePartitionLabels bool `json:"metrics_enable_partition_labels"`
+	MetricsPartitionMaxSeries    int  `json:"metrics_partition_max_series"`
 
 	HealthErrorRateThreshold        float64 `json:"health_error_rate_threshold"`
 	HealthConsecutiveErrorThreshold int     `json:"health_consecutive_error_threshold"`
 	HealthEvalPeriod                string  `json:"health_eval_period"`
 	SLAGaugeEnable                  bool    `json:"sla_gauge_enable"`
 
+	SLOEnabled               bool    `json:"slo_enabled"`
+	SLOAvailabilityObjective float64 `json:"slo_availability_objective"`
+	SLOLatencyObjective      float64 `json:"slo_latency_objective"`
+	SLOLatencyThreshold      string  `json:"slo_latency_threshold"`
+	SLOBudgetWindow          string  `json:"slo_budget_window"`
+	SLOReadiness             bool    `json:"slo_readiness"`
+	SLOMinRequests           int     `json:"slo_min_requests"`
+
 	RateLimitEnabled        bool    `json:"rate_limit_enabled"`
 	RateLimitGlobalRPS      float64 `json:"rate_limit_global_rps"`
 	RateLimitGlobalBurst    int     `json:"rate_limit_global_burst"`
 	RateLimitPerTenantRPS   float64 `json:"rate_limit_per_tenant_rps"`
 	RateLimitPerTenantBurst int     `json:"rate_limit_per_tenant_burst"`
 
-	LogLevel string `json:"log_level"`
-	Quiet    bool   `json:"quiet"`
-	Port     string `json:"port"`
+	ConcurrencyLimitEnabled        bool    `json:"concurrency_limit_enabled"`
+	ConcurrencyLimitInitial        int     `json:"concurrency_limit_initial"`
+	ConcurrencyLimitMin            int     `json:"concurrency_limit_min"`
+	ConcurrencyLimitMax            int     `json:"concurrency_limit_max"`
+	ConcurrencyLimitLatencyTarget  string  `json:"concurrency_limit_latency_target"`
+	ConcurrencyLimitBackoff        float64 `json:"concurrency_limit_backoff"`
+	ConcurrencyLimitTenantFairness bool    `json:"concurrency_limit_tenant_fairness"`
+
+	TracingEnabled      bool    `json:"tracing_enabled"`
+	TracingOTLPEndpoint string  `json:"tracing_otlp_endpoint"`
+	TracingOTLPURLPath  string  `json:"tracing_otlp_url_path"`
+	TracingOTLPInsecure bool    `json:"tracing_otlp_insecure"`
+	TracingSampleRatio  float64 `json:"tracing_sample_ratio"`
+	TracingServiceName  string  `json:"tracing_service_name"`
+
+	LogLevel          string `json:"log_level"`
+	LogFormat         string `json:"log_format"`
+	LogSampleInterval string `json:"log_sample_interval"`
+	LogSampleBurst    int    `json:"log_sample_burst"`
+	Quiet             bool   `json:"quiet"`
+	Port              string `json:"port"`
+
+	HTTPReadHeaderTimeout string `json:"http_read_header_timeout"`
+	HTTPReadTimeout       string `json:"http_read_timeout"`
+	HTTPWriteTimeout      string `json:"http_write_timeout"`
+	HTTPIdleTimeout       string `json:"http_idle_timeout"`
+	HTTPMaxHeaderBytes    int    `json:"http_max_header_bytes"`
+
+	HTTP2Enabled                  bool   `json:"http2_enabled"`
+	HTTP2MaxConcurrentStreams     uint32 `json:"http2_max_concurrent_streams"`
+	HTTP2MaxReadFrameSize         uint32 `json:"http2_max_read_frame_size"`
+	HTTP2MaxUploadBufferPerStream int32  `json:"http2_max_upload_buffer_per_stream"`
+
+	AccessLogEnabled            bool     `json:"access_log_enabled"`
+	AccessLogOutput             string   `json:"access_log_output"`
+	AccessLogFormat             string   `json:"access_log_format"`
+	AccessLogFields             []string `json:"access_log_fields"`
+	AccessLogSuccessSampleRatio float64  `json:"access_log_success_sample_ratio"`
+
+	ConfigWatchEnabled  bool   `json:"config_watch_enabled"`
+	ConfigWatchDebounce string `json:"config_watch_debounce"`
+
+	UsageEnabled         bool     `json:"usage_enabled"`
+	UsageWindows         []string `json:"usage_windows"`
+	UsageKafkaTopic      string   `json:"usage_kafka_topic"`
+	UsagePublishInterval string   `json:"usage_publish_interval"`
+
+	AdminPort  string `json:"admin_port"`
+	AdminToken string `json:"admin_token"` // redacted
+
+	GRPCEnabled        bool   `json:"grpc_enabled"`
+	GRPCPort           string `json:"grpc_port"`
+	GRPCMaxRecvMsgSize int    `json:"grpc_max_recv_msg_size"`
+
+	OTLPResourceLabels []string `json:"otlp_resource_labels"`
+	OTLPLogLabels      []string `json:"otlp_log_labels"`
+
+	ESMessageField   string   `json:"es_message_field"`
+	ESTimestampField string   `json:"es_timestamp_field"`
+	ESLabelFields    []string `json:"es_label_fields"`
+
+	RawTimestampField string `json:"raw_timestamp_field"`
+
+	SyslogListeners       []SyslogListener `json:"syslog_listeners"`
+	SyslogBatchSize       int              `json:"syslog_batch_size"`
+	SyslogBatchWait       string           `json:"syslog_batch_wait"`
+	SyslogMaxMessageBytes int              `json:"syslog_max_message_bytes"`
+
+	ForwardListeners  []ForwardListener `json:"forward_listeners"` // shared_key redacted
+	ForwardMessageKey string            `json:"forward_message_key"`
+	ForwardLabelKeys  []string          `json:"forward_label_keys"`
 }
 
 func (c Config) RuntimeView() RuntimeView {
+	c = c.WithoutSecrets()
 	return RuntimeView{
 		KafkaBrokers:               c.KafkaBrokers,
 		KafkaTopic:                 c.KafkaTopic,
@@ -290,33 +854,166 @@ func (c Config) RuntimeView() RuntimeView {
 		KafkaBatchTimeout:          c.KafkaBatchTimeout.String(),
 		KafkaBatchSize:             c.KafkaBatchSize,
 		KafkaBatchBytes:            c.KafkaBatchBytes,
+		KafkaMetadataRefresh:       c.KafkaMetadataRefreshInterval.String(),
+		KafkaWriterDrainTimeout:    c.KafkaWriterDrainTimeout.String(),
 		KafkaSASLEnabled:           c.KafkaSASLEnabled,
 		KafkaSASLMechanism:         c.KafkaSASLMechanism,
 		KafkaSASLUsername:          c.KafkaSASLUsername,
+		KafkaSASLPassword:          c.KafkaSASLPassword,
 		KafkaTLSEnabled:            c.KafkaTLSEnabled,
 		KafkaTLSInsecureSkipVerify: c.KafkaTLSInsecureSkipVerify,
 		KafkaTLSCAFile:             c.KafkaTLSCAFile,
 
 		MaxBodyBytes:             c.MaxBodyBytes,
+		MaxInflightBytes:         c.MaxInflightBytes,
+		MaxInflightBytesWait:     c.MaxInflightBytesWait.String(),
+		MaxDecodedBodyBytes:      c.MaxDecodedBodyBytes,
 		AllowEmptyTenant:         c.AllowEmptyTenant,
 		DefaultTenant:            c.DefaultTenant,
 		MetricsEnableTenantLabel: c.MetricsEnableTenantLabel,
+		MetricsTenantMaxSeries:   c.MetricsTenantMaxSeries,
+
+		MetricsEnablePartitionLabels: c.MetricsEnablePartitionLabels,
+		MetricsPartitionMaxSeries:    c.MetricsPartitionMaxSeries,
 
 		HealthErrorRateThreshold:        c.HealthErrorRateThreshold,
 		HealthConsecutiveErrorThreshold: c.HealthConsecutiveErrorThreshold,
 		HealthEvalPeriod:                c.HealthEvalPeriod.String(),
 		SLAGaugeEnable:                  c.SLAGaugeEnable,
 
+		SLOEnabled:               c.SLOEnabled,
+		SLOAvailabilityObjective: c.SLOAvailabilityObjective,
+		SLOLatencyObjective:      c.SLOLatencyObjective,
+		SLOLatencyThreshold:      c.SLOLatencyThreshold.String(),
+		SLOBudgetWindow:          c.SLOBudgetWindow.String(),
+		SLOReadiness:             c.SLOReadiness,
+		SLOMinRequests:           c.SLOMinRequests,
+
 		RateLimitEnabled:        c.RateLimitEnabled,
 		RateLimitGlobalRPS:      c.RateLimitGlobalRPS,
 		RateLimitGlobalBurst:    c.RateLimitGlobalBurst,
 		RateLimitPerTenantRPS:   c.RateLimitPerTenantRPS,
 		RateLimitPerTenantBurst: c.RateLimitPerTenantBurst,
 
-		LogLevel: c.LogLevel,
-		Quiet:    c.Quiet,
-		Port:     c.Port,
+		ConcurrencyLimitEnabled:        c.ConcurrencyLimitEnabled,
+		ConcurrencyLimitInitial:        c.ConcurrencyLimitInitial,
+		ConcurrencyLimitMin:            c.ConcurrencyLimitMin,
+		ConcurrencyLimitMax:            c.ConcurrencyLimitMax,
+		ConcurrencyLimitLatencyTarget:  c.ConcurrencyLimitLatencyTarget.String(),
+		ConcurrencyLimitBackoff:        c.ConcurrencyLimitBackoff,
+		ConcurrencyLimitTenantFairness: c.ConcurrencyLimitTenantFairness,
+
+		TracingEnabled:      c.TracingEnabled,
+		TracingOTLPEndpoint: c.TracingOTLPEndpoint,
+		TracingOTLPURLPath:  c.TracingOTLPURLPath,
+		TracingOTLPInsecure: c.TracingOTLPInsecure,
+		TracingSampleRatio:  c.TracingSampleRatio,
+		TracingServiceName:  c.TracingServiceName,
+
+		LogLevel:          c.LogLevel,
+		LogFormat:         c.LogFormat,
+		LogSampleInterval: c.LogSampleInterval.String(),
+		LogSampleBurst:    c.LogSampleBurst,
+		Quiet:             c.Quiet,
+		Port:              c.Port,
+
+		HTTPReadHeaderTimeout: c.HTTPReadHeaderTimeout.String(),
+		HTTPReadTimeout:       c.HTTPReadTimeout.String(),
+		HTTPWriteTimeout:      c.HTTPWriteTimeout.String(),
+		HTTPIdleTimeout:       c.HTTPIdleTimeout.String(),
+		HTTPMaxHeaderBytes:    c.HTTPMaxHeaderBytes,
+
+		HTTP2Enabled:                  c.HTTP2Enabled,
+		HTTP2MaxConcurrentStreams:     c.HTTP2MaxConcurrentStreams,
+		HTTP2MaxReadFrameSize:         c.HTTP2MaxReadFrameSize,
+		HTTP2MaxUploadBufferPerStream: c.HTTP2MaxUploadBufferPerStream,
+
+		AccessLogEnabled:            c.AccessLogEnabled,
+		AccessLogOutput:             c.AccessLogOutput,
+		AccessLogFormat:             c.AccessLogFormat,
+		AccessLogFields:             c.AccessLogFields,
+		AccessLogSuccessSampleRatio: c.AccessLogSuccessSampleRatio,
+
+		ConfigWatchEnabled:  c.ConfigWatchEnabled,
+		ConfigWatchDebounce: c.ConfigWatchDebounce.String(),
+
+		UsageEnabled:         c.UsageEnabled,
+		UsageWindows:         durationStrings(c.UsageWindows),
+		UsageKafkaTopic:      c.UsageKafkaTopic,
+		UsagePublishInterval: c.UsagePublishInterval.String(),
+
+		AdminPort:  c.AdminPort,
+		AdminToken: c.AdminToken,
+
+		GRPCEnabled:        c.GRPCEnabled,
+		GRPCPort:           c.GRPCPort,
+		GRPCMaxRecvMsgSize: c.GRPCMaxRecvMsgSize,
+
+		OTLPResourceLabels: c.OTLPResourceLabels,
+		OTLPLogLabels:      c.OTLPLogLabels,
+
+		ESMessageField:   c.ESMessageField,
+		ESTimestampField: c.ESTimestampField,
+		ESLabelFields:    c.ESLabelFields,
+
+		RawTimestampField: c.RawTimestampField,
+
+		SyslogListeners:       c.SyslogListeners,
+		SyslogBatchSize:       c.SyslogBatchSize,
+		SyslogBatchWait:       c.SyslogBatchWait.String(),
+		SyslogMaxMessageBytes: c.SyslogMaxMessageBytes,
+
+		ForwardListeners:  c.ForwardListeners,
+		ForwardMessageKey: c.ForwardMessageKey,
+		ForwardLabelKeys:  c.ForwardLabelKeys,
+	}
+}
+
+func redactForwardListeners(ls []ForwardListener) []ForwardListener {
+	if ls == nil {
+		return nil
+	}
+	out := make([]ForwardListener, len(ls))
+	for i, l := range ls {
+		l.SharedKey = redact(l.SharedKey)
+		out[i] = l
+	}
+	return out
+}
+
+// Hash returns a short hash of the view. Secrets are redacted in the view,
+// so the hash can be logged and exported without leaking them.
+func (v RuntimeView) Hash() string {
+	b, _ := json.Marshal(v)
+	return Hash(b)
+}
+
+// FieldChange is one differing field between two runtime views, named by
+// its config key.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// DiffRuntimeViews returns the fields that differ between a and b, in
+// declaration order.
+func DiffRuntimeViews(a, b RuntimeView) []FieldChange {
+	var out []FieldChange
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	t := va.Type()
+	for i := 0; i < t.NumField(); i++ {
+		fa, fb := va.Field(i).Interface(), vb.Field(i).Interface()
+		if reflect.DeepEqual(fa, fb) {
+			continue
+		}
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		out = append(out, FieldChange{Field: name, Old: fa, New: fb})
 	}
+	return out
 }
 
 // Guard for reload concurrency if needed externally
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// filePrefix marks a string value to be replaced by the content of a file,
+// e.g. "file:/etc/secrets/kafka-password" (trailing newline trimmed).
+// "file::" escapes it: "file::x" yields the literal "file:x".
+const filePrefix = "file:"
+
+// Redacted replaces secret values in WithoutSecrets.
+const Redacted = "<redacted>"
+
+// expandStrings resolves ${VAR} / ${VAR:-default} references and file:
+// references in every string, []string and map value of string fields of
+// c, including those of listener entries (e.g. a forward listener's
+// shared_key or labels). "$${" yields a literal "${" and "file::" a
+// literal "file:".
+func expandStrings(c *Config) error {
+	return expandStruct(reflect.ValueOf(c).Elem(), "")
+}
+
+func expandStruct(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := v.Field(i)
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		key = prefix + key
+		switch f.Kind() {
+		case reflect.String:
+			s, err := expandValue(f.String())
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			f.SetString(s)
+		case reflect.Slice:
+			for j := 0; j < f.Len(); j++ {
+				e := f.Index(j)
+				switch e.Kind() {
+				case reflect.String:
+					s, err := expandValue(e.String())
+					if err != nil {
+						return fmt.Errorf("%s[%d]: %w", key, j, err)
+					}
+					e.SetString(s)
+				case reflect.Struct:
+					if err := expandStruct(e, fmt.Sprintf("%s[%d].", key, j)); err != nil {
+						return err
+					}
+				}
+			}
+		case reflect.Map:
+			if f.Type().Key().Kind() != reflect.String || f.Type().Elem().Kind() != reflect.String {
+				continue
+			}
+			keys := f.MapKeys()
+			sort.Slice(keys, func(a, b int) bool { return keys[a].String() < keys[b].String() })
+			for _, k := range keys {
+				s, err := expandValue(f.MapIndex(k).String())
+				if err != nil {
+					return fmt.Errorf("%s.%s: %w", key, k.String(), err)
+				}
+				f.SetMapIndex(k, reflect.ValueOf(s).Convert(f.Type().Elem()))
+			}
+		}
+	}
+	return nil
+}
+
+func expandValue(s string) (string, error) {
+	s, err := expandEnv(s)
+	if err != nil {
+		return "", err
+	}
+	if path, ok := strings.CutPrefix(s, filePrefix); ok {
+		if rest, ok := strings.CutPrefix(path, ":"); ok {
+			return filePrefix + rest, nil
+		}
+		b, err := os.ReadFile(strings.TrimSpace(path))
+		if err != nil {
+			return "", fmt.Errorf("read %s reference: %w", filePrefix, err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	return s, nil
+}
+
+func expandEnv(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			// "$${" escape: emit a literal "${"
+			b.WriteString(s[:i-1])
+			b.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ${ in %q", s)
+		}
+		b.WriteString(s[:i])
+		expr := s[i+2 : i+end]
+		name, def, hasDef := strings.Cut(expr, ":-")
+		if name == "" {
+			return "", fmt.Errorf("empty variable name in %q", s)
+		}
+		val, ok := os.LookupEnv(name)
+		switch {
+		case ok && (val != "" || !hasDef):
+			b.WriteString(val)
+		case hasDef:
+			b.WriteString(def)
+		default:
+			return "", fmt.Errorf("environment variable %s not set", name)
+		}
+		s = s[i+end+1:]
+	}
+}
+
+// WithoutSecrets returns a copy of c with every secret replaced by
+// Redacted. Everything that shows config (RuntimeView, print-config) goes
+// through it, so a new secret field is redacted in one place.
+func (c Config) WithoutSecrets() Config {
+	c.KafkaSASLPassword = redact(c.KafkaSASLPassword)
+	c.AdminToken = redact(c.AdminToken)
+	c.ForwardListeners = redactForwardListeners(c.ForwardListeners)
+	return c
+}
+
+func redact(s string) string {
+	if s == "" {
+		return ""
+	}
+	return Redacted
+}
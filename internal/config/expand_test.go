@@ -0,0 +1,112 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandValue(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secret, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("EXPAND_SET", "value")
+	t.Setenv("EXPAND_EMPTY", "")
+	t.Setenv("EXPAND_DIR", dir)
+
+	for _, tc := range []struct {
+		in, want string
+		err      string
+	}{
+		{in: "plain", want: "plain"},
+		{in: "${EXPAND_SET}", want: "value"},
+		{in: "a-${EXPAND_SET}-${EXPAND_SET}-b", want: "a-value-value-b"},
+		{in: "${EXPAND_SET:-def}", want: "value"},
+		{in: "${EXPAND_EMPTY:-def}", want: "def"},
+		{in: "${EXPAND_UNSET:-def}", want: "def"},
+		{in: "${EXPAND_UNSET:-}", want: ""},
+		{in: "${EXPAND_EMPTY}", want: ""},
+		{in: "${EXPAND_UNSET}", err: "environment variable EXPAND_UNSET not set"},
+		{in: "${EXPAND_SET", err: "unterminated ${"},
+		{in: "${}", err: "empty variable name"},
+		{in: "$${EXPAND_SET}", want: "${EXPAND_SET}"},
+		{in: "$$${EXPAND_SET}", want: "$${EXPAND_SET}"},
+		{in: "cost $5", want: "cost $5"},
+		{in: "file:" + secret, want: "s3cret"},
+		{in: "file: " + secret + " ", want: "s3cret"},
+		{in: "file:${EXPAND_DIR}/secret", want: "s3cret"},
+		{in: "file:" + filepath.Join(dir, "missing"), err: "read file: reference"},
+		{in: "file::" + secret, want: "file:" + secret},
+		{in: "file::", want: "file:"},
+		{in: "prefix file:" + secret, want: "prefix file:" + secret},
+	} {
+		got, err := expandValue(tc.in)
+		switch {
+		case tc.err != "":
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expandValue(%q) = %q, %v, want error %q", tc.in, got, err, tc.err)
+			}
+		case err != nil || got != tc.want:
+			t.Errorf("expandValue(%q) = %q, %v, want %q", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestExpandStrings(t *testing.T) {
+	t.Setenv("EXPAND_BROKER", "kafka:9092")
+	t.Setenv("EXPAND_KEY", "k3y")
+	c := Config{
+		KafkaBrokers: []string{"${EXPAND_BROKER}", "${EXPAND_UNSET:-backup:9092}"},
+		AdminToken:   "${EXPAND_KEY}",
+		ForwardListeners: []ForwardListener{{
+			Name:      "f",
+			SharedKey: "${EXPAND_KEY}",
+			Labels:    map[string]string{"env": "${EXPAND_UNSET:-prod}", "src": "file::not-a-path"},
+		}},
+	}
+	if err := expandStrings(&c); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"kafka:9092", "backup:9092"}; !reflect.DeepEqual(c.KafkaBrokers, want) {
+		t.Errorf("kafka_brokers = %q, want %q", c.KafkaBrokers, want)
+	}
+	if c.AdminToken != "k3y" || c.ForwardListeners[0].SharedKey != "k3y" {
+		t.Errorf("admin_token = %q, shared_key = %q, want k3y", c.AdminToken, c.ForwardListeners[0].SharedKey)
+	}
+	if want := map[string]string{"env": "prod", "src": "file:not-a-path"}; !reflect.DeepEqual(c.ForwardListeners[0].Labels, want) {
+		t.Errorf("labels = %q, want %q", c.ForwardListeners[0].Labels, want)
+	}
+
+	c.ForwardListeners[0].Labels["bad"] = "${EXPAND_UNSET}"
+	err := expandStrings(&c)
+	if err == nil || !strings.HasPrefix(err.Error(), "forward_listeners[0].labels.bad: ") {
+		t.Errorf("error = %v, want it to name forward_listeners[0].labels.bad", err)
+	}
+}
+
+func TestWithoutSecrets(t *testing.T) {
+	c := Config{
+		KafkaSASLPassword: "pw",
+		AdminToken:        "tok",
+		KafkaBrokers:      []string{"kafka:9092"},
+		ForwardListeners:  []ForwardListener{{Name: "f", SharedKey: "key"}, {Name: "g"}},
+	}
+	r := c.WithoutSecrets()
+	if r.KafkaSASLPassword != Redacted || r.AdminToken != Redacted {
+		t.Errorf("kafka_sasl_password = %q, admin_token = %q, want %q", r.KafkaSASLPassword, r.AdminToken, Redacted)
+	}
+	if r.ForwardListeners[0].SharedKey != Redacted || r.ForwardListeners[1].SharedKey != "" {
+		t.Errorf("shared keys = %q, %q, want %q and empty", r.ForwardListeners[0].SharedKey, r.ForwardListeners[1].SharedKey, Redacted)
+	}
+	if r.KafkaBrokers[0] != "kafka:9092" {
+		t.Errorf("kafka_brokers = %q, want it unchanged", r.KafkaBrokers)
+	}
+	// The original keeps its secrets
+	if c.KafkaSASLPassword != "pw" || c.AdminToken != "tok" || c.ForwardListeners[0].SharedKey != "key" {
+		t.Errorf("WithoutSecrets changed the original: %+v", c)
+	}
+}
@@ -0,0 +1,112 @@
+// Package esbulk converts Elasticsearch bulk API requests (NDJSON action and
+// document lines) into Loki streams, for shippers that can only write to
+// Elasticsearch.
+package esbulk
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/logproto"
+	"github.com/DeveloperDarkhan/loki-producer/internal/record"
+)
+
+// IndexLabel is the stream label carrying the index name.
+const IndexLabel = "index"
+
+// Item is the outcome of one bulk action, reported back in the response.
+type Item struct {
+	Action string // index|create|update|delete
+	Index  string
+	ID     string
+	Status int    // 201, or 400 when the document was rejected
+	Error  string // reason of a rejection
+}
+
+type action struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id"`
+}
+
+// Convert parses a bulk body and maps its documents with m. index is the
+// default index from the URL. Documents that cannot be used fail their item
+// only; a malformed action line fails the whole request, as in
+// Elasticsearch.
+func Convert(body []byte, index string, m *record.Mapping, now time.Time) (*logproto.Batch, []Item, error) {
+	b := &logproto.Batch{}
+	var items []Item
+	for line := 1; len(body) > 0; line++ {
+		actionLine := nextLine(&body)
+		if len(bytes.TrimSpace(actionLine)) == 0 {
+			continue
+		}
+		var act map[string]action
+		if err := json.Unmarshal(actionLine, &act); err != nil || len(act) != 1 {
+			return nil, nil, fmt.Errorf("malformed action/metadata line [%d], expected an object with a single action", line)
+		}
+		var it Item
+		for name, a := range act {
+			it = Item{Action: name, Index: a.Index, ID: a.ID}
+		}
+		if it.Index == "" {
+			it.Index = index
+		}
+
+		switch it.Action {
+		case "index", "create":
+		case "delete":
+			it.Status, it.Error = 400, "delete is not supported, logs are append-only"
+			items = append(items, it)
+			continue
+		case "update":
+			nextLine(&body)
+			line++
+			it.Status, it.Error = 400, "update is not supported, logs are append-only"
+			items = append(items, it)
+			continue
+		default:
+			return nil, nil, fmt.Errorf("malformed action/metadata line [%d], expected one of [create, delete, index, update] but found [%s]", line, it.Action)
+		}
+
+		docLine := nextLine(&body)
+		line++
+		if it.Index == "" {
+			it.Status, it.Error = 400, "index is missing"
+			items = append(items, it)
+			continue
+		}
+		labels, e, err := entry(docLine, it.Index, m, now)
+		if err != nil {
+			it.Status, it.Error = 400, err.Error()
+			items = append(items, it)
+			continue
+		}
+		it.Status = 201
+		items = append(items, it)
+		b.Add(labels, e)
+	}
+	return b, items, nil
+}
+
+func nextLine(body *[]byte) []byte {
+	line, rest, _ := bytes.Cut(*body, []byte("\n"))
+	*body = rest
+	return line
+}
+
+// entry decodes one document and maps it next to the index label.
+func entry(doc []byte, index string, m *record.Mapping, now time.Time) (string, logproto.Entry, error) {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil {
+		return "", logproto.Entry{}, fmt.Errorf("failed to parse document: %v", err)
+	}
+	if fields == nil {
+		return "", logproto.Entry{}, errors.New("document is empty")
+	}
+	return m.Map(fields, []logproto.LabelPair{{Name: IndexLabel, Value: index}}, now)
+}
@@ -0,0 +1,119 @@
+package esbulk
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/logproto"
+	"github.com/DeveloperDarkhan/loki-producer/internal/record"
+)
+
+func TestConvert(t *testing.T) {
+	now := time.Unix(1800000000, 0)
+	mapping := &record.Mapping{MessageField: "message", LabelFields: []string{"service"}}
+	for _, tc := range []struct {
+		name    string
+		body    string
+		index   string
+		items   []Item
+		streams []logproto.Stream
+	}{
+		{
+			name: "index and create",
+			body: `{"index":{"_index":"app","_id":"1"}}
+{"message":"one","service":"api"}
+{"create":{}}
+{"message":"two"}
+`,
+			index: "default",
+			items: []Item{
+				{Action: "index", Index: "app", ID: "1", Status: 201},
+				{Action: "create", Index: "default", Status: 201},
+			},
+			streams: []logproto.Stream{
+				{Labels: `{index="app", service="api"}`, Entries: []logproto.Entry{{Timestamp: now, Line: "one"}}},
+				{Labels: `{index="default"}`, Entries: []logproto.Entry{{Timestamp: now, Line: "two"}}},
+			},
+		},
+		{
+			name: "update skips its document and delete has none",
+			body: `{"update":{"_index":"app","_id":"1"}}
+{"doc":{"message":"changed"}}
+{"delete":{"_index":"app","_id":"2"}}
+{"index":{"_index":"app"}}
+{"message":"kept"}`,
+			items: []Item{
+				{Action: "update", Index: "app", ID: "1", Status: 400, Error: "update is not supported, logs are append-only"},
+				{Action: "delete", Index: "app", ID: "2", Status: 400, Error: "delete is not supported, logs are append-only"},
+				{Action: "index", Index: "app", Status: 201},
+			},
+			streams: []logproto.Stream{
+				{Labels: `{index="app"}`, Entries: []logproto.Entry{{Timestamp: now, Line: "kept"}}},
+			},
+		},
+		{
+			name: "rejected documents fail their item only",
+			body: `{"index":{}}
+{"message":"no index"}
+{"index":{"_index":"app"}}
+{"message":
+{"index":{"_index":"app"}}
+null
+{"index":{"_index":"app"}}
+{"message":"ok"}
+`,
+			items: []Item{
+				{Action: "index", Status: 400, Error: "index is missing"},
+				{Action: "index", Index: "app", Status: 400, Error: "failed to parse document: unexpected EOF"},
+				{Action: "index", Index: "app", Status: 400, Error: "document is empty"},
+				{Action: "index", Index: "app", Status: 201},
+			},
+			streams: []logproto.Stream{
+				{Labels: `{index="app"}`, Entries: []logproto.Entry{{Timestamp: now, Line: "ok"}}},
+			},
+		},
+		{
+			name:  "blank lines and CRLF",
+			body:  "\n{\"index\":{}}\r\n{\"message\":\"one\"}\r\n\n",
+			index: "app",
+			items: []Item{{Action: "index", Index: "app", Status: 201}},
+			streams: []logproto.Stream{
+				{Labels: `{index="app"}`, Entries: []logproto.Entry{{Timestamp: now, Line: "one"}}},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, items, err := Convert([]byte(tc.body), tc.index, mapping, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(items, tc.items) {
+				t.Errorf("items\n %+v\nwant\n %+v", items, tc.items)
+			}
+			if !reflect.DeepEqual(b.Streams, tc.streams) {
+				t.Errorf("streams\n %+v\nwant\n %+v", b.Streams, tc.streams)
+			}
+		})
+	}
+}
+
+func TestConvertMalformedAction(t *testing.T) {
+	for _, tc := range []struct {
+		name, body, err string
+	}{
+		{"not JSON", "{\"index\":\n{}\n", "line [1]"},
+		{"two actions", `{"index":{},"create":{}}` + "\n{}\n", "line [1]"},
+		{"no action", "{}\n", "line [1]"},
+		{"unknown action", `{"index":{"_index":"a"}}` + "\n{}\n" + `{"upsert":{}}` + "\n{}\n", "line [3], expected one of [create, delete, index, update] but found [upsert]"},
+		{"document where an action belongs", `{"delete":{}}` + "\n" + `{"message":"x"}` + "\n", "line [2]"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := Convert([]byte(tc.body), "app", &record.Mapping{}, time.Now())
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("error = %v, want it to mention %q", err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,342 @@
+// Package forward implements the server side of the Fluentd Forward
+// protocol v1 as Fluentd and Fluent Bit `forward` outputs speak it: the
+// Message, Forward, PackedForward and CompressedPackedForward event modes,
+// chunk acks and the shared-key handshake.
+package forward
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+)
+
+// Event is one record with its event time.
+type Event struct {
+	Time   time.Time
+	Record map[string]any
+}
+
+// Message is one event message: one or more events under a tag.
+type Message struct {
+	Tag    string
+	Events []Event
+	Chunk  string // set when the sender waits for an ack
+}
+
+var (
+	ErrInvalid        = errors.New("forward: invalid message")
+	ErrDecodedTooLong = errors.New("forward: decompressed entries exceed the limit")
+)
+
+// Decoder reads event messages from a connection.
+type Decoder struct {
+	dec *msgpack.Decoder
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	dec := msgpack.NewDecoder(r)
+	// Integers as int64/uint64 and floats as float64, whatever their size
+	// on the wire
+	dec.UseLooseInterfaceDecoding(true)
+	return &Decoder{dec: dec}
+}
+
+// reserveChunk is what gunzip reserves at a time.
+const reserveChunk = 64 << 10
+
+// Next reads the next event message. maxDecoded bounds decompressed
+// CompressedPackedForward entries; reserve, when not nil, is called for
+// every reserveChunk bytes decompressed and stops decoding with its error.
+// When decompression fails the message was read whole, and its tag and
+// chunk are returned with the error.
+func (d *Decoder) Next(maxDecoded int64, reserve func(n int64) error) (Message, error) {
+	n, err := d.dec.DecodeArrayLen()
+	if err != nil {
+		return Message{}, err
+	}
+	if n < 2 || n > 4 {
+		return Message{}, fmt.Errorf("%w: array of %d elements", ErrInvalid, n)
+	}
+	var m Message
+	if m.Tag, err = d.dec.DecodeString(); err != nil {
+		return Message{}, err
+	}
+	c, err := d.dec.PeekCode()
+	if err != nil {
+		return Message{}, err
+	}
+
+	var packed []byte
+	rest := n - 2
+	switch {
+	case isArray(c): // Forward: [tag, [[time, record], ...], option]
+		entries, err := d.dec.DecodeArrayLen()
+		if err != nil {
+			return Message{}, err
+		}
+		for i := 0; i < entries; i++ {
+			ev, err := decodeEntry(d.dec)
+			if err != nil {
+				return Message{}, err
+			}
+			m.Events = append(m.Events, ev)
+		}
+	case msgpcode.IsBin(c) || msgpcode.IsString(c): // PackedForward: [tag, entries stream, option]
+		if packed, err = d.dec.DecodeBytes(); err != nil {
+			return Message{}, err
+		}
+	default: // Message: [tag, time, record, option]
+		if n < 3 {
+			return Message{}, fmt.Errorf("%w: message mode without record", ErrInvalid)
+		}
+		ev, err := decodeTimeRecord(d.dec)
+		if err != nil {
+			return Message{}, err
+		}
+		m.Events = []Event{ev}
+		rest--
+	}
+
+	var compressed string
+	if rest > 0 {
+		opt, err := d.dec.DecodeInterface()
+		if err != nil {
+			return Message{}, err
+		}
+		if o, ok := opt.(map[string]any); ok {
+			m.Chunk, _ = o["chunk"].(string)
+			compressed, _ = o["compressed"].(string)
+		}
+	}
+
+	if packed != nil {
+		if compressed == "gzip" {
+			if packed, err = gunzip(packed, maxDecoded, reserve); err != nil {
+				// Read whole: the caller may ack and drop it
+				return Message{Tag: m.Tag, Chunk: m.Chunk}, err
+			}
+		}
+		if m.Events, err = decodePacked(packed); err != nil {
+			return Message{}, err
+		}
+	}
+	return m, nil
+}
+
+func isArray(c byte) bool {
+	return msgpcode.IsFixedArray(c) || c == msgpcode.Array16 || c == msgpcode.Array32
+}
+
+// decodePacked decodes a stream of [time, record] entries.
+func decodePacked(b []byte) ([]Event, error) {
+	r := bytes.NewReader(b)
+	dec := msgpack.NewDecoder(r)
+	dec.UseLooseInterfaceDecoding(true)
+	var events []Event
+	for r.Len() > 0 {
+		ev, err := decodeEntry(dec)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// gunzip decompresses packed entries; Fluentd may concatenate several gzip
+// members.
+func gunzip(b []byte, max int64, reserve func(n int64) error) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = io.LimitReader(zr, max+1)
+	if reserve != nil {
+		r = &reservingReader{r: r, reserve: reserve}
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > max {
+		return nil, ErrDecodedTooLong
+	}
+	return out, nil
+}
+
+// reservingReader calls reserve before every reserveChunk bytes it reads.
+type reservingReader struct {
+	r       io.Reader
+	reserve func(n int64) error
+	left    int
+}
+
+func (rr *reservingReader) Read(p []byte) (int, error) {
+	if rr.left == 0 {
+		if err := rr.reserve(reserveChunk); err != nil {
+			return 0, err
+		}
+		rr.left = reserveChunk
+	}
+	if len(p) > rr.left {
+		p = p[:rr.left]
+	}
+	n, err := rr.r.Read(p)
+	rr.left -= n
+	return n, err
+}
+
+// decodeEntry decodes [time, record]. Fluent Bit 2.1+ may send the time as
+// [time, metadata]; the metadata is ignored.
+func decodeEntry(dec *msgpack.Decoder) (Event, error) {
+	n, err := dec.DecodeArrayLen()
+	if err != nil {
+		return Event{}, err
+	}
+	if n != 2 {
+		return Event{}, fmt.Errorf("%w: entry of %d elements", ErrInvalid, n)
+	}
+	return decodeTimeRecord(dec)
+}
+
+func decodeTimeRecord(dec *msgpack.Decoder) (Event, error) {
+	c, err := dec.PeekCode()
+	if err != nil {
+		return Event{}, err
+	}
+	var ev Event
+	if isArray(c) {
+		n, err := dec.DecodeArrayLen()
+		if err != nil {
+			return Event{}, err
+		}
+		if n < 1 {
+			return Event{}, fmt.Errorf("%w: empty time", ErrInvalid)
+		}
+		if ev.Time, err = decodeTime(dec); err != nil {
+			return Event{}, err
+		}
+		for i := 1; i < n; i++ {
+			if err := dec.Skip(); err != nil {
+				return Event{}, err
+			}
+		}
+	} else if ev.Time, err = decodeTime(dec); err != nil {
+		return Event{}, err
+	}
+	v, err := dec.DecodeInterface()
+	if err != nil {
+		return Event{}, err
+	}
+	rec, ok := v.(map[string]any)
+	if !ok {
+		return Event{}, fmt.Errorf("%w: record is %T, not a map", ErrInvalid, v)
+	}
+	ev.Record = rec
+	return ev, nil
+}
+
+// decodeTime reads EventTime (ext type 0: seconds and nanoseconds as
+// big-endian uint32) or integer/float seconds.
+func decodeTime(dec *msgpack.Decoder) (time.Time, error) {
+	c, err := dec.PeekCode()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if msgpcode.IsExt(c) {
+		id, n, err := dec.DecodeExtHeader()
+		if err != nil {
+			return time.Time{}, err
+		}
+		if id != 0 || n != 8 {
+			return time.Time{}, fmt.Errorf("%w: ext type %d of %d bytes as time", ErrInvalid, id, n)
+		}
+		var b [8]byte
+		if err := dec.ReadFull(b[:]); err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(int64(binary.BigEndian.Uint32(b[:4])), int64(binary.BigEndian.Uint32(b[4:]))), nil
+	}
+	// Loose, as senders pack integer seconds in the smallest type that fits
+	v, err := dec.DecodeInterfaceLoose()
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch t := v.(type) {
+	case int64:
+		return time.Unix(t, 0), nil
+	case uint64:
+		return time.Unix(int64(t), 0), nil
+	case float64:
+		sec := int64(t)
+		return time.Unix(sec, int64((t-float64(sec))*1e9)), nil
+	}
+	return time.Time{}, fmt.Errorf("%w: time is %T", ErrInvalid, v)
+}
+
+// WriteAck acknowledges a chunk.
+func WriteAck(enc *msgpack.Encoder, chunk string) error {
+	return enc.Encode(map[string]string{"ack": chunk})
+}
+
+// Handshake authenticates a client by shared key before any event: HELO
+// with a nonce, PING with the client's digest, PONG with the server's.
+func Handshake(dec *Decoder, enc *msgpack.Encoder, sharedKey, hostname string) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	if err := enc.Encode([]any{"HELO", map[string]any{"nonce": nonce, "auth": []byte{}, "keepalive": true}}); err != nil {
+		return err
+	}
+
+	n, err := dec.dec.DecodeArrayLen()
+	if err != nil {
+		return err
+	}
+	if n != 6 {
+		return fmt.Errorf("%w: PING of %d elements", ErrInvalid, n)
+	}
+	var ping [4][]byte // type, hostname, salt, digest; username and password are not used
+	for i := range ping {
+		if ping[i], err = dec.dec.DecodeBytes(); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := dec.dec.Skip(); err != nil {
+			return err
+		}
+	}
+	if string(ping[0]) != "PING" {
+		return fmt.Errorf("%w: expected PING, got %q", ErrInvalid, ping[0])
+	}
+	salt := ping[2]
+	want := digest(salt, ping[1], nonce, sharedKey)
+	if subtle.ConstantTimeCompare([]byte(want), ping[3]) != 1 {
+		_ = enc.Encode([]any{"PONG", false, "shared_key mismatch", hostname, ""})
+		return errors.New("forward: shared_key mismatch")
+	}
+	return enc.Encode([]any{"PONG", true, "", hostname, digest(salt, []byte(hostname), nonce, sharedKey)})
+}
+
+// digest is hex(sha512(salt + hostname + nonce + shared_key)).
+func digest(salt, hostname, nonce []byte, sharedKey string) string {
+	h := sha512.New()
+	h.Write(salt)
+	h.Write(hostname)
+	h.Write(nonce)
+	h.Write([]byte(sharedKey))
+	return hex.EncodeToString(h.Sum(nil))
+}
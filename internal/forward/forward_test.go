@@ -0,0 +1,264 @@
+package forward
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// eventTime encodes t as the EventTime ext type (fixext8, type 0).
+func eventTime(t time.Time) msgpack.RawMessage {
+	b := []byte{0xd7, 0x00, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[2:6], uint32(t.Unix()))
+	binary.BigEndian.PutUint32(b[6:], uint32(t.Nanosecond()))
+	return b
+}
+
+func pack(t *testing.T, v any) []byte {
+	t.Helper()
+	b, err := msgpack.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func gz(t *testing.T, members ...[]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, m := range members {
+		zw := gzip.NewWriter(&buf)
+		zw.Write(m)
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestDecoderNext(t *testing.T) {
+	t1 := time.Unix(1700000000, 123456789)
+	t2 := time.Unix(1700000001, 0)
+	e1 := []any{eventTime(t1), map[string]any{"log": "one", "n": 1}}
+	e2 := []any{uint32(t2.Unix()), map[string]any{"log": "two"}}
+	want := []Event{
+		{Time: t1, Record: map[string]any{"log": "one", "n": int64(1)}},
+		{Time: t2, Record: map[string]any{"log": "two"}},
+	}
+	entries := append(pack(t, e1), pack(t, e2)...)
+
+	for _, tc := range []struct {
+		name string
+		msg  []any
+		want Message
+	}{
+		{
+			name: "message",
+			msg:  []any{"app", eventTime(t1), map[string]any{"log": "one", "n": 1}},
+			want: Message{Tag: "app", Events: want[:1]},
+		},
+		{
+			name: "message with chunk",
+			msg:  []any{"app", eventTime(t1), map[string]any{"log": "one", "n": 1}, map[string]any{"chunk": "c1"}},
+			want: Message{Tag: "app", Events: want[:1], Chunk: "c1"},
+		},
+		{
+			name: "message with float time",
+			msg:  []any{"app", 1700000001.5, map[string]any{"log": "two"}},
+			want: Message{Tag: "app", Events: []Event{{Time: time.Unix(1700000001, 5e8), Record: map[string]any{"log": "two"}}}},
+		},
+		{
+			name: "forward",
+			msg:  []any{"app", []any{e1, e2}, map[string]any{"chunk": "c2"}},
+			want: Message{Tag: "app", Events: want, Chunk: "c2"},
+		},
+		{
+			name: "forward with metadata time",
+			msg:  []any{"app", []any{[]any{[]any{eventTime(t1), map[string]any{"otel": true}}, map[string]any{"log": "one", "n": 1}}}},
+			want: Message{Tag: "app", Events: want[:1]},
+		},
+		{
+			name: "packed forward",
+			msg:  []any{"app", entries},
+			want: Message{Tag: "app", Events: want},
+		},
+		{
+			name: "packed forward as str",
+			msg:  []any{"app", string(entries), map[string]any{"size": 2}},
+			want: Message{Tag: "app", Events: want},
+		},
+		{
+			name: "compressed packed forward",
+			msg:  []any{"app", gz(t, entries), map[string]any{"compressed": "gzip", "chunk": "c3"}},
+			want: Message{Tag: "app", Events: want, Chunk: "c3"},
+		},
+		{
+			name: "compressed packed forward of several gzip members",
+			msg:  []any{"app", gz(t, pack(t, e1), pack(t, e2)), map[string]any{"compressed": "gzip"}},
+			want: Message{Tag: "app", Events: want},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dec := NewDecoder(bytes.NewReader(pack(t, tc.msg)))
+			got, err := dec.Next(1<<20, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got  %+v\nwant %+v", got, tc.want)
+			}
+			if _, err := dec.Next(1<<20, nil); !errors.Is(err, io.EOF) {
+				t.Errorf("after the message: error = %v, want EOF", err)
+			}
+		})
+	}
+}
+
+func TestDecoderNextInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		msg  []any
+	}{
+		{"too short", []any{"app"}},
+		{"too long", []any{"app", 1, map[string]any{}, nil, nil}},
+		{"message without record", []any{"app", 1}},
+		{"record not a map", []any{"app", 1, "text"}},
+		{"time not a number", []any{"app", true, map[string]any{}}},
+		{"entry of three elements", []any{"app", []any{[]any{1, map[string]any{}, 2}}}},
+		{"ext time of another type", []any{"app", msgpack.RawMessage{0xd7, 0x01, 0, 0, 0, 0, 0, 0, 0, 0}, map[string]any{}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewDecoder(bytes.NewReader(pack(t, tc.msg))).Next(1<<20, nil)
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("error = %v, want %v", err, ErrInvalid)
+			}
+		})
+	}
+}
+
+func TestDecoderNextDecodedLimit(t *testing.T) {
+	rec := map[string]any{"log": string(bytes.Repeat([]byte("x"), 1000))}
+	var entries []byte
+	for i := 0; i < 200; i++ {
+		entries = append(entries, pack(t, []any{1, rec})...)
+	}
+	msg := pack(t, []any{"app", gz(t, entries), map[string]any{"compressed": "gzip", "chunk": "c1"}})
+
+	if m, err := NewDecoder(bytes.NewReader(msg)).Next(int64(len(entries)-1), nil); !errors.Is(err, ErrDecodedTooLong) {
+		t.Errorf("below the decoded size: error = %v, want %v", err, ErrDecodedTooLong)
+	} else if m.Tag != "app" || m.Chunk != "c1" {
+		t.Errorf("below the decoded size: message %+v, want its tag and chunk", m)
+	}
+	if _, err := NewDecoder(bytes.NewReader(msg)).Next(int64(len(entries)), nil); err != nil {
+		t.Errorf("at the decoded size: %v", err)
+	}
+
+	var reserved int64
+	errBudget := errors.New("budget")
+	reserve := func(n int64) error {
+		if reserved+n > 2*reserveChunk {
+			return errBudget
+		}
+		reserved += n
+		return nil
+	}
+	if _, err := NewDecoder(bytes.NewReader(msg)).Next(1<<20, reserve); !errors.Is(err, errBudget) {
+		t.Errorf("over the budget: error = %v, want %v", err, errBudget)
+	}
+	if reserved != 2*reserveChunk {
+		t.Errorf("reserved %d, want %d", reserved, 2*reserveChunk)
+	}
+}
+
+func TestWriteAck(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteAck(msgpack.NewEncoder(&buf), "c1"); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]string
+	if err := msgpack.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"ack": "c1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ack = %v, want %v", got, want)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		clientKey string
+		ok        bool
+	}{
+		{"matching key", "secret", true},
+		{"wrong key", "guess", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			client, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			server, err := ln.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			done := make(chan error, 1)
+			go func() {
+				defer server.Close()
+				done <- Handshake(NewDecoder(server), msgpack.NewEncoder(server), "secret", "distributor")
+			}()
+
+			dec := msgpack.NewDecoder(client)
+			var helo struct {
+				_msgpack struct{} `msgpack:",as_array"`
+				Type     string
+				Options  struct {
+					Nonce     []byte `msgpack:"nonce"`
+					Auth      []byte `msgpack:"auth"`
+					Keepalive bool   `msgpack:"keepalive"`
+				}
+			}
+			if err := dec.Decode(&helo); err != nil {
+				t.Fatal(err)
+			}
+			if helo.Type != "HELO" || len(helo.Options.Nonce) == 0 {
+				t.Fatalf("HELO = %+v", helo)
+			}
+
+			salt := []byte("salt")
+			ping := []any{"PING", "fluent-bit", salt, digest(salt, []byte("fluent-bit"), helo.Options.Nonce, tc.clientKey), "", ""}
+			if err := msgpack.NewEncoder(client).Encode(ping); err != nil {
+				t.Fatal(err)
+			}
+			var pong []any
+			if err := dec.Decode(&pong); err != nil {
+				t.Fatal(err)
+			}
+			if len(pong) != 5 || pong[0] != "PONG" || pong[1] != tc.ok {
+				t.Fatalf("PONG = %v", pong)
+			}
+			if tc.ok {
+				if want := digest(salt, []byte("distributor"), helo.Options.Nonce, "secret"); pong[4] != want {
+					t.Errorf("server digest = %v, want %v", pong[4], want)
+				}
+			}
+			if err := <-done; (err == nil) != tc.ok {
+				t.Errorf("Handshake error = %v", err)
+			}
+		})
+	}
+}
@@ -6,10 +6,13 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/segmentio/kafka-go"
@@ -18,7 +21,22 @@ import (
 )
 
 type Writer struct {
-	w *kafka.Writer
+	w      *kafka.Writer
+	client *kafka.Client
+	topic  string
+
+	// partition -> leader broker address, refreshed from cluster metadata
+	leaders   atomic.Pointer[map[int]string]
+	refreshCh chan struct{}
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+}
+
+// Delivery describes where a message was routed by the writer.
+type Delivery struct {
+	Topic     string
+	Partition int    // -1 if the writer failed before a partition was chosen
+	Leader    string // leader broker from the last metadata refresh, "" if unknown
 }
 
 type WriterConfig struct {
@@ -41,6 +59,9 @@ type WriterConfig struct {
 	TLSEnabled            bool
 	TLSInsecureSkipVerify bool
 	TLSCAFile             string
+
+	// Partition leader metadata refresh interval (0 disables leader tracking)
+	MetadataRefreshInterval time.Duration
 }
 
 func NewWriter(cfg WriterConfig) (*Writer, error) {
@@ -144,7 +165,7 @@ func NewWriter(cfg WriterConfig) (*Writer, error) {
 	w := &kafka.Writer{
 		Addr:         kafka.TCP(cfg.Brokers...),
 		Topic:        cfg.Topic,
-		Balancer:     balancer,
+		Balancer:     recordingBalancer{Balancer: balancer},
 		RequiredAcks: reqAcks,
 		Async:        false,
 		Transport:    tr,
@@ -162,18 +183,121 @@ func NewWriter(cfg WriterConfig) (*Writer, error) {
 		v := strings.TrimSpace(os.Getenv("KAFKA_DEBUG"))
 		return v == "1" || strings.EqualFold(v, "true")
 	}() {
-		w.Logger = log.New(os.Stdout, "kafka.writer ", log.LstdFlags|log.Lmicroseconds)
-		w.ErrorLogger = log.New(os.Stderr, "kafka.writer.err ", log.LstdFlags|log.Lmicroseconds)
-		log.Printf("kafka debug enabled: topic=%s brokers=%s acks=%d balancer=%T tls=%t sasl=%t batchTimeout=%s batchSize=%d batchBytes=%d", cfg.Topic, strings.Join(cfg.Brokers, ","), cfg.RequiredAcks, balancer, cfg.TLSEnabled, cfg.SASLEnabled, w.BatchTimeout, w.BatchSize, w.BatchBytes)
+		w.Logger = kafka.LoggerFunc(func(msg string, args ...interface{}) {
+			slog.Debug(fmt.Sprintf(msg, args...), "component", "kafka.writer")
+		})
+		w.ErrorLogger = kafka.LoggerFunc(func(msg string, args ...interface{}) {
+			slog.Error(fmt.Sprintf(msg, args...), "component", "kafka.writer")
+		})
+		slog.Info("kafka debug enabled",
+			"topic", cfg.Topic, "brokers", strings.Join(cfg.Brokers, ","), "acks", cfg.RequiredAcks,
+			"balancer", fmt.Sprintf("%T", balancer), "tls", cfg.TLSEnabled, "sasl", cfg.SASLEnabled,
+			"batch_timeout", w.BatchTimeout.String(), "batch_size", w.BatchSize, "batch_bytes", w.BatchBytes)
 	}
 
-	return &Writer{w: w}, nil
+	wr := &Writer{
+		w:         w,
+		client:    &kafka.Client{Addr: w.Addr, Transport: tr, Timeout: cfg.WriteTimeout},
+		topic:     cfg.Topic,
+		refreshCh: make(chan struct{}, 1),
+		stopCh:    make(chan struct{}),
+	}
+	if cfg.MetadataRefreshInterval > 0 {
+		wr.wg.Add(1)
+		go wr.leaderLoop(cfg.MetadataRefreshInterval)
+	}
+	return wr, nil
+}
+
+// Write produces msg synchronously and reports the partition (and its leader)
+// the message was routed to, also when the write fails.
+func (w *Writer) Write(ctx context.Context, msg kafka.Message) (Delivery, error) {
+	d := &Delivery{Topic: w.topic, Partition: -1}
+	msg.WriterData = d
+	err := w.w.WriteMessages(ctx, msg)
+	if d.Partition >= 0 {
+		d.Leader = w.leaderFor(d.Partition)
+	}
+	if err != nil {
+		// leadership may have moved; refresh metadata ahead of schedule
+		select {
+		case w.refreshCh <- struct{}{}:
+		default:
+		}
+	}
+	return *d, err
 }
 
-func (w *Writer) Write(ctx context.Context, msg kafka.Message) error {
-	return w.w.WriteMessages(ctx, msg)
+// WriteBatch writes msgs in one call, for side traffic (e.g. usage records)
+// that does not need per-message delivery details.
+func (w *Writer) WriteBatch(ctx context.Context, msgs ...kafka.Message) error {
+	return w.w.WriteMessages(ctx, msgs...)
 }
 
 func (w *Writer) Close() error {
+	close(w.stopCh)
+	w.wg.Wait()
 	return w.w.Close()
 }
+
+func (w *Writer) leaderFor(partition int) string {
+	m := w.leaders.Load()
+	if m == nil {
+		return ""
+	}
+	return (*m)[partition]
+}
+
+func (w *Writer) leaderLoop(interval time.Duration) {
+	defer w.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	w.refreshLeaders()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.refreshCh:
+		case <-w.stopCh:
+			return
+		}
+		w.refreshLeaders()
+	}
+}
+
+func (w *Writer) refreshLeaders() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := w.client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{w.topic}})
+	if err != nil {
+		slog.Debug("kafka metadata refresh failed", "topic", w.topic, "error", err.Error())
+		return
+	}
+	leaders := make(map[int]string)
+	for _, t := range resp.Topics {
+		if t.Name != w.topic {
+			continue
+		}
+		for _, p := range t.Partitions {
+			if p.Leader.Host != "" {
+				leaders[p.ID] = net.JoinHostPort(p.Leader.Host, strconv.Itoa(p.Leader.Port))
+			} else {
+				leaders[p.ID] = strconv.Itoa(p.Leader.ID)
+			}
+		}
+	}
+	w.leaders.Store(&leaders)
+}
+
+// recordingBalancer remembers the chosen partition in the Delivery carried by
+// the message, so Write can report it even if the produce request fails.
+type recordingBalancer struct {
+	kafka.Balancer
+}
+
+func (b recordingBalancer) Balance(msg kafka.Message, partitions ...int) int {
+	p := b.Balancer.Balance(msg, partitions...)
+	if d, ok := msg.WriterData.(*Delivery); ok {
+		d.Partition = p
+	}
+	return p
+}
@@ -0,0 +1,126 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// level is shared by the default logger so a reload can change verbosity
+// without rebuilding handlers.
+var level = new(slog.LevelVar)
+
+// Setup installs the process-wide slog logger writing to stderr in the given
+// format (json|text). The standard log package is routed through it as well.
+func Setup(format, lvl string, quiet bool) error {
+	return SetupWriter(os.Stderr, format, lvl, quiet)
+}
+
+func SetupWriter(w io.Writer, format, lvl string, quiet bool) error {
+	if err := SetLevel(lvl, quiet); err != nil {
+		return err
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "json":
+		h = slog.NewJSONHandler(w, opts)
+	case "text", "logfmt":
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return fmt.Errorf("unsupported log format: %s", format)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// SetLevel updates the minimum level of the default logger. quiet raises
+// info to warn, keeping the historical meaning of the quiet flag.
+func SetLevel(lvl string, quiet bool) error {
+	l, err := ParseLevel(lvl)
+	if err != nil {
+		return err
+	}
+	if quiet && l < slog.LevelWarn {
+		l = slog.LevelWarn
+	}
+	level.Set(l)
+	return nil
+}
+
+// ParseLevel maps config level names to slog levels.
+func ParseLevel(lvl string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(lvl)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("invalid log level: %s", lvl)
+	}
+}
+
+// Sampler rate-limits repetitive log lines per key: the first burst lines of
+// every interval pass, the rest are counted and reported with the next line
+// that passes.
+type Sampler struct {
+	interval time.Duration
+	burst    int
+
+	mu   sync.Mutex
+	keys map[string]*sampleState
+}
+
+type sampleState struct {
+	windowStart time.Time
+	count       int
+	suppressed  int
+}
+
+// maxSampleKeys bounds memory when keys include tenants; on overflow the
+// map is reset, which at worst lets one extra burst per key through.
+const maxSampleKeys = 10000
+
+// NewSampler returns a sampler; interval <= 0 or burst <= 0 disables sampling.
+func NewSampler(interval time.Duration, burst int) *Sampler {
+	return &Sampler{interval: interval, burst: burst, keys: make(map[string]*sampleState)}
+}
+
+// Allow reports whether a line for key should be logged, and how many lines
+// for the key were dropped since the last one that was logged.
+func (s *Sampler) Allow(key string) (bool, int) {
+	if s == nil || s.interval <= 0 || s.burst <= 0 {
+		return true, 0
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.keys[key]
+	if !ok {
+		if len(s.keys) >= maxSampleKeys {
+			s.keys = make(map[string]*sampleState)
+		}
+		st = &sampleState{windowStart: now}
+		s.keys[key] = st
+	}
+	if now.Sub(st.windowStart) >= s.interval {
+		st.windowStart = now
+		st.count = 0
+	}
+	st.count++
+	if st.count > s.burst {
+		st.suppressed++
+		return false, 0
+	}
+	dropped := st.suppressed
+	st.suppressed = 0
+	return true, dropped
+}
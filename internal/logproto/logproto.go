@@ -0,0 +1,234 @@
+// Package logproto builds Loki push requests (logproto.PushRequest) for the
+// endpoints that convert other log formats, encoded by hand with protowire
+// so the records on the topic match a protobuf push from a Loki client.
+package logproto
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// LabelPair is a stream label or a structured metadata entry.
+type LabelPair struct {
+	Name, Value string
+}
+
+type Entry struct {
+	Timestamp          time.Time
+	Line               string
+	StructuredMetadata []LabelPair
+}
+
+type Stream struct {
+	Labels  string // Loki selector syntax, see LabelsString
+	Entries []Entry
+}
+
+// Batch groups entries into streams by their label string, keeping the
+// order streams were first seen. It tracks its encoded size so callers can
+// cut batches at a byte limit.
+type Batch struct {
+	Streams []Stream
+	Lines   int
+	index   map[string]int
+	sizes   []int // encoded size of each stream's message
+	size    int   // encoded size of the PushRequest
+}
+
+func (b *Batch) Add(labels string, e Entry) {
+	if b.index == nil {
+		b.index = make(map[string]int)
+	}
+	i, ok := b.index[labels]
+	if !ok {
+		i = len(b.Streams)
+		b.index[labels] = i
+		b.Streams = append(b.Streams, Stream{Labels: labels})
+		b.sizes = append(b.sizes, stringSize(fieldStreamLabels, labels))
+	} else {
+		b.size -= messageSize(fieldPushStreams, b.sizes[i])
+	}
+	b.sizes[i] += messageSize(fieldStreamEntries, entrySize(&e))
+	b.size += messageSize(fieldPushStreams, b.sizes[i])
+	b.Streams[i].Entries = append(b.Streams[i].Entries, e)
+	b.Lines++
+}
+
+// Size is the encoded size of the batch as a PushRequest.
+func (b *Batch) Size() int {
+	return b.size
+}
+
+// SizeWith is what Size would be after adding e under labels.
+func (b *Batch) SizeWith(labels string, e *Entry) int {
+	n, old := stringSize(fieldStreamLabels, labels), 0
+	if i, ok := b.index[labels]; ok {
+		n, old = b.sizes[i], messageSize(fieldPushStreams, b.sizes[i])
+	}
+	n += messageSize(fieldStreamEntries, entrySize(e))
+	return b.size - old + messageSize(fieldPushStreams, n)
+}
+
+// LabelsString sorts labels by name (in place) and formats them the way
+// Loki prints a stream selector: {a="x", b="y"}.
+func LabelsString(labels []LabelPair) string {
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(l.Name)
+		sb.WriteByte('=')
+		sb.WriteString(strconv.Quote(l.Value))
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// SanitizeLabelName turns an attribute name into a valid label name as
+// Loki's OTLP translation does: other characters than [a-zA-Z0-9_] become
+// "_", a leading digit gets a "key_" prefix, a single leading "_" a "key"
+// prefix.
+func SanitizeLabelName(name string) string {
+	if name == "" {
+		return name
+	}
+	b := []byte(name)
+	for i, c := range b {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	s := string(b)
+	switch {
+	case s[0] >= '0' && s[0] <= '9':
+		s = "key_" + s
+	case s[0] == '_' && !strings.HasPrefix(s, "__"):
+		s = "key" + s
+	}
+	return s
+}
+
+// Field numbers of pkg/push/push.proto.
+const (
+	fieldPushStreams = 1
+
+	fieldStreamLabels  = 1
+	fieldStreamEntries = 2
+
+	fieldEntryTimestamp = 1
+	fieldEntryLine      = 2
+	fieldEntryMetadata  = 3
+
+	fieldPairName  = 1
+	fieldPairValue = 2
+
+	fieldTimestampSeconds = 1
+	fieldTimestampNanos   = 2
+)
+
+// Size is the encoded size of a PushRequest with streams.
+func Size(streams []Stream) int {
+	n := 0
+	for i := range streams {
+		n += messageSize(fieldPushStreams, streamSize(&streams[i]))
+	}
+	return n
+}
+
+// AppendPushRequest appends streams encoded as a PushRequest to b.
+func AppendPushRequest(b []byte, streams []Stream) []byte {
+	for i := range streams {
+		s := &streams[i]
+		b = appendTag(b, fieldPushStreams, streamSize(s))
+		b = appendString(b, fieldStreamLabels, s.Labels)
+		for j := range s.Entries {
+			e := &s.Entries[j]
+			b = appendTag(b, fieldStreamEntries, entrySize(e))
+			b = appendTag(b, fieldEntryTimestamp, timestampSize(e.Timestamp))
+			b = appendTimestamp(b, e.Timestamp)
+			b = appendString(b, fieldEntryLine, e.Line)
+			for _, p := range e.StructuredMetadata {
+				b = appendTag(b, fieldEntryMetadata, pairSize(p))
+				b = appendString(b, fieldPairName, p.Name)
+				b = appendString(b, fieldPairValue, p.Value)
+			}
+		}
+	}
+	return b
+}
+
+func streamSize(s *Stream) int {
+	n := stringSize(fieldStreamLabels, s.Labels)
+	for i := range s.Entries {
+		n += messageSize(fieldStreamEntries, entrySize(&s.Entries[i]))
+	}
+	return n
+}
+
+func entrySize(e *Entry) int {
+	n := messageSize(fieldEntryTimestamp, timestampSize(e.Timestamp)) + stringSize(fieldEntryLine, e.Line)
+	for _, p := range e.StructuredMetadata {
+		n += messageSize(fieldEntryMetadata, pairSize(p))
+	}
+	return n
+}
+
+func pairSize(p LabelPair) int {
+	return stringSize(fieldPairName, p.Name) + stringSize(fieldPairValue, p.Value)
+}
+
+// timestampSize is the size of a google.protobuf.Timestamp; zero fields are
+// omitted as proto3 does.
+func timestampSize(t time.Time) int {
+	n := 0
+	if sec := t.Unix(); sec != 0 {
+		n += protowire.SizeTag(fieldTimestampSeconds) + protowire.SizeVarint(uint64(sec))
+	}
+	if nsec := t.Nanosecond(); nsec != 0 {
+		n += protowire.SizeTag(fieldTimestampNanos) + protowire.SizeVarint(uint64(nsec))
+	}
+	return n
+}
+
+func appendTimestamp(b []byte, t time.Time) []byte {
+	if sec := t.Unix(); sec != 0 {
+		b = protowire.AppendTag(b, fieldTimestampSeconds, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(sec))
+	}
+	if nsec := t.Nanosecond(); nsec != 0 {
+		b = protowire.AppendTag(b, fieldTimestampNanos, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(nsec))
+	}
+	return b
+}
+
+func messageSize(field protowire.Number, size int) int {
+	return protowire.SizeTag(field) + protowire.SizeBytes(size)
+}
+
+func stringSize(field protowire.Number, s string) int {
+	if s == "" {
+		return 0
+	}
+	return protowire.SizeTag(field) + protowire.SizeBytes(len(s))
+}
+
+func appendTag(b []byte, field protowire.Number, size int) []byte {
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendVarint(b, uint64(size))
+}
+
+func appendString(b []byte, field protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
@@ -0,0 +1,198 @@
+package logproto
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// pushRequestDesc describes the messages of Loki's pkg/push/push.proto that
+// the encoder writes, so tests can decode its output with the protobuf
+// runtime instead of trusting the encoder's own field numbers.
+func pushRequestDesc(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string, repeated bool) *descriptorpb.FieldDescriptorProto {
+		label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		if repeated {
+			label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		}
+		f := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Type: typ.Enum(), Label: label.Enum()}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	const (
+		str = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		msg = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	)
+	fd := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("push.proto"),
+		Package:    proto.String("logproto"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("PushRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("streams", 1, msg, ".logproto.StreamAdapter", true),
+			}},
+			{Name: proto.String("StreamAdapter"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("labels", 1, str, "", false),
+				field("entries", 2, msg, ".logproto.EntryAdapter", true),
+			}},
+			{Name: proto.String("EntryAdapter"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("timestamp", 1, msg, ".google.protobuf.Timestamp", false),
+				field("line", 2, str, "", false),
+				field("structuredMetadata", 3, msg, ".logproto.LabelPairAdapter", true),
+			}},
+			{Name: proto.String("LabelPairAdapter"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("name", 1, str, "", false),
+				field("value", 2, str, "", false),
+			}},
+		},
+	}
+	file, err := protodesc.NewFile(fd, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file.Messages().ByName("PushRequest")
+}
+
+// decodePush decodes b as a PushRequest back into streams.
+func decodePush(t *testing.T, desc protoreflect.MessageDescriptor, b []byte) []Stream {
+	t.Helper()
+	req := dynamicpb.NewMessage(desc)
+	if err := proto.Unmarshal(b, req); err != nil {
+		t.Fatal(err)
+	}
+	get := func(m protoreflect.Message, name string) protoreflect.Value {
+		return m.Get(m.Descriptor().Fields().ByName(protoreflect.Name(name)))
+	}
+	var streams []Stream
+	list := get(req, "streams").List()
+	for i := 0; i < list.Len(); i++ {
+		sm := list.Get(i).Message()
+		s := Stream{Labels: get(sm, "labels").String()}
+		entries := get(sm, "entries").List()
+		for j := 0; j < entries.Len(); j++ {
+			em := entries.Get(j).Message()
+			ts := get(em, "timestamp").Message()
+			e := Entry{
+				Timestamp: time.Unix(get(ts, "seconds").Int(), get(ts, "nanos").Int()),
+				Line:      get(em, "line").String(),
+			}
+			md := get(em, "structuredMetadata").List()
+			for k := 0; k < md.Len(); k++ {
+				pm := md.Get(k).Message()
+				e.StructuredMetadata = append(e.StructuredMetadata, LabelPair{Name: get(pm, "name").String(), Value: get(pm, "value").String()})
+			}
+			s.Entries = append(s.Entries, e)
+		}
+		streams = append(streams, s)
+	}
+	return streams
+}
+
+func TestAppendPushRequest(t *testing.T) {
+	desc := pushRequestDesc(t)
+	long := string(make([]byte, 300)) // lengths above one varint byte
+	for _, tc := range []struct {
+		name    string
+		streams []Stream
+	}{
+		{"empty", nil},
+		{
+			name: "one entry",
+			streams: []Stream{{Labels: `{job="a"}`, Entries: []Entry{
+				{Timestamp: time.Unix(1700000000, 123), Line: "hello"},
+			}}},
+		},
+		{
+			name: "metadata and several streams",
+			streams: []Stream{
+				{Labels: `{job="a"}`, Entries: []Entry{
+					{Timestamp: time.Unix(1700000000, 0), Line: "one", StructuredMetadata: []LabelPair{{"trace_id", "abc"}, {"level", "info"}}},
+					{Timestamp: time.Unix(1700000001, 999999999), Line: long},
+				}},
+				{Labels: `{job="b"}`, Entries: []Entry{
+					{Timestamp: time.Unix(1, 0), Line: "two"},
+				}},
+			},
+		},
+		{
+			name: "zero fields omitted",
+			streams: []Stream{{Labels: `{job="a"}`, Entries: []Entry{
+				{Timestamp: time.Unix(0, 0), Line: ""},
+				{Timestamp: time.Unix(0, 5), Line: "x", StructuredMetadata: []LabelPair{{"empty", ""}}},
+			}}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := AppendPushRequest(nil, tc.streams)
+			if size := Size(tc.streams); size != len(b) {
+				t.Errorf("Size = %d, encoded %d bytes", size, len(b))
+			}
+			got := decodePush(t, desc, b)
+			if !reflect.DeepEqual(got, tc.streams) {
+				t.Errorf("decoded\n %+v\nwant\n %+v", got, tc.streams)
+			}
+		})
+	}
+}
+
+func TestBatchSize(t *testing.T) {
+	entries := []struct {
+		labels string
+		e      Entry
+	}{
+		{`{job="a"}`, Entry{Timestamp: time.Unix(1700000000, 1), Line: "first"}},
+		{`{job="b"}`, Entry{Timestamp: time.Unix(1700000000, 2), Line: string(make([]byte, 200))}},
+		{`{job="a"}`, Entry{Timestamp: time.Unix(1700000000, 3), Line: "third", StructuredMetadata: []LabelPair{{"k", "v"}}}},
+		{`{job="a"}`, Entry{Timestamp: time.Unix(1700000000, 4), Line: string(make([]byte, 20000))}},
+		{`{job="c"}`, Entry{Timestamp: time.Unix(1700000000, 5)}},
+	}
+	var b Batch
+	for i, x := range entries {
+		with := b.SizeWith(x.labels, &x.e)
+		b.Add(x.labels, x.e)
+		if b.Size() != with {
+			t.Errorf("entry %d: SizeWith = %d, Size after Add = %d", i, with, b.Size())
+		}
+		if n := len(AppendPushRequest(nil, b.Streams)); b.Size() != n {
+			t.Errorf("entry %d: Size = %d, encoded %d bytes", i, b.Size(), n)
+		}
+	}
+	if b.Lines != len(entries) || len(b.Streams) != 3 {
+		t.Errorf("%d lines in %d streams, want %d in 3", b.Lines, len(b.Streams), len(entries))
+	}
+}
+
+func TestLabelsString(t *testing.T) {
+	labels := []LabelPair{{"job", "a"}, {"app", `say "hi"`}}
+	if got, want := LabelsString(labels), `{app="say \"hi\"", job="a"}`; got != want {
+		t.Errorf("LabelsString = %s, want %s", got, want)
+	}
+}
+
+func TestSanitizeLabelName(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                 "",
+		"service.name":     "service_name",
+		"k8s.pod.name":     "k8s_pod_name",
+		"1st":              "key_1st",
+		"_private":         "key_private",
+		"__reserved":       "__reserved",
+		"http-status code": "http_status_code",
+	} {
+		if got := SanitizeLabelName(in); got != want {
+			t.Errorf("SanitizeLabelName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -1,16 +1,18 @@
 package metrics
 
 import (
+	"strconv"
+	"sync"
 	"sync/atomic"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 type Registry struct {
-	enableTenant bool
+	// requests_total and request_bytes_total, with a runtime-switchable tenant label
+	requests             *TenantCounters
+	TenantSeriesOverflow prometheus.Counter
 
-	RequestsTotal          *prometheus.CounterVec
-	RequestBytesTotal      *prometheus.CounterVec
 	KafkaWriteErrorsTotal  *prometheus.CounterVec
 	KafkaWriteDurationHist *prometheus.HistogramVec
 	RequestDurationHist    *prometheus.HistogramVec
@@ -19,28 +21,70 @@ type Registry struct {
 	SLASuccessRatio        prometheus.Gauge
 	RateLimitedTotal       *prometheus.CounterVec
 
+	// Adaptive concurrency limit
+	ConcurrencyLimit prometheus.Gauge
+	InflightRequests prometheus.Gauge
+	ShedTotal        *prometheus.CounterVec
+
+	// HTTP/2 (h2c) streams on the ingest listener
+	HTTP2StreamsActive prometheus.Gauge
+	HTTP2StreamsTotal  prometheus.Counter
+
+	// In-flight body memory budget
+	InflightBytes      prometheus.Gauge
+	InflightBytesLimit prometheus.Gauge
+
+	// Syslog listeners
+	SyslogMessagesTotal     *prometheus.CounterVec
+	SyslogConnectionsActive *prometheus.GaugeVec
+
+	// Fluent Forward listeners
+	ForwardEventsTotal       *prometheus.CounterVec
+	ForwardConnectionsActive *prometheus.GaugeVec
+
+	// Per-partition produce metrics (topic, partition, broker)
+	KafkaPartitionWriteDurationHist *prometheus.HistogramVec
+	KafkaPartitionWriteErrorsTotal  *prometheus.CounterVec
+	KafkaPartitionBytesTotal        *prometheus.CounterVec
+	KafkaPartitionSeriesOverflow    prometheus.Counter
+
+	// Kafka writer generations (a reload that changes immutable fields starts a new one)
+	KafkaWriterGeneration    prometheus.Gauge
+	KafkaWritersDraining     prometheus.Gauge
+	KafkaWriterDrainDuration *prometheus.HistogramVec
+
+	// SLO evaluation (slo=availability|latency)
+	SLOObjective            *prometheus.GaugeVec
+	SLOBurnRate             *prometheus.GaugeVec
+	SLOErrorBudgetRemaining *prometheus.GaugeVec
+	SLOAlertFiring          *prometheus.GaugeVec
+
+	// Usage records published to usage_kafka_topic
+	UsageRecordsPublishedTotal prometheus.Counter
+	UsagePublishErrorsTotal    prometheus.Counter
+
+	// Config reloads
+	ConfigReloadsTotal               *prometheus.CounterVec
+	ConfigLastReloadSuccessful       prometheus.Gauge
+	ConfigLastReloadSuccessTimestamp prometheus.Gauge
+	ConfigHash                       prometheus.Gauge
+
+	partitionMu     sync.Mutex
+	partitionSeries map[partitionKey]struct{}
+
 	totalSuccess atomic.Uint64
 	totalError   atomic.Uint64
 	totalAll     atomic.Uint64
 }
 
-func NewRegistry(enableTenant, slaGaugeEnable bool) *Registry {
-	reqLabels := []string{"endpoint", "result", "content_type_class"}
-	reqBytesLabels := []string{"endpoint"}
-	if enableTenant {
-		reqLabels = append(reqLabels, "tenant")
-		reqBytesLabels = append(reqBytesLabels, "tenant")
-	}
-
+// NewRegistry registers the produce metrics on reg. The tenant label starts
+// disabled; see SetTenantLabel.
+func NewRegistry(reg prometheus.Registerer, slaGaugeEnable bool) *Registry {
 	r := &Registry{
-		RequestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
-			Name: "pulse_loki_produce_requests_total",
-			Help: "Total HTTP push requests processed, partitioned by result",
-		}, reqLabels),
-		RequestBytesTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
-			Name: "pulse_loki_produce_request_bytes_total",
-			Help: "Total request body bytes received",
-		}, reqBytesLabels),
+		TenantSeriesOverflow: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "pulse_loki_produce_tenant_series_overflow_total",
+			Help: "Request and bytes increments counted under tenant=\"__other__\" by the tenant series cap",
+		}),
 		KafkaWriteErrorsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Name: "pulse_loki_produce_kafka_write_errors_total",
 			Help: "Kafka write errors by classified type",
@@ -67,6 +111,121 @@ func NewRegistry(enableTenant, slaGaugeEnable bool) *Registry {
 			Name: "pulse_loki_produce_rate_limited_total",
 			Help: "Requests rejected due to rate limiting",
 		}, []string{"scope"}),
+		ConcurrencyLimit: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pulse_loki_produce_concurrency_limit",
+			Help: "Current adaptive limit of concurrent pushes",
+		}),
+		InflightRequests: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pulse_loki_produce_inflight_requests",
+			Help: "Pushes holding a concurrency slot",
+		}),
+		ShedTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pulse_loki_produce_shed_total",
+			Help: "Pushes rejected by the concurrency limit or memory budget (reason=overloaded|tenant_overloaded|memory_exhausted)",
+		}, []string{"reason"}),
+		HTTP2StreamsActive: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pulse_loki_produce_http2_streams_active",
+			Help: "Open HTTP/2 streams on the ingest listener",
+		}),
+		HTTP2StreamsTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "pulse_loki_produce_http2_streams_total",
+			Help: "HTTP/2 streams (requests) served on the ingest listener",
+		}),
+		SyslogMessagesTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pulse_loki_produce_syslog_messages_total",
+			Help: "Syslog messages by listener and result (success|invalid|too_long|dropped)",
+		}, []string{"listener", "result"}),
+		SyslogConnectionsActive: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "pulse_loki_produce_syslog_connections_active",
+			Help: "Open TCP connections per syslog listener",
+		}, []string{"listener"}),
+		ForwardEventsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pulse_loki_produce_forward_events_total",
+			Help: "Fluent Forward events by listener and result (success|rejected|too_large); invalid counts undecodable messages, too_large also messages whose entries exceed the decompression or memory limits",
+		}, []string{"listener", "result"}),
+		ForwardConnectionsActive: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "pulse_loki_produce_forward_connections_active",
+			Help: "Open connections per Fluent Forward listener",
+		}, []string{"listener"}),
+		InflightBytes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pulse_loki_produce_inflight_bytes",
+			Help: "Request body bytes reserved from max_inflight_bytes",
+		}),
+		InflightBytesLimit: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pulse_loki_produce_inflight_bytes_limit",
+			Help: "Configured max_inflight_bytes, 0 when unlimited",
+		}),
+		KafkaPartitionWriteDurationHist: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "pulse_loki_produce_kafka_partition_write_duration_seconds",
+			Help:    "Kafka write latency by topic, partition and leader broker",
+			Buckets: []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2, 5},
+		}, []string{"topic", "partition", "broker", "result"}),
+		KafkaPartitionWriteErrorsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pulse_loki_produce_kafka_partition_write_errors_total",
+			Help: "Kafka write errors by topic, partition, leader broker and classified type",
+		}, []string{"topic", "partition", "broker", "error_type"}),
+		KafkaPartitionBytesTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pulse_loki_produce_kafka_partition_bytes_total",
+			Help: "Message bytes successfully written by topic, partition and leader broker",
+		}, []string{"topic", "partition", "broker"}),
+		KafkaPartitionSeriesOverflow: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "pulse_loki_produce_kafka_partition_series_overflow_total",
+			Help: "Writes folded into partition=\"__other__\" by the series cap",
+		}),
+		KafkaWriterGeneration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pulse_loki_produce_kafka_writer_generation",
+			Help: "Generation of the Kafka writer serving new requests (1 at startup, +1 per rebuild)",
+		}),
+		KafkaWritersDraining: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pulse_loki_produce_kafka_writers_draining",
+			Help: "Replaced Kafka writers still finishing in-flight writes",
+		}),
+		KafkaWriterDrainDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "pulse_loki_produce_kafka_writer_drain_duration_seconds",
+			Help:    "Time from replacing a Kafka writer to closing it, by result (drained|timeout)",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"result"}),
+		SLOObjective: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "pulse_loki_produce_slo_objective",
+			Help: "Configured SLO target",
+		}, []string{"slo"}),
+		SLOBurnRate: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "pulse_loki_produce_slo_burn_rate",
+			Help: "Error budget burn rate over the window (1 = budget exactly used up over the budget window)",
+		}, []string{"slo", "window"}),
+		SLOErrorBudgetRemaining: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "pulse_loki_produce_slo_error_budget_remaining_ratio",
+			Help: "Share of the error budget left over the budget window since start (negative when exhausted)",
+		}, []string{"slo"}),
+		SLOAlertFiring: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "pulse_loki_produce_slo_alert_firing",
+			Help: "1 while a multi-window burn-rate rule of the severity fires",
+		}, []string{"slo", "severity"}),
+		UsageRecordsPublishedTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "pulse_loki_produce_usage_records_published_total",
+			Help: "Per-tenant usage records written to the usage topic",
+		}),
+		UsagePublishErrorsTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "pulse_loki_produce_usage_publish_errors_total",
+			Help: "Failed usage record batches (the interval is missing from the topic)",
+		}),
+		ConfigReloadsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pulse_loki_produce_config_reloads_total",
+			Help: "Config reload attempts by source (signal|http|watch) and result",
+		}, []string{"source", "result"}),
+		ConfigLastReloadSuccessful: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pulse_loki_produce_config_last_reload_successful",
+			Help: "1 if the last config reload succeeded, 0 otherwise",
+		}),
+		ConfigLastReloadSuccessTimestamp: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pulse_loki_produce_config_last_reload_success_timestamp_seconds",
+			Help: "Unix time of the last successful config load",
+		}),
+		ConfigHash: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pulse_loki_produce_config_hash",
+			Help: "Hash of the loaded config file (first 48 bits of the sha256, as a number)",
+		}),
+		partitionSeries: make(map[partitionKey]struct{}),
 	}
 
 	if slaGaugeEnable {
@@ -76,40 +235,79 @@ func NewRegistry(enableTenant, slaGaugeEnable bool) *Registry {
 		})
 	}
 
+	r.requests = newTenantCounters(r.TenantSeriesOverflow)
+
 	toRegister := []prometheus.Collector{
-		r.RequestsTotal,
-		r.RequestBytesTotal,
+		r.requests,
+		r.TenantSeriesOverflow,
 		r.KafkaWriteErrorsTotal,
 		r.KafkaWriteDurationHist,
 		r.RequestDurationHist,
 		r.HealthUp,
 		r.KafkaConsecutiveErrors,
 		r.RateLimitedTotal,
+		r.ConcurrencyLimit,
+		r.InflightRequests,
+		r.ShedTotal,
+		r.HTTP2StreamsActive,
+		r.HTTP2StreamsTotal,
+		r.SyslogMessagesTotal,
+		r.SyslogConnectionsActive,
+		r.ForwardEventsTotal,
+		r.ForwardConnectionsActive,
+		r.InflightBytes,
+		r.InflightBytesLimit,
+		r.KafkaPartitionWriteDurationHist,
+		r.KafkaPartitionWriteErrorsTotal,
+		r.KafkaPartitionBytesTotal,
+		r.KafkaPartitionSeriesOverflow,
+		r.KafkaWriterGeneration,
+		r.KafkaWritersDraining,
+		r.KafkaWriterDrainDuration,
+		r.SLOObjective,
+		r.SLOBurnRate,
+		r.SLOErrorBudgetRemaining,
+		r.SLOAlertFiring,
+		r.UsageRecordsPublishedTotal,
+		r.UsagePublishErrorsTotal,
+		r.ConfigReloadsTotal,
+		r.ConfigLastReloadSuccessful,
+		r.ConfigLastReloadSuccessTimestamp,
+		r.ConfigHash,
 	}
 	if slaGaugeEnable {
 		toRegister = append(toRegister, r.SLASuccessRatio)
 	}
-	for _, c := range toRegister {
-		prometheus.MustRegister(c)
-	}
+	reg.MustRegister(toRegister...)
 
 	r.HealthUp.Set(1)
+	r.ConfigLastReloadSuccessful.Set(1)
+	r.ConfigLastReloadSuccessTimestamp.SetToCurrentTime()
 	r.KafkaConsecutiveErrors.Set(0)
 
 	return r
 }
 
-func (r *Registry) MakeRequestLabels(endpoint, result, ctClass, tenant string) []string {
-	if r.enableTenant {
-		return []string{endpoint, result, ctClass, tenant}
-	}
-	return []string{endpoint, result, ctClass}
+// SetTenantLabel switches the tenant label of request metrics; at most
+// maxTenants tenants get their own series (see TenantCounters).
+func (r *Registry) SetTenantLabel(enabled bool, maxTenants int) {
+	r.requests.SetTenantLabel(enabled, maxTenants)
 }
-func (r *Registry) MakeRequestBytesLabels(endpoint, tenant string) []string {
-	if r.enableTenant {
-		return []string{endpoint, tenant}
-	}
-	return []string{endpoint}
+
+// RankTenants re-ranks the tenants with their own series; run it every
+// TenantRankInterval.
+func (r *Registry) RankTenants() {
+	r.requests.Rank()
+}
+
+// ObserveRequest counts one push request.
+func (r *Registry) ObserveRequest(endpoint, result, ctClass, tenant string) {
+	r.requests.ObserveRequest(endpoint, result, ctClass, tenant)
+}
+
+// ObserveRequestBytes counts received body bytes.
+func (r *Registry) ObserveRequestBytes(endpoint, tenant string, n int) {
+	r.requests.ObserveBytes(endpoint, tenant, float64(n))
 }
 
 func (r *Registry) TrackResult(isSuccess, isError bool) {
@@ -124,4 +322,46 @@ func (r *Registry) TrackResult(isSuccess, isError bool) {
 
 func (r *Registry) Snapshot() (total, success, errors uint64) {
 	return r.totalAll.Load(), r.totalSuccess.Load(), r.totalError.Load()
-}
\ No newline at end of file
+}
+
+// OtherLabel replaces label values that exceed a cardinality cap.
+const OtherLabel = "__other__"
+
+type partitionKey struct {
+	topic, partition, broker string
+}
+
+// PartitionLabels returns topic/partition/broker label values for a write.
+// Once maxSeries distinct combinations have been seen, new ones are folded
+// into OtherLabel so a leader reshuffle cannot blow up cardinality.
+func (r *Registry) PartitionLabels(topic string, partition int, broker string, maxSeries int) (string, string, string) {
+	k := partitionKey{topic: topic, partition: "unknown", broker: broker}
+	if partition >= 0 {
+		k.partition = strconv.Itoa(partition)
+	}
+	if k.broker == "" {
+		k.broker = "unknown"
+	}
+	r.partitionMu.Lock()
+	defer r.partitionMu.Unlock()
+	if _, ok := r.partitionSeries[k]; !ok {
+		if len(r.partitionSeries) >= maxSeries {
+			r.KafkaPartitionSeriesOverflow.Inc()
+			return topic, OtherLabel, OtherLabel
+		}
+		r.partitionSeries[k] = struct{}{}
+	}
+	return k.topic, k.partition, k.broker
+}
+
+// SetConfigHash exports a hex config hash (see config.Hash) as a gauge value.
+func (r *Registry) SetConfigHash(hash string) {
+	if len(hash) > 12 {
+		hash = hash[:12]
+	}
+	v, err := strconv.ParseUint(hash, 16, 64)
+	if err != nil {
+		return
+	}
+	r.ConfigHash.Set(float64(v))
+}
@@ -0,0 +1,262 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxTrackedTenants bounds the per-tenant volume table; the tenant comes from
+// a request header, so it must not grow without limit.
+const maxTrackedTenants = 10000
+
+// TenantRankInterval is how often Rank should run. Volumes decay with
+// tenantVolumeHalfLife, so the top set follows recent traffic.
+const (
+	TenantRankInterval   = time.Minute
+	tenantVolumeHalfLife = 10 * time.Minute
+)
+
+// rankDecay is what a volume keeps per TenantRankInterval.
+var rankDecay = math.Pow(0.5, float64(TenantRankInterval)/float64(tenantVolumeHalfLife))
+
+type requestKey struct {
+	endpoint, result, ctClass, tenant string
+}
+
+type bytesKey struct {
+	endpoint, tenant string
+}
+
+// TenantCounters backs pulse_loki_produce_requests_total and
+// pulse_loki_produce_request_bytes_total. The tenant label can be switched
+// on and off at runtime, so the label set is not fixed and the collector is
+// unchecked (Describe sends nothing).
+//
+// With the tenant label on, the top maxTenants tenants by received bytes get
+// their own series and the rest are counted under tenant="__other__". A
+// tenant takes a free slot once bytes from it were received, so rejected
+// requests with made-up tenants cannot. Rank re-ranks the top set every
+// TenantRankInterval by volumes that halve every tenantVolumeHalfLife; a
+// demoted tenant's counts move to "__other__", so sums never go down.
+type TenantCounters struct {
+	mu         sync.Mutex
+	enabled    bool
+	maxTenants int
+
+	requests map[requestKey]float64 // tenant always empty
+	bytes    map[string]float64     // by endpoint
+
+	tenantRequests map[requestKey]float64
+	tenantBytes    map[bytesKey]float64
+	volume         map[string]float64 // decaying received bytes per tenant, ranks tenants
+	labeled        map[string]bool
+
+	overflow prometheus.Counter
+
+	requestsDesc       *prometheus.Desc
+	requestsTenantDesc *prometheus.Desc
+	bytesDesc          *prometheus.Desc
+	bytesTenantDesc    *prometheus.Desc
+}
+
+func newTenantCounters(overflow prometheus.Counter) *TenantCounters {
+	const (
+		reqName   = "pulse_loki_produce_requests_total"
+		reqHelp   = "Total HTTP push requests processed, partitioned by result"
+		bytesName = "pulse_loki_produce_request_bytes_total"
+		bytesHelp = "Total request body bytes received"
+	)
+	return &TenantCounters{
+		requests:           make(map[requestKey]float64),
+		bytes:              make(map[string]float64),
+		tenantRequests:     make(map[requestKey]float64),
+		tenantBytes:        make(map[bytesKey]float64),
+		volume:             make(map[string]float64),
+		labeled:            make(map[string]bool),
+		overflow:           overflow,
+		requestsDesc:       prometheus.NewDesc(reqName, reqHelp, []string{"endpoint", "result", "content_type_class"}, nil),
+		requestsTenantDesc: prometheus.NewDesc(reqName, reqHelp, []string{"endpoint", "result", "content_type_class", "tenant"}, nil),
+		bytesDesc:          prometheus.NewDesc(bytesName, bytesHelp, []string{"endpoint"}, nil),
+		bytesTenantDesc:    prometheus.NewDesc(bytesName, bytesHelp, []string{"endpoint", "tenant"}, nil),
+	}
+}
+
+// SetTenantLabel switches the tenant dimension and its series cap. Turning
+// it off drops the per-tenant series; turning it on starts them from zero.
+func (t *TenantCounters) SetTenantLabel(enabled bool, maxTenants int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if enabled == t.enabled && maxTenants == t.maxTenants {
+		return
+	}
+	t.enabled = enabled
+	t.maxTenants = maxTenants
+	if !enabled {
+		t.tenantRequests = make(map[requestKey]float64)
+		t.tenantBytes = make(map[bytesKey]float64)
+		t.volume = make(map[string]float64)
+		t.labeled = make(map[string]bool)
+		return
+	}
+	t.applyTopLocked(topTenants(t.volumesLocked(), maxTenants), t.labeled)
+}
+
+// tenantLabelLocked returns the label value for tenant. With claim set
+// (bytes were received from it) the tenant takes a free slot.
+func (t *TenantCounters) tenantLabelLocked(tenant string, claim bool) string {
+	if t.labeled[tenant] {
+		return tenant
+	}
+	if claim && len(t.labeled) < t.maxTenants {
+		t.labeled[tenant] = true
+		return tenant
+	}
+	t.overflow.Inc()
+	return OtherLabel
+}
+
+func (t *TenantCounters) ObserveRequest(endpoint, result, ctClass, tenant string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.requests[requestKey{endpoint, result, ctClass, ""}]++
+	if t.enabled {
+		t.tenantRequests[requestKey{endpoint, result, ctClass, t.tenantLabelLocked(tenant, false)}]++
+	}
+}
+
+func (t *TenantCounters) ObserveBytes(endpoint, tenant string, n float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.bytes[endpoint] += n
+	if !t.enabled {
+		return
+	}
+	if _, ok := t.volume[tenant]; ok || len(t.volume) < maxTrackedTenants {
+		t.volume[tenant] += n
+	}
+	t.tenantBytes[bytesKey{endpoint, t.tenantLabelLocked(tenant, true)}] += n
+}
+
+// tenantVolume is a tenant and its received bytes, as ranked.
+type tenantVolume struct {
+	tenant string
+	bytes  float64
+}
+
+func (t *TenantCounters) volumesLocked() []tenantVolume {
+	vols := make([]tenantVolume, 0, len(t.volume))
+	for tenant, v := range t.volume {
+		vols = append(vols, tenantVolume{tenant, v})
+	}
+	return vols
+}
+
+// topTenants returns the top maxTenants tenants by volume.
+func topTenants(vols []tenantVolume, maxTenants int) map[string]bool {
+	sort.Slice(vols, func(i, j int) bool {
+		if vols[i].bytes != vols[j].bytes {
+			return vols[i].bytes > vols[j].bytes
+		}
+		return vols[i].tenant < vols[j].tenant
+	})
+	if len(vols) > maxTenants {
+		vols = vols[:maxTenants]
+	}
+	top := make(map[string]bool, maxTenants)
+	for _, v := range vols {
+		top[v.tenant] = true
+	}
+	return top
+}
+
+// Rank re-ranks the top set and decays the volumes; it runs every
+// TenantRankInterval. The sort runs on a copy, outside the lock every
+// request takes.
+func (t *TenantCounters) Rank() {
+	t.mu.Lock()
+	if !t.enabled {
+		t.mu.Unlock()
+		return
+	}
+	maxTenants := t.maxTenants
+	vols := t.volumesLocked()
+	ranked := make(map[string]bool, len(t.labeled))
+	for tenant := range t.labeled {
+		ranked[tenant] = true
+	}
+	t.mu.Unlock()
+
+	top := topTenants(vols, maxTenants)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.enabled || t.maxTenants != maxTenants {
+		return // SetTenantLabel ranked meanwhile
+	}
+	t.applyTopLocked(top, ranked)
+	for tenant, v := range t.volume {
+		if v *= rankDecay; v < 1 {
+			delete(t.volume, tenant)
+		} else {
+			t.volume[tenant] = v
+		}
+	}
+}
+
+// applyTopLocked makes top the labeled set. Tenants that took a free slot
+// after ranked was copied keep it while there is room. The counts of the
+// others move to "__other__".
+func (t *TenantCounters) applyTopLocked(top, ranked map[string]bool) {
+	for tenant := range t.labeled {
+		if !ranked[tenant] && !top[tenant] && len(top) < t.maxTenants {
+			top[tenant] = true
+		}
+	}
+	for k, v := range t.tenantRequests {
+		if k.tenant != OtherLabel && !top[k.tenant] {
+			delete(t.tenantRequests, k)
+			k.tenant = OtherLabel
+			t.tenantRequests[k] += v
+		}
+	}
+	for k, v := range t.tenantBytes {
+		if k.tenant != OtherLabel && !top[k.tenant] {
+			delete(t.tenantBytes, k)
+			k.tenant = OtherLabel
+			t.tenantBytes[k] += v
+		}
+	}
+	t.labeled = top
+}
+
+// Describe sends nothing: the label set changes with SetTenantLabel.
+func (t *TenantCounters) Describe(chan<- *prometheus.Desc) {}
+
+// Collect sends the series, outside the lock.
+func (t *TenantCounters) Collect(ch chan<- prometheus.Metric) {
+	var metrics []prometheus.Metric
+	t.mu.Lock()
+	if !t.enabled {
+		for k, v := range t.requests {
+			metrics = append(metrics, prometheus.MustNewConstMetric(t.requestsDesc, prometheus.CounterValue, v, k.endpoint, k.result, k.ctClass))
+		}
+		for endpoint, v := range t.bytes {
+			metrics = append(metrics, prometheus.MustNewConstMetric(t.bytesDesc, prometheus.CounterValue, v, endpoint))
+		}
+	} else {
+		for k, v := range t.tenantRequests {
+			metrics = append(metrics, prometheus.MustNewConstMetric(t.requestsTenantDesc, prometheus.CounterValue, v, k.endpoint, k.result, k.ctClass, k.tenant))
+		}
+		for k, v := range t.tenantBytes {
+			metrics = append(metrics, prometheus.MustNewConstMetric(t.bytesTenantDesc, prometheus.CounterValue, v, k.endpoint, k.tenant))
+		}
+	}
+	t.mu.Unlock()
+	for _, m := range metrics {
+		ch <- m
+	}
+}
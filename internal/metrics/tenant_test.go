@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func newTestCounters(maxTenants int) *TenantCounters {
+	t := newTenantCounters(prometheus.NewCounter(prometheus.CounterOpts{Name: "test_overflow_total"}))
+	t.SetTenantLabel(true, maxTenants)
+	return t
+}
+
+// push observes one successful push of n bytes, as the server does.
+func push(t *TenantCounters, tenant string, n float64) {
+	t.ObserveBytes("/push", tenant, n)
+	t.ObserveRequest("/push", "success", "proto", tenant)
+}
+
+// series collects the counters by metric and tenant.
+func series(tb testing.TB, t *TenantCounters) (requests, bytes map[string]float64) {
+	tb.Helper()
+	ch := make(chan prometheus.Metric, 100)
+	t.Collect(ch)
+	close(ch)
+	requests, bytes = make(map[string]float64), make(map[string]float64)
+	for m := range ch {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			tb.Fatal(err)
+		}
+		var tenant string
+		for _, l := range pb.GetLabel() {
+			if l.GetName() == "tenant" {
+				tenant = l.GetValue()
+			}
+		}
+		if len(pb.GetLabel()) == 2 {
+			bytes[tenant] += pb.GetCounter().GetValue()
+		} else {
+			requests[tenant] += pb.GetCounter().GetValue()
+		}
+	}
+	return requests, bytes
+}
+
+func sum(m map[string]float64) float64 {
+	var n float64
+	for _, v := range m {
+		n += v
+	}
+	return n
+}
+
+func TestTenantCountersTopN(t *testing.T) {
+	c := newTestCounters(2)
+	push(c, "a", 300)
+	push(c, "b", 200)
+	push(c, "c", 100) // no slot left
+	c.Rank()
+
+	requests, bytes := series(t, c)
+	want := map[string]float64{"a": 300, "b": 200, OtherLabel: 100}
+	for tenant, n := range want {
+		if bytes[tenant] != n {
+			t.Errorf("bytes[%s] = %v, want %v", tenant, bytes[tenant], n)
+		}
+		if requests[tenant] != 1 {
+			t.Errorf("requests[%s] = %v, want 1", tenant, requests[tenant])
+		}
+	}
+	if len(bytes) != 3 {
+		t.Errorf("bytes series %v, want a, b and %s", bytes, OtherLabel)
+	}
+}
+
+func TestTenantCountersDemotion(t *testing.T) {
+	c := newTestCounters(2)
+	push(c, "a", 300)
+	push(c, "b", 200)
+	c.Rank()
+	beforeRequests, beforeBytes := series(t, c)
+
+	// c outgrows b; it is counted under __other__ until the next rank
+	push(c, "c", 1000)
+	push(c, "c", 1000)
+	c.Rank()
+	requests, bytes := series(t, c)
+
+	if _, ok := bytes["b"]; ok {
+		t.Errorf("demoted tenant b still has a series: %v", bytes)
+	}
+	if bytes[OtherLabel] != 200+2000 || requests[OtherLabel] != 1+2 {
+		t.Errorf("__other__ = %v bytes, %v requests; want b's counts folded in", bytes[OtherLabel], requests[OtherLabel])
+	}
+	if sum(bytes) != sum(beforeBytes)+2000 || sum(requests) != sum(beforeRequests)+2 {
+		t.Errorf("sums went from %v/%v to %v/%v", sum(beforeBytes), sum(beforeRequests), sum(bytes), sum(requests))
+	}
+
+	// c got the slot: from now on it has its own series
+	push(c, "c", 10)
+	if _, bytes := series(t, c); bytes["c"] != 10 {
+		t.Errorf("bytes[c] = %v, want 10", bytes["c"])
+	}
+}
+
+func TestTenantCountersMonotonic(t *testing.T) {
+	c := newTestCounters(3)
+	var lastRequests, lastBytes float64
+	last := make(map[string]float64)
+	tenants := []string{"a", "b", "c", "d", "e"}
+	for round := 0; round < 50; round++ {
+		// The busiest tenant changes every round
+		for i, tenant := range tenants {
+			push(c, tenant, float64(1+(i+round)%len(tenants)*100))
+		}
+		c.Rank()
+		requests, bytes := series(t, c)
+		if sum(requests) < lastRequests || sum(bytes) < lastBytes {
+			t.Fatalf("round %d: sums went down", round)
+		}
+		if bytes[OtherLabel] < last[OtherLabel] {
+			t.Fatalf("round %d: __other__ went down", round)
+		}
+		lastRequests, lastBytes, last = sum(requests), sum(bytes), bytes
+		if len(bytes) > 4 {
+			t.Fatalf("round %d: %d series, want at most 3 tenants and %s", round, len(bytes), OtherLabel)
+		}
+	}
+	if want := float64(50 * len(tenants)); lastRequests != want {
+		t.Errorf("requests = %v, want %v", lastRequests, want)
+	}
+}
+
+func TestTenantCountersRejectedDoNotTakeSlots(t *testing.T) {
+	c := newTestCounters(2)
+	for _, tenant := range []string{"x1", "x2", "x3"} {
+		c.ObserveRequest("/push", "rate_limited", "other", tenant)
+	}
+	push(c, "a", 10)
+	requests, _ := series(t, c)
+	if requests[OtherLabel] != 3 || requests["a"] != 1 {
+		t.Errorf("requests = %v, want the rejected ones under %s and a with its own series", requests, OtherLabel)
+	}
+}
+
+func TestTenantCountersDecay(t *testing.T) {
+	c := newTestCounters(1)
+	push(c, "old", 1e6) // a burst long ago
+	c.Rank()
+	for i := 0; i < 120; i++ {
+		push(c, "new", 1e4) // steady recent traffic
+		c.Rank()
+	}
+	if _, bytes := series(t, c); bytes["old"] != 0 || bytes["new"] == 0 {
+		t.Errorf("bytes = %v, want new ranked above the decayed old", bytes)
+	}
+}
+
+func TestTenantCountersNewSlotKeptAcrossRank(t *testing.T) {
+	c := newTestCounters(3)
+	push(c, "a", 100)
+	c.mu.Lock()
+	ranked := map[string]bool{"a": true}
+	top := topTenants(c.volumesLocked(), c.maxTenants)
+	c.mu.Unlock()
+
+	// b takes a free slot between the copy and applying the ranking
+	push(c, "b", 10)
+	c.mu.Lock()
+	delete(top, "b")
+	c.applyTopLocked(top, ranked)
+	c.mu.Unlock()
+
+	if _, bytes := series(t, c); bytes["b"] != 10 || bytes[OtherLabel] != 0 {
+		t.Errorf("bytes = %v, want b to keep its series", bytes)
+	}
+}
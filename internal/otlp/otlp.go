@@ -0,0 +1,212 @@
+// Package otlp converts OTLP logs (ExportLogsServiceRequest) into Loki
+// streams following Loki's OTLP mapping: selected resource attributes
+// become stream labels, everything else structured metadata.
+package otlp
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/logproto"
+)
+
+// unknownService labels streams whose resource has no service.name.
+const unknownService = "unknown_service"
+
+// Mapping selects the attributes promoted to stream labels.
+type Mapping struct {
+	resource map[string]bool
+	log      map[string]bool
+}
+
+// NewMapping promotes the given resource and log record attributes (by
+// their OTLP names, e.g. "k8s.pod.name") to labels.
+func NewMapping(resourceLabels, logLabels []string) *Mapping {
+	m := &Mapping{resource: make(map[string]bool), log: make(map[string]bool)}
+	for _, k := range resourceLabels {
+		m.resource[k] = true
+	}
+	for _, k := range logLabels {
+		m.log[k] = true
+	}
+	return m
+}
+
+// Convert decodes an OTLP/HTTP body, protobuf or (isJSON) JSON, into a batch.
+func (m *Mapping) Convert(data []byte, isJSON bool) (*logproto.Batch, error) {
+	var req collogspb.ExportLogsServiceRequest
+	var err error
+	if isJSON {
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, &req)
+	} else {
+		err = proto.Unmarshal(data, &req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b := &logproto.Batch{}
+	now := time.Now()
+	for _, rl := range req.GetResourceLogs() {
+		var labels, resMeta []logproto.LabelPair
+		hasService := false
+		for _, kv := range rl.GetResource().GetAttributes() {
+			if m.resource[kv.GetKey()] {
+				labels = append(labels, logproto.LabelPair{Name: logproto.SanitizeLabelName(kv.GetKey()), Value: valueString(kv.GetValue())})
+				hasService = hasService || kv.GetKey() == "service.name"
+				continue
+			}
+			resMeta = flatten(resMeta, kv.GetKey(), kv.GetValue())
+		}
+		if !hasService {
+			labels = append(labels, logproto.LabelPair{Name: "service_name", Value: unknownService})
+		}
+		resLabels := logproto.LabelsString(labels)
+
+		for _, sl := range rl.GetScopeLogs() {
+			scopeMeta := resMeta[:len(resMeta):len(resMeta)]
+			for _, kv := range sl.GetScope().GetAttributes() {
+				scopeMeta = flatten(scopeMeta, kv.GetKey(), kv.GetValue())
+			}
+			if name := sl.GetScope().GetName(); name != "" {
+				scopeMeta = append(scopeMeta, logproto.LabelPair{Name: "scope_name", Value: name})
+			}
+			if version := sl.GetScope().GetVersion(); version != "" {
+				scopeMeta = append(scopeMeta, logproto.LabelPair{Name: "scope_version", Value: version})
+			}
+			scopeMeta = scopeMeta[:len(scopeMeta):len(scopeMeta)]
+
+			for _, lr := range sl.GetLogRecords() {
+				streamLabels, meta := resLabels, scopeMeta
+				var extra []logproto.LabelPair
+				for _, kv := range lr.GetAttributes() {
+					if m.log[kv.GetKey()] {
+						extra = append(extra, logproto.LabelPair{Name: logproto.SanitizeLabelName(kv.GetKey()), Value: valueString(kv.GetValue())})
+						continue
+					}
+					meta = flatten(meta, kv.GetKey(), kv.GetValue())
+				}
+				if len(extra) > 0 {
+					streamLabels = logproto.LabelsString(append(extra, labels...))
+				}
+				meta = recordMetadata(meta, lr, isJSON)
+				b.Add(streamLabels, logproto.Entry{
+					Timestamp:          recordTime(lr, now),
+					Line:               valueString(lr.GetBody()),
+					StructuredMetadata: meta,
+				})
+			}
+		}
+	}
+	return b, nil
+}
+
+// recordMetadata adds the log record fields Loki keeps as structured
+// metadata. OTLP/JSON carries trace and span IDs as hex, which protojson
+// decodes as base64; encoding the bytes back gives the hex string.
+func recordMetadata(meta []logproto.LabelPair, lr *logspb.LogRecord, isJSON bool) []logproto.LabelPair {
+	id := hex.EncodeToString
+	if isJSON {
+		id = base64.StdEncoding.EncodeToString
+	}
+	if v := lr.GetSeverityText(); v != "" {
+		meta = append(meta, logproto.LabelPair{Name: "severity_text", Value: v})
+	}
+	if v := lr.GetSeverityNumber(); v != 0 {
+		meta = append(meta, logproto.LabelPair{Name: "severity_number", Value: strconv.Itoa(int(v))})
+	}
+	if v := lr.GetTraceId(); len(v) > 0 {
+		meta = append(meta, logproto.LabelPair{Name: "trace_id", Value: id(v)})
+	}
+	if v := lr.GetSpanId(); len(v) > 0 {
+		meta = append(meta, logproto.LabelPair{Name: "span_id", Value: id(v)})
+	}
+	if v := lr.GetFlags(); v != 0 {
+		meta = append(meta, logproto.LabelPair{Name: "flags", Value: strconv.FormatUint(uint64(v), 10)})
+	}
+	if v := lr.GetObservedTimeUnixNano(); v != 0 {
+		meta = append(meta, logproto.LabelPair{Name: "observed_timestamp", Value: strconv.FormatUint(v, 10)})
+	}
+	return meta
+}
+
+// recordTime is the event time, else the observed time, else now.
+func recordTime(lr *logspb.LogRecord, now time.Time) time.Time {
+	if ts := lr.GetTimeUnixNano(); ts != 0 {
+		return time.Unix(0, int64(ts))
+	}
+	if ts := lr.GetObservedTimeUnixNano(); ts != 0 {
+		return time.Unix(0, int64(ts))
+	}
+	return now
+}
+
+// flatten appends an attribute as structured metadata; nested maps become
+// one entry per leaf, keys joined with "_".
+func flatten(dst []logproto.LabelPair, key string, v *commonpb.AnyValue) []logproto.LabelPair {
+	if kvs, ok := v.GetValue().(*commonpb.AnyValue_KvlistValue); ok {
+		for _, kv := range kvs.KvlistValue.GetValues() {
+			dst = flatten(dst, key+"_"+kv.GetKey(), kv.GetValue())
+		}
+		return dst
+	}
+	return append(dst, logproto.LabelPair{Name: logproto.SanitizeLabelName(key), Value: valueString(v)})
+}
+
+// valueString renders a value as the collector's pdata AsString does:
+// scalars plainly, bytes as base64, arrays and maps as JSON.
+func valueString(v *commonpb.AnyValue) string {
+	switch x := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return x.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(x.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(x.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(x.DoubleValue, 'f', -1, 64)
+	case *commonpb.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(x.BytesValue)
+	case *commonpb.AnyValue_ArrayValue, *commonpb.AnyValue_KvlistValue:
+		b, _ := json.Marshal(jsonValue(v))
+		return string(b)
+	}
+	return ""
+}
+
+func jsonValue(v *commonpb.AnyValue) any {
+	switch x := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return x.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return x.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return x.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return x.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(x.BytesValue)
+	case *commonpb.AnyValue_ArrayValue:
+		out := make([]any, 0, len(x.ArrayValue.GetValues()))
+		for _, e := range x.ArrayValue.GetValues() {
+			out = append(out, jsonValue(e))
+		}
+		return out
+	case *commonpb.AnyValue_KvlistValue:
+		out := make(map[string]any, len(x.KvlistValue.GetValues()))
+		for _, kv := range x.KvlistValue.GetValues() {
+			out[kv.GetKey()] = jsonValue(kv.GetValue())
+		}
+		return out
+	}
+	return nil
+}
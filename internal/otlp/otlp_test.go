@@ -0,0 +1,184 @@
+package otlp
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/logproto"
+)
+
+func str(v string) *commonpb.AnyValue {
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}
+}
+
+func kv(k string, v *commonpb.AnyValue) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: v}
+}
+
+func pair(name, value string) logproto.LabelPair {
+	return logproto.LabelPair{Name: name, Value: value}
+}
+
+func TestConvert(t *testing.T) {
+	req := &collogspb.ExportLogsServiceRequest{ResourceLogs: []*logspb.ResourceLogs{{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+			kv("service.name", str("checkout")),
+			kv("k8s.namespace.name", str("shop")),
+			kv("host.name", str("node-1")),
+		}},
+		ScopeLogs: []*logspb.ScopeLogs{{
+			Scope: &commonpb.InstrumentationScope{
+				Name: "otelzap", Version: "1.2",
+				Attributes: []*commonpb.KeyValue{kv("lib", str("zap"))},
+			},
+			LogRecords: []*logspb.LogRecord{
+				{
+					TimeUnixNano:   1700000000000000001,
+					SeverityText:   "INFO",
+					SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_INFO,
+					Body:           str("order placed"),
+					Attributes: []*commonpb.KeyValue{
+						kv("order.id", &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: 42}}),
+						kv("http", &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: []*commonpb.KeyValue{
+							kv("method", str("POST")),
+							kv("status", &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: 201}}),
+						}}}}),
+					},
+					TraceId: []byte{0x5b, 0x8e, 0xff, 0xf7, 0x98, 0x03, 0x81, 0x03, 0xd2, 0x69, 0xb6, 0x33, 0x81, 0x3f, 0xc6, 0x0c},
+					SpanId:  []byte{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x74},
+					Flags:   1,
+				},
+				{
+					ObservedTimeUnixNano: 1700000005000000000,
+					Body:                 str("payment failed"),
+					Attributes:           []*commonpb.KeyValue{kv("level", str("error"))},
+				},
+			},
+		}},
+	}}}
+	data, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := NewMapping([]string{"service.name", "k8s.namespace.name"}, []string{"level"}).Convert(data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scope := []logproto.LabelPair{
+		pair("host_name", "node-1"), pair("lib", "zap"), pair("scope_name", "otelzap"), pair("scope_version", "1.2"),
+	}
+	want := []logproto.Stream{
+		{Labels: `{k8s_namespace_name="shop", service_name="checkout"}`, Entries: []logproto.Entry{{
+			Timestamp: time.Unix(0, 1700000000000000001),
+			Line:      "order placed",
+			StructuredMetadata: append(scope[:len(scope):len(scope)],
+				pair("order_id", "42"),
+				pair("http_method", "POST"),
+				pair("http_status", "201"),
+				pair("severity_text", "INFO"),
+				pair("severity_number", "9"),
+				pair("trace_id", "5b8efff798038103d269b633813fc60c"),
+				pair("span_id", "eee19b7ec3c1b174"),
+				pair("flags", "1"),
+			),
+		}}},
+		{Labels: `{k8s_namespace_name="shop", level="error", service_name="checkout"}`, Entries: []logproto.Entry{{
+			Timestamp: time.Unix(0, 1700000005000000000),
+			Line:      "payment failed",
+			StructuredMetadata: append(scope[:len(scope):len(scope)],
+				pair("observed_timestamp", "1700000005000000000"),
+			),
+		}}},
+	}
+	if !reflect.DeepEqual(b.Streams, want) {
+		t.Errorf("streams\n %+v\nwant\n %+v", b.Streams, want)
+	}
+}
+
+func TestConvertJSON(t *testing.T) {
+	body := `{"resourceLogs":[{
+		"resource":{"attributes":[{"key":"deployment.environment","value":{"stringValue":"prod"}}]},
+		"scopeLogs":[{"logRecords":[{
+			"timeUnixNano":"1700000000000000000",
+			"body":{"stringValue":"hello"},
+			"traceId":"5b8efff798038103d269b633813fc60c",
+			"spanId":"eee19b7ec3c1b174",
+			"unknownField":true
+		}]}]
+	}]}`
+	b, err := NewMapping([]string{"service.name"}, nil).Convert([]byte(body), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []logproto.Stream{{Labels: `{service_name="unknown_service"}`, Entries: []logproto.Entry{{
+		Timestamp: time.Unix(0, 1700000000000000000),
+		Line:      "hello",
+		StructuredMetadata: []logproto.LabelPair{
+			pair("deployment_environment", "prod"),
+			pair("trace_id", "5b8efff798038103d269b633813fc60c"),
+			pair("span_id", "eee19b7ec3c1b174"),
+		},
+	}}}}
+	if !reflect.DeepEqual(b.Streams, want) {
+		t.Errorf("streams\n %+v\nwant\n %+v", b.Streams, want)
+	}
+}
+
+func TestConvertInvalid(t *testing.T) {
+	m := NewMapping(nil, nil)
+	if _, err := m.Convert([]byte{0xff, 0xff}, false); err == nil {
+		t.Error("invalid protobuf: no error")
+	}
+	if _, err := m.Convert([]byte(`{"resourceLogs":`), true); err == nil {
+		t.Error("invalid JSON: no error")
+	}
+}
+
+func TestRecordTime(t *testing.T) {
+	now := time.Unix(1800000000, 0)
+	for _, tc := range []struct {
+		name string
+		lr   *logspb.LogRecord
+		want time.Time
+	}{
+		{"event time", &logspb.LogRecord{TimeUnixNano: 5, ObservedTimeUnixNano: 7}, time.Unix(0, 5)},
+		{"observed time", &logspb.LogRecord{ObservedTimeUnixNano: 7}, time.Unix(0, 7)},
+		{"now", &logspb.LogRecord{}, now},
+	} {
+		if got := recordTime(tc.lr, now); !got.Equal(tc.want) {
+			t.Errorf("%s: %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestValueString(t *testing.T) {
+	for _, tc := range []struct {
+		v    *commonpb.AnyValue
+		want string
+	}{
+		{str("x"), "x"},
+		{&commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: true}}, "true"},
+		{&commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: -3}}, "-3"},
+		{&commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: 1.5}}, "1.5"},
+		{&commonpb.AnyValue{Value: &commonpb.AnyValue_BytesValue{BytesValue: []byte("hi")}}, "aGk="},
+		{&commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: []*commonpb.AnyValue{
+			str("a"), {Value: &commonpb.AnyValue_IntValue{IntValue: 1}},
+		}}}}, `["a",1]`},
+		{&commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: []*commonpb.KeyValue{
+			kv("b", str("2")), kv("a", str("1")),
+		}}}}, `{"a":"1","b":"2"}`},
+		{nil, ""},
+	} {
+		if got := valueString(tc.v); got != tc.want {
+			t.Errorf("valueString(%v) = %q, want %q", tc.v, got, tc.want)
+		}
+	}
+}
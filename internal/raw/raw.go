@@ -0,0 +1,63 @@
+// Package raw converts bodies of plain-text or NDJSON lines into a Loki
+// stream, for scripts and cron jobs that push lines without building a Loki
+// push request.
+package raw
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/logproto"
+	"github.com/DeveloperDarkhan/loki-producer/internal/record"
+)
+
+// Convert turns every non-empty line of body into an entry of one stream
+// with the given labels, stamped now. With ndjson set, lines must be JSON
+// objects; they are kept as they are and stamped with timestampField when
+// it is set and present. Any bad line fails the whole request.
+func Convert(body []byte, labels []logproto.LabelPair, ndjson bool, timestampField string, now time.Time) (*logproto.Batch, error) {
+	b := &logproto.Batch{}
+	stream := logproto.LabelsString(labels)
+	for n := 1; len(body) > 0; n++ {
+		var line []byte
+		line, body, _ = bytes.Cut(body, []byte("\n"))
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		e := logproto.Entry{Timestamp: now, Line: string(line)}
+		if ndjson {
+			ts, err := timestamp(line, timestampField)
+			if err != nil {
+				return nil, fmt.Errorf("line [%d]: %v", n, err)
+			}
+			if !ts.IsZero() {
+				e.Timestamp = ts
+			}
+		}
+		b.Add(stream, e)
+	}
+	return b, nil
+}
+
+// timestamp checks that line is a JSON object and reads its timestamp
+// field; zero when the field is not set.
+func timestamp(line []byte, field string) (time.Time, error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse JSON: %v", err)
+	}
+	if fields == nil {
+		return time.Time{}, errors.New("expected a JSON object")
+	}
+	v, ok := record.Take(fields, field)
+	if !ok {
+		return time.Time{}, nil
+	}
+	return record.ParseTime(v)
+}
@@ -0,0 +1,106 @@
+package raw
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/logproto"
+)
+
+func TestConvert(t *testing.T) {
+	now := time.Unix(1800000000, 0)
+	labels := []logproto.LabelPair{{Name: "job", Value: "cron"}, {Name: "host", Value: "h1"}}
+	const stream = `{host="h1", job="cron"}`
+	for _, tc := range []struct {
+		name    string
+		body    string
+		ndjson  bool
+		tsField string
+		want    []logproto.Entry
+	}{
+		{
+			name: "plain lines",
+			body: "one\r\ntwo\n\n   \nthree",
+			want: []logproto.Entry{
+				{Timestamp: now, Line: "one"},
+				{Timestamp: now, Line: "two"},
+				{Timestamp: now, Line: "three"},
+			},
+		},
+		{
+			name: "plain lines are not parsed",
+			body: `{"ts":"2026-06-15T10:00:00Z"}` + "\nnot json\n",
+			want: []logproto.Entry{
+				{Timestamp: now, Line: `{"ts":"2026-06-15T10:00:00Z"}`},
+				{Timestamp: now, Line: "not json"},
+			},
+		},
+		{
+			name:    "NDJSON timestamps",
+			body:    `{"ts":"2026-06-15T10:00:00Z","msg":"a"}` + "\r\n" + `{"ts":1700000000123,"msg":"b"}` + "\n" + `{"msg":"c"}` + "\n",
+			ndjson:  true,
+			tsField: "ts",
+			want: []logproto.Entry{
+				{Timestamp: time.Date(2026, 6, 15, 10, 0, 0, 0, time.UTC), Line: `{"ts":"2026-06-15T10:00:00Z","msg":"a"}`},
+				{Timestamp: time.UnixMilli(1700000000123), Line: `{"ts":1700000000123,"msg":"b"}`},
+				{Timestamp: now, Line: `{"msg":"c"}`},
+			},
+		},
+		{
+			name:    "NDJSON dotted timestamp field",
+			body:    `{"event":{"created":"2026-06-15T10:00:00Z"}}`,
+			ndjson:  true,
+			tsField: "event.created",
+			want: []logproto.Entry{
+				{Timestamp: time.Date(2026, 6, 15, 10, 0, 0, 0, time.UTC), Line: `{"event":{"created":"2026-06-15T10:00:00Z"}}`},
+			},
+		},
+		{
+			name:   "NDJSON without timestamp field",
+			body:   `{"ts":"2026-06-15T10:00:00Z"}`,
+			ndjson: true,
+			want:   []logproto.Entry{{Timestamp: now, Line: `{"ts":"2026-06-15T10:00:00Z"}`}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := Convert([]byte(tc.body), append([]logproto.LabelPair(nil), labels...), tc.ndjson, tc.tsField, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []logproto.Stream{{Labels: stream, Entries: tc.want}}
+			if !reflect.DeepEqual(b.Streams, want) {
+				t.Errorf("streams\n %+v\nwant\n %+v", b.Streams, want)
+			}
+		})
+	}
+}
+
+func TestConvertEmpty(t *testing.T) {
+	b, err := Convert([]byte("\n\r\n  \n"), []logproto.LabelPair{{Name: "job", Value: "x"}}, true, "ts", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Lines != 0 || len(b.Streams) != 0 {
+		t.Errorf("%d lines in %d streams, want none", b.Lines, len(b.Streams))
+	}
+}
+
+func TestConvertInvalidNDJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name, body, err string
+	}{
+		{"not JSON", "{\"a\":1}\n\nnot json\n", "line [3]: failed to parse JSON"},
+		{"not an object", `{"a":1}` + "\n" + `[1,2]`, "line [2]: failed to parse JSON"},
+		{"null", "null", "line [1]: expected a JSON object"},
+		{"bad timestamp", `{"ts":"soon"}`, "line [1]: failed to parse timestamp [soon]"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Convert([]byte(tc.body), []logproto.LabelPair{{Name: "job", Value: "x"}}, true, "ts", time.Now())
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("error = %v, want it to contain %q", err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+// Package record maps structured log records (decoded JSON or msgpack
+// documents) onto Loki entries: chosen fields become labels, one field the
+// line, one the timestamp and the rest structured metadata.
+package record
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/logproto"
+)
+
+// Mapping says how records become log entries.
+type Mapping struct {
+	MessageField   string   // the log line; the remaining record as JSON when absent
+	TimestampField string   // RFC 3339 string or epoch milliseconds; empty = not looked up
+	LabelFields    []string // promoted to labels; dotted names reach into objects
+}
+
+// Map maps one record onto labels (added to the given ones) and an entry
+// stamped now unless the record carries a timestamp. It removes the fields
+// it uses from the record.
+func (m *Mapping) Map(fields map[string]any, labels []logproto.LabelPair, now time.Time) (string, logproto.Entry, error) {
+	for _, f := range m.LabelFields {
+		if v, ok := Take(fields, f); ok {
+			if s, ok := scalarString(v); ok {
+				labels = append(labels, logproto.LabelPair{Name: logproto.SanitizeLabelName(f), Value: s})
+			}
+		}
+	}
+
+	e := logproto.Entry{Timestamp: now}
+	if v, ok := Take(fields, m.TimestampField); ok {
+		ts, err := ParseTime(v)
+		if err != nil {
+			return "", logproto.Entry{}, err
+		}
+		e.Timestamp = ts
+	}
+	v, ok := Take(fields, m.MessageField)
+	if !ok {
+		e.Line = jsonString(fields)
+		return logproto.LabelsString(labels), e, nil
+	}
+	if s, ok := v.(string); ok {
+		e.Line = s
+	} else if b, ok := v.([]byte); ok {
+		e.Line = string(b)
+	} else {
+		e.Line = jsonString(v)
+	}
+	for _, k := range sortedKeys(fields) {
+		e.StructuredMetadata = flatten(e.StructuredMetadata, k, fields[k])
+	}
+	return logproto.LabelsString(labels), e, nil
+}
+
+// Take removes a field from the record and returns it. A dotted name is
+// looked up as is first, then as a path through nested objects.
+func Take(fields map[string]any, name string) (any, bool) {
+	if name == "" {
+		return nil, false
+	}
+	if v, ok := fields[name]; ok {
+		delete(fields, name)
+		return v, v != nil
+	}
+	head, rest, ok := strings.Cut(name, ".")
+	if !ok {
+		return nil, false
+	}
+	obj, ok := fields[head].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	v, ok := Take(obj, rest)
+	if len(obj) == 0 {
+		delete(fields, head)
+	}
+	return v, ok
+}
+
+// ParseTime reads a timestamp field: an RFC 3339 string or epoch
+// milliseconds.
+func ParseTime(v any) (time.Time, error) {
+	switch x := v.(type) {
+	case string:
+		ts, err := time.Parse(time.RFC3339Nano, x)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to parse timestamp [%s]", x)
+		}
+		return ts, nil
+	case json.Number:
+		ms, err := x.Int64()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to parse timestamp [%s]", x)
+		}
+		return time.UnixMilli(ms), nil
+	case int64:
+		return time.UnixMilli(x), nil
+	case uint64:
+		return time.UnixMilli(int64(x)), nil
+	}
+	return time.Time{}, errors.New("failed to parse timestamp, expected a string or epoch millis")
+}
+
+// flatten appends a field as structured metadata; nested objects become one
+// entry per leaf, keys joined with "_". Arrays are kept as JSON.
+func flatten(dst []logproto.LabelPair, key string, v any) []logproto.LabelPair {
+	switch x := v.(type) {
+	case nil:
+		return dst
+	case map[string]any:
+		for _, k := range sortedKeys(x) {
+			dst = flatten(dst, key+"_"+k, x[k])
+		}
+		return dst
+	}
+	s, ok := scalarString(v)
+	if !ok {
+		s = jsonString(v)
+	}
+	return append(dst, logproto.LabelPair{Name: logproto.SanitizeLabelName(key), Value: s})
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func scalarString(v any) (string, bool) {
+	switch x := v.(type) {
+	case string:
+		return x, true
+	case []byte:
+		return string(x), true
+	case json.Number:
+		return x.String(), true
+	case bool:
+		return strconv.FormatBool(x), true
+	case int64:
+		return strconv.FormatInt(x, 10), true
+	case uint64:
+		return strconv.FormatUint(x, 10), true
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+func jsonString(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,163 @@
+package record
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/logproto"
+)
+
+// decode decodes a JSON document the way the endpoints do, numbers as
+// json.Number.
+func decode(t *testing.T, doc string) map[string]any {
+	t.Helper()
+	var fields map[string]any
+	dec := json.NewDecoder(strings.NewReader(doc))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		t.Fatal(err)
+	}
+	return fields
+}
+
+func TestTake(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		doc    string
+		field  string
+		want   any
+		ok     bool
+		remain string
+	}{
+		{"top level", `{"a":"x","b":"y"}`, "a", "x", true, `{"b":"y"}`},
+		{"missing", `{"a":"x"}`, "b", nil, false, `{"a":"x"}`},
+		{"empty name", `{"a":"x"}`, "", nil, false, `{"a":"x"}`},
+		{"null value is removed", `{"a":null,"b":1}`, "a", nil, false, `{"b":1}`},
+		{"dotted path", `{"k8s":{"pod":"p1","ns":"n1"}}`, "k8s.pod", "p1", true, `{"k8s":{"ns":"n1"}}`},
+		{"dotted path empties its parent", `{"k8s":{"pod":"p1"},"b":1}`, "k8s.pod", "p1", true, `{"b":1}`},
+		{"deep path", `{"a":{"b":{"c":"x"}}}`, "a.b.c", "x", true, `{}`},
+		{"literal dotted key first", `{"k8s.pod":"flat","k8s":{"pod":"nested"}}`, "k8s.pod", "flat", true, `{"k8s":{"pod":"nested"}}`},
+		{"path through a scalar", `{"a":"x"}`, "a.b", nil, false, `{"a":"x"}`},
+		{"missing leaf", `{"a":{"c":1}}`, "a.b", nil, false, `{"a":{"c":1}}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fields := decode(t, tc.doc)
+			v, ok := Take(fields, tc.field)
+			if ok != tc.ok || !reflect.DeepEqual(v, tc.want) {
+				t.Errorf("Take = %v, %v; want %v, %v", v, ok, tc.want, tc.ok)
+			}
+			if want := decode(t, tc.remain); !reflect.DeepEqual(fields, want) {
+				t.Errorf("left %v, want %v", fields, want)
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	for _, tc := range []struct {
+		v    any
+		want time.Time
+		err  bool
+	}{
+		{"2026-06-15T10:00:00.5Z", time.Date(2026, 6, 15, 10, 0, 0, 5e8, time.UTC), false},
+		{"2026-06-15T12:00:00+02:00", time.Date(2026, 6, 15, 10, 0, 0, 0, time.UTC), false},
+		{json.Number("1700000000123"), time.UnixMilli(1700000000123), false},
+		{int64(1700000000123), time.UnixMilli(1700000000123), false},
+		{uint64(1700000000123), time.UnixMilli(1700000000123), false},
+		{"yesterday", time.Time{}, true},
+		{json.Number("1.5"), time.Time{}, true},
+		{true, time.Time{}, true},
+	} {
+		got, err := ParseTime(tc.v)
+		if (err != nil) != tc.err || !got.Equal(tc.want) {
+			t.Errorf("ParseTime(%#v) = %v, %v", tc.v, got, err)
+		}
+	}
+}
+
+func TestMap(t *testing.T) {
+	now := time.Unix(1800000000, 0)
+	mapping := &Mapping{MessageField: "message", TimestampField: "@timestamp", LabelFields: []string{"service", "kubernetes.namespace", "tags"}}
+	for _, tc := range []struct {
+		name    string
+		mapping *Mapping
+		doc     string
+		labels  string
+		entry   logproto.Entry
+		err     bool
+	}{
+		{
+			name:    "labels, timestamp, line and metadata",
+			mapping: mapping,
+			doc:     `{"@timestamp":"2026-06-15T10:00:00Z","message":"hi","service":"api","kubernetes":{"namespace":"shop","pod":"p1"},"level":"info","count":3,"ok":true,"list":[1,2],"nothing":null}`,
+			labels:  `{index="logs", kubernetes_namespace="shop", service="api"}`,
+			entry: logproto.Entry{
+				Timestamp: time.Date(2026, 6, 15, 10, 0, 0, 0, time.UTC),
+				Line:      "hi",
+				StructuredMetadata: []logproto.LabelPair{
+					{Name: "count", Value: "3"},
+					{Name: "kubernetes_pod", Value: "p1"},
+					{Name: "level", Value: "info"},
+					{Name: "list", Value: "[1,2]"},
+					{Name: "ok", Value: "true"},
+				},
+			},
+		},
+		{
+			name:    "non-scalar label field is dropped",
+			mapping: mapping,
+			doc:     `{"message":"hi","tags":["a","b"]}`,
+			labels:  `{index="logs"}`,
+			entry:   logproto.Entry{Timestamp: now, Line: "hi"},
+		},
+		{
+			name:    "epoch millis and object message",
+			mapping: mapping,
+			doc:     `{"@timestamp":1700000000123,"message":{"b":1,"a":"x"}}`,
+			labels:  `{index="logs"}`,
+			entry:   logproto.Entry{Timestamp: time.UnixMilli(1700000000123), Line: `{"a":"x","b":1}`},
+		},
+		{
+			name:    "no message field keeps the rest as the line",
+			mapping: mapping,
+			doc:     `{"service":"api","level":"warn","extra":{"x":1}}`,
+			labels:  `{index="logs", service="api"}`,
+			entry:   logproto.Entry{Timestamp: now, Line: `{"extra":{"x":1},"level":"warn"}`},
+		},
+		{
+			name:    "empty mapping",
+			mapping: &Mapping{},
+			doc:     `{"message":"hi"}`,
+			labels:  `{index="logs"}`,
+			entry:   logproto.Entry{Timestamp: now, Line: `{"message":"hi"}`},
+		},
+		{
+			name:    "bad timestamp",
+			mapping: mapping,
+			doc:     `{"@timestamp":"soon","message":"hi"}`,
+			err:     true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			labels, e, err := tc.mapping.Map(decode(t, tc.doc), []logproto.LabelPair{{Name: "index", Value: "logs"}}, now)
+			if tc.err {
+				if err == nil {
+					t.Fatal("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if labels != tc.labels {
+				t.Errorf("labels = %s, want %s", labels, tc.labels)
+			}
+			if !reflect.DeepEqual(e, tc.entry) {
+				t.Errorf("entry\n %+v\nwant\n %+v", e, tc.entry)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	mrand "math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/config"
+)
+
+// accessLogger writes one line per ingest request, separate from the
+// application log.
+type accessLogger struct {
+	out          io.WriteCloser
+	logger       *slog.Logger
+	fields       map[string]bool
+	successRatio float64
+	writing      sync.WaitGroup // lines being written, see logAccess
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func newAccessLogger(cfg *config.Config) *accessLogger {
+	if !cfg.AccessLogEnabled {
+		return nil
+	}
+	var out io.WriteCloser
+	switch cfg.AccessLogOutput {
+	case "", "stdout":
+		out = nopCloser{os.Stdout}
+	case "stderr":
+		out = nopCloser{os.Stderr}
+	default:
+		out = &lumberjack.Logger{
+			Filename:   cfg.AccessLogOutput,
+			MaxSize:    cfg.AccessLogMaxSizeMB,
+			MaxBackups: cfg.AccessLogMaxBackups,
+			MaxAge:     cfg.AccessLogMaxAgeDays,
+			Compress:   cfg.AccessLogCompress,
+		}
+	}
+
+	opts := &slog.HandlerOptions{
+		// Access lines carry no level/msg, only the timestamp and fields
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && (a.Key == slog.LevelKey || a.Key == slog.MessageKey) {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}
+	var h slog.Handler
+	switch cfg.AccessLogFormat {
+	case "text":
+		h = slog.NewTextHandler(out, opts)
+	default:
+		h = slog.NewJSONHandler(out, opts)
+	}
+
+	fields := make(map[string]bool)
+	names := cfg.AccessLogFields
+	if len(names) == 0 {
+		names = config.AccessLogFields
+	}
+	for _, f := range names {
+		fields[f] = true
+	}
+	return &accessLogger{
+		out:          out,
+		logger:       slog.New(h),
+		fields:       fields,
+		successRatio: cfg.AccessLogSuccessSampleRatio,
+	}
+}
+
+// accessLogChanged reports whether a reload must rebuild the access logger.
+func accessLogChanged(a, b *config.Config) bool {
+	return a.AccessLogEnabled != b.AccessLogEnabled ||
+		a.AccessLogOutput != b.AccessLogOutput ||
+		a.AccessLogFormat != b.AccessLogFormat ||
+		strings.Join(a.AccessLogFields, ",") != strings.Join(b.AccessLogFields, ",") ||
+		a.AccessLogSuccessSampleRatio != b.AccessLogSuccessSampleRatio ||
+		a.AccessLogMaxSizeMB != b.AccessLogMaxSizeMB ||
+		a.AccessLogMaxBackups != b.AccessLogMaxBackups ||
+		a.AccessLogMaxAgeDays != b.AccessLogMaxAgeDays ||
+		a.AccessLogCompress != b.AccessLogCompress
+}
+
+// Close closes the output once lines being written are done. lumberjack
+// reopens its file on a write after Close, so closing under a writer would
+// leak the handle.
+func (a *accessLogger) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.writing.Wait()
+	return a.out.Close()
+}
+
+func (a *accessLogger) log(endpoint, clientIP, userAgent string, rr *resultRecorder, dur time.Duration) {
+	if rr.result == "success" && a.successRatio < 1 && mrand.Float64() >= a.successRatio {
+		return
+	}
+	status := rr.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	attrs := make([]slog.Attr, 0, len(config.AccessLogFields))
+	add := func(name string, v slog.Value) {
+		if a.fields[name] {
+			attrs = append(attrs, slog.Attr{Key: name, Value: v})
+		}
+	}
+	add("tenant", slog.StringValue(rr.tenant))
+	add("endpoint", slog.StringValue(endpoint))
+	add("status", slog.IntValue(status))
+	add("result", slog.StringValue(rr.result))
+	add("bytes", slog.IntValue(rr.bytes))
+	add("duration_ms", slog.Float64Value(float64(dur.Microseconds())/1000))
+	add("kafka_ms", slog.Float64Value(rr.kafkaMs))
+	add("client_ip", slog.StringValue(clientIP))
+	add("user_agent", slog.StringValue(userAgent))
+	add("request_id", slog.StringValue(rr.requestID))
+	a.logger.LogAttrs(context.Background(), slog.LevelInfo, "", attrs...)
+}
+
+// accessLog is the outermost middleware of ingest endpoints: it assigns a
+// request ID, lets wrapRequest fill in the recorder and writes the line.
+func (s *Server) accessLog(endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		reqID := r.Header.Get("X-Request-ID")
+		if reqID == "" {
+			reqID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", reqID)
+		rr := &resultRecorder{ResponseWriter: w, requestID: reqID}
+		next(rr, r)
+		s.logAccess(endpoint, clientIP(r), r.UserAgent(), rr, time.Since(start))
+	}
+}
+
+// logAccess writes the access line of a request, if the access log is
+// enabled. The logger is held while writing, so one replaced by reload is
+// closed after its last line.
+func (s *Server) logAccess(endpoint, clientIP, userAgent string, rr *resultRecorder, dur time.Duration) {
+	s.mu.RLock()
+	al := s.accessLogger
+	if al != nil {
+		// Add under the read lock: reload swaps the logger under the write
+		// lock, so nobody joins a logger that is being closed
+		al.writing.Add(1)
+	}
+	s.mu.RUnlock()
+	if al == nil {
+		return
+	}
+	defer al.writing.Done()
+	al.log(endpoint, clientIP, userAgent, rr, dur)
+}
+
+func newRequestID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+func clientIP(r *http.Request) string {
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		first, _, _ := strings.Cut(xff, ",")
+		return strings.TrimSpace(first)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
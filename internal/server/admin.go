@@ -0,0 +1,83 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// adminMux holds operational routes: metrics, config inspection, reload,
+// pprof and runtime stats. It is served on admin_port when configured,
+// otherwise mounted on the ingest listener (legacy single-port mode).
+func (s *Server) adminMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ready", s.readyHandler)
+	mux.Handle("/metrics", s.adminAuth(promhttp.InstrumentMetricHandler(s.registry, promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{}))))
+	mux.Handle("/configz", s.adminAuth(http.HandlerFunc(s.configzHandler)))
+	mux.Handle("/configz/history", s.adminAuth(http.HandlerFunc(s.configHistoryHandler)))
+	mux.Handle("/reload", s.adminAuth(http.HandlerFunc(s.reloadHandler)))
+	mux.Handle("/usage", s.adminAuth(http.HandlerFunc(s.usageHandler)))
+	mux.Handle("/debug/runtime", s.adminAuth(http.HandlerFunc(s.runtimeHandler)))
+
+	mux.Handle("/debug/pprof/", s.adminAuth(http.HandlerFunc(pprof.Index)))
+	mux.Handle("/debug/pprof/cmdline", s.adminAuth(http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle("/debug/pprof/profile", s.adminAuth(http.HandlerFunc(pprof.Profile)))
+	mux.Handle("/debug/pprof/symbol", s.adminAuth(http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("/debug/pprof/trace", s.adminAuth(http.HandlerFunc(pprof.Trace)))
+	return mux
+}
+
+// adminAuth requires "Authorization: Bearer <admin_token>" when a token is
+// configured. The token is read per request so a reload can rotate it.
+func (s *Server) adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		token := s.cfg.AdminToken
+		s.mu.RUnlock()
+		if token == "" {
+			token = os.Getenv("ADMIN_TOKEN")
+		}
+		if token != "" {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) runtimeHandler(w http.ResponseWriter, _ *http.Request) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	stats := map[string]any{
+		"go_version":       runtime.Version(),
+		"uptime_seconds":   time.Since(s.startedAt).Seconds(),
+		"goroutines":       runtime.NumGoroutine(),
+		"gomaxprocs":       runtime.GOMAXPROCS(0),
+		"num_cpu":          runtime.NumCPU(),
+		"heap_alloc_bytes": ms.HeapAlloc,
+		"heap_inuse_bytes": ms.HeapInuse,
+		"heap_objects":     ms.HeapObjects,
+		"sys_bytes":        ms.Sys,
+		"total_alloc":      ms.TotalAlloc,
+		"mallocs":          ms.Mallocs,
+		"frees":            ms.Frees,
+		"num_gc":           ms.NumGC,
+		"gc_pause_total":   time.Duration(ms.PauseTotalNs).String(),
+		"last_gc":          time.Unix(0, int64(ms.LastGC)).UTC().Format(time.RFC3339Nano),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(stats)
+}
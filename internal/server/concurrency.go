@@ -0,0 +1,139 @@
+package server
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/config"
+)
+
+// Shed reasons, used as the result of rejected pushes and the reason label.
+const (
+	shedOverloaded       = "overloaded"        // global limit reached, 503
+	shedTenantOverloaded = "tenant_overloaded" // tenant above its fair share, 429
+)
+
+// adaptiveLimiter bounds concurrent pushes with AIMD on Kafka write latency:
+// every write faster than the latency target that took the last free slot
+// raises the limit by 1/limit (about +1 per limit such writes), so the limit
+// only grows while it is actually reached; a slower or failed write multiplies it by the
+// backoff factor, at most once per target interval so one slow batch is not
+// punished once per request in it. Requests over the limit are shed early
+// instead of piling up until kafka_write_timeout.
+//
+// Fairness: once half of the limit is in use, a tenant may hold at most its
+// fair share (limit / active tenants), so one heavy tenant cannot take all
+// slots while Kafka is slow.
+type adaptiveLimiter struct {
+	mu           sync.Mutex
+	limit        float64
+	min, max     float64
+	target       time.Duration
+	backoff      float64
+	fairness     bool
+	inflight     int
+	tenants      map[string]int // in-flight per tenant, only non-zero entries
+	lastDecrease time.Time
+}
+
+func newAdaptiveLimiter(cfg *config.Config) *adaptiveLimiter {
+	l := &adaptiveLimiter{
+		limit:   float64(cfg.ConcurrencyLimitInitial),
+		tenants: make(map[string]int),
+	}
+	l.configure(cfg)
+	return l
+}
+
+// configure applies reloaded settings and keeps the current limit and
+// in-flight accounting.
+func (l *adaptiveLimiter) configure(cfg *config.Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.min = float64(cfg.ConcurrencyLimitMin)
+	l.max = float64(cfg.ConcurrencyLimitMax)
+	l.target = cfg.ConcurrencyLimitLatencyTarget
+	l.backoff = cfg.ConcurrencyLimitBackoff
+	l.fairness = cfg.ConcurrencyLimitTenantFairness
+	l.limit = math.Min(math.Max(l.limit, l.min), l.max)
+}
+
+// acquire takes a slot for tenant; the reason is set when it is refused.
+// saturated reports that the slot was the last free one, which lets the
+// release of this request raise the limit.
+func (l *adaptiveLimiter) acquire(tenant string) (ok, saturated bool, reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit := int(l.limit)
+	if l.inflight >= limit {
+		return false, false, shedOverloaded
+	}
+	if l.fairness && l.inflight >= limit/2 {
+		active := len(l.tenants)
+		if l.tenants[tenant] == 0 {
+			active++
+		}
+		fair := int(math.Ceil(float64(limit) / float64(active)))
+		if l.tenants[tenant] >= fair {
+			return false, false, shedTenantOverloaded
+		}
+	}
+	l.inflight++
+	l.tenants[tenant]++
+	return true, l.inflight >= limit, ""
+}
+
+// release frees the slot of tenant. With sampled set, latency and failed
+// (a Kafka write error) adjust the limit; a fast write only raises it when
+// the slot was taken saturated.
+func (l *adaptiveLimiter) release(tenant string, saturated, sampled bool, latency time.Duration, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+	if l.tenants[tenant]--; l.tenants[tenant] <= 0 {
+		delete(l.tenants, tenant)
+	}
+	if !sampled {
+		return
+	}
+	if failed || latency > l.target {
+		if now := time.Now(); now.Sub(l.lastDecrease) >= l.target {
+			l.limit = math.Max(l.min, l.limit*l.backoff)
+			l.lastDecrease = now
+		}
+		return
+	}
+	if saturated {
+		l.limit = math.Min(l.max, l.limit+1/l.limit)
+	}
+}
+
+func (l *adaptiveLimiter) state() (limit, inflight int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit), l.inflight
+}
+
+// buildConcurrencyLimiterLocked applies concurrency_limit_* from s.cfg. An
+// existing limiter is reconfigured in place so its limit and in-flight
+// accounting survive a reload.
+func (s *Server) buildConcurrencyLimiterLocked() {
+	if !s.cfg.ConcurrencyLimitEnabled {
+		s.concurrency = nil
+		s.metrics.ConcurrencyLimit.Set(0)
+		return
+	}
+	if s.concurrency == nil {
+		s.concurrency = newAdaptiveLimiter(s.cfg)
+	} else {
+		s.concurrency.configure(s.cfg)
+	}
+	s.setConcurrencyGauges(s.concurrency)
+}
+
+func (s *Server) setConcurrencyGauges(l *adaptiveLimiter) {
+	limit, inflight := l.state()
+	s.metrics.ConcurrencyLimit.Set(float64(limit))
+	s.metrics.InflightRequests.Set(float64(inflight))
+}
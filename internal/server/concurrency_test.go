@@ -0,0 +1,163 @@
+package server
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/config"
+)
+
+func testLimiter(initial int, fairness bool) *adaptiveLimiter {
+	return newAdaptiveLimiter(&config.Config{
+		ConcurrencyLimitInitial:        initial,
+		ConcurrencyLimitMin:            2,
+		ConcurrencyLimitMax:            12,
+		ConcurrencyLimitLatencyTarget:  100 * time.Millisecond,
+		ConcurrencyLimitBackoff:        0.5,
+		ConcurrencyLimitTenantFairness: fairness,
+	})
+}
+
+func TestAdaptiveLimiterAcquire(t *testing.T) {
+	l := testLimiter(3, false)
+	for i, want := range []bool{false, false, true} { // saturated
+		ok, saturated, reason := l.acquire("a")
+		if !ok || saturated != want || reason != "" {
+			t.Fatalf("acquire %d = %v, %v, %q; want ok, saturated %v", i, ok, saturated, reason, want)
+		}
+	}
+	if ok, _, reason := l.acquire("b"); ok || reason != shedOverloaded {
+		t.Fatalf("acquire over the limit = %v, %q; want %q", ok, reason, shedOverloaded)
+	}
+	l.release("a", false, false, 0, false)
+	if ok, _, _ := l.acquire("b"); !ok {
+		t.Fatal("acquire after a release failed")
+	}
+	if limit, inflight := l.state(); limit != 3 || inflight != 3 {
+		t.Errorf("state = %d, %d; want 3, 3", limit, inflight)
+	}
+	for _, tenant := range []string{"a", "a", "b"} {
+		l.release(tenant, false, false, 0, false)
+	}
+	if _, inflight := l.state(); inflight != 0 || len(l.tenants) != 0 {
+		t.Errorf("after releasing all: inflight %d, tenants %v", inflight, l.tenants)
+	}
+}
+
+func TestAdaptiveLimiterAdjust(t *testing.T) {
+	const target = 100 * time.Millisecond
+	for _, tc := range []struct {
+		name      string
+		initial   float64
+		saturated bool
+		sampled   bool
+		latency   time.Duration
+		failed    bool
+		want      float64
+	}{
+		{name: "fast write at the limit", initial: 4, saturated: true, sampled: true, latency: target / 2, want: 4.25},
+		{name: "fast write below the limit", initial: 4, sampled: true, latency: target / 2, want: 4},
+		{name: "not sampled", initial: 4, saturated: true, want: 4},
+		{name: "increase capped at max", initial: 12, saturated: true, sampled: true, latency: target / 2, want: 12},
+		{name: "slow write", initial: 8, sampled: true, latency: 2 * target, want: 4},
+		{name: "failed write", initial: 8, saturated: true, sampled: true, latency: target / 2, failed: true, want: 4},
+		{name: "decrease capped at min", initial: 3, sampled: true, latency: 2 * target, want: 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := testLimiter(int(tc.initial), false)
+			l.acquire("a")
+			l.release("a", tc.saturated, tc.sampled, tc.latency, tc.failed)
+			if math.Abs(l.limit-tc.want) > 1e-9 {
+				t.Errorf("limit = %v, want %v", l.limit, tc.want)
+			}
+		})
+	}
+}
+
+func TestAdaptiveLimiterDecreaseOncePerTarget(t *testing.T) {
+	l := testLimiter(12, false)
+	for i := 0; i < 3; i++ {
+		l.acquire("a")
+		l.release("a", false, true, time.Second, false)
+	}
+	if l.limit != 6 {
+		t.Errorf("limit after a burst of slow writes = %v, want one backoff to 6", l.limit)
+	}
+	l.lastDecrease = time.Now().Add(-time.Second)
+	l.acquire("a")
+	l.release("a", false, true, time.Second, false)
+	if l.limit != 3 {
+		t.Errorf("limit after the target interval = %v, want 3", l.limit)
+	}
+}
+
+func TestAdaptiveLimiterGrowsOnlyWhenReached(t *testing.T) {
+	l := testLimiter(4, false)
+	// One request at a time never reaches the limit
+	for i := 0; i < 100; i++ {
+		_, saturated, _ := l.acquire("a")
+		l.release("a", saturated, true, time.Millisecond, false)
+	}
+	if l.limit != 4 {
+		t.Errorf("limit = %v, want it to stay at 4", l.limit)
+	}
+	// Under sustained load every freed slot is taken again at once, so
+	// each request takes the last one and raises the limit by 1/limit
+	var held []bool
+	for {
+		ok, saturated, _ := l.acquire("a")
+		if !ok {
+			break
+		}
+		held = append(held, saturated)
+	}
+	for i := 0; i < 100; i++ {
+		l.release("a", held[0], true, time.Millisecond, false)
+		held = held[1:]
+		for {
+			ok, saturated, _ := l.acquire("a")
+			if !ok {
+				break
+			}
+			held = append(held, saturated)
+		}
+	}
+	if limit, _ := l.state(); limit < 8 {
+		t.Errorf("limit = %v, want about +1 per limit releases", l.limit)
+	}
+}
+
+func TestAdaptiveLimiterFairness(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		fairness bool
+		held     map[string]int
+		tenant   string
+		want     string // refusal reason, empty when admitted
+	}{
+		{name: "below half the limit", fairness: true, held: map[string]int{"a": 4}, tenant: "a"},
+		{name: "within the fair share", fairness: true, held: map[string]int{"a": 4, "b": 1}, tenant: "a"},
+		{name: "at the fair share", fairness: true, held: map[string]int{"a": 5, "b": 1}, tenant: "a", want: shedTenantOverloaded},
+		{name: "other tenant admitted", fairness: true, held: map[string]int{"a": 5, "b": 1}, tenant: "b"},
+		{name: "new tenant admitted", fairness: true, held: map[string]int{"a": 5, "b": 1}, tenant: "c"},
+		{name: "share of one tenant is the limit", fairness: true, held: map[string]int{"a": 9}, tenant: "a"},
+		{name: "fairness off", held: map[string]int{"a": 8, "b": 1}, tenant: "a"},
+		{name: "limit reached", fairness: true, held: map[string]int{"a": 5, "b": 5}, tenant: "c", want: shedOverloaded},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := testLimiter(10, tc.fairness)
+			for tenant, n := range tc.held {
+				for i := 0; i < n; i++ {
+					if ok, _, reason := l.acquire(tenant); !ok {
+						t.Fatalf("setup: %s refused: %s", tenant, reason)
+					}
+				}
+			}
+			ok, _, reason := l.acquire(tc.tenant)
+			if reason != tc.want || ok != (tc.want == "") {
+				t.Errorf("acquire(%s) = %v, %q; want %q", tc.tenant, ok, reason, tc.want)
+			}
+		})
+	}
+}
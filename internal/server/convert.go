@@ -0,0 +1,130 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/snappy"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/bufpool"
+	"github.com/DeveloperDarkhan/loki-producer/internal/config"
+	"github.com/DeveloperDarkhan/loki-producer/internal/logproto"
+)
+
+// Endpoints that accept other log formats convert the body into a Loki push
+// request before the Kafka write, so consumers of the topic only ever see
+// Loki pushes.
+
+// convertedContentType is the record Content-Type of converted pushes.
+const convertedContentType = "application/x-protobuf"
+
+// recordOverhead is left in a Kafka record for its key and headers.
+const recordOverhead = 1 << 10
+
+var errDecodedTooLarge = errors.New("decoded body exceeds max_decoded_body_bytes")
+
+// recordLimit is the largest converted payload written as one Kafka record:
+// kafka-go refuses records over kafka_batch_bytes, and no push is larger
+// than max_body_bytes.
+func recordLimit(cfg *config.Config) int {
+	return int(min(cfg.MaxBodyBytes, int64(cfg.KafkaBatchBytes))) - recordOverhead
+}
+
+// batchLimit is the largest encoded PushRequest whose snappy encoding still
+// fits recordLimit; transports that batch entries themselves split there.
+func batchLimit(cfg *config.Config) int {
+	return (recordLimit(cfg) - 32) * 6 / 7 // snappy.MaxEncodedLen is 32 + n + n/6
+}
+
+// conversion is a body converted into a Loki push request.
+type conversion struct {
+	payload *bufpool.Buffer // snappy-compressed PushRequest, nil when empty
+	lines   int
+	streams int
+}
+
+// convertFunc converts a request body; it runs inside push after the body
+// was read within the limits and its Content-Encoding undone.
+type convertFunc func(data []byte) (conversion, error)
+
+// encodePush encodes b as a Loki client pushes it: snappy-compressed
+// protobuf.
+func encodePush(b *logproto.Batch) conversion {
+	if b.Lines == 0 {
+		return conversion{}
+	}
+	raw := bufpool.Get(logproto.Size(b.Streams))
+	raw.B = logproto.AppendPushRequest(raw.B, b.Streams)
+	out := bufpool.Get(snappy.MaxEncodedLen(len(raw.B)))
+	out.B = snappy.Encode(out.B[:cap(out.B)], raw.B)
+	bufpool.Put(raw)
+	return conversion{payload: out, lines: b.Lines, streams: len(b.Streams)}
+}
+
+// decodedBody is a request body with its Content-Encoding undone.
+type decodedBody struct {
+	data     []byte
+	buf      *bufpool.Buffer // holds data when the body was encoded
+	budget   *memoryBudget
+	reserved int64
+}
+
+// release returns the buffer and its memory budget.
+func (d *decodedBody) release() {
+	if d.buf != nil {
+		bufpool.Put(d.buf)
+		d.buf = nil
+	}
+	if d.budget != nil {
+		d.budget.release(d.reserved)
+		d.reserved = 0
+	}
+}
+
+// decodeBody undoes Content-Encoding gzip or deflate, reading at most max
+// bytes. The decoded bytes are reserved in budget (when not nil) as they
+// are read, next to the held bytes the request reserved already;
+// errMemoryBudget means it ran out, errOverBudget that the request can
+// never fit.
+func decodeBody(body []byte, encoding string, max int64, budget *memoryBudget, held int64) (*decodedBody, error) {
+	var r io.Reader
+	var err error
+	switch encoding {
+	case "", "identity":
+		return &decodedBody{data: body}, nil
+	case "gzip":
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		r, err = zlib.NewReader(bytes.NewReader(body))
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r = io.LimitReader(r, max+1)
+	d := &decodedBody{budget: budget}
+	var br *budgetReader
+	if budget != nil {
+		br = &budgetReader{ReadCloser: io.NopCloser(r), b: budget, chunked: true, held: held}
+		r = br
+	}
+	buf, err := bufpool.ReadAll(r, int(min(4*int64(len(body)), max)))
+	if br != nil {
+		d.reserved = br.reserved
+	}
+	if err != nil {
+		d.release()
+		return nil, err
+	}
+	d.buf, d.data = buf, buf.B
+	if int64(len(buf.B)) > max {
+		d.release()
+		return nil, errDecodedTooLarge
+	}
+	return d, nil
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/esbulk"
+	"github.com/DeveloperDarkhan/loki-producer/internal/record"
+)
+
+// Endpoint labels of the Elasticsearch bulk API; the index is not part of
+// the label.
+const (
+	esBulkEndpoint      = "/_bulk"
+	esIndexBulkEndpoint = "/{index}/_bulk"
+)
+
+// esVersion is what GET / reports. Beats check it before shipping and stop
+// when the cluster looks older than themselves.
+const esVersion = "8.11.0"
+
+// esRoot serves the Elasticsearch routes that cannot be ServeMux patterns
+// next to the admin "/debug/" prefix: GET / and /{index}/_bulk.
+func (s *Server) esRoot(indexBulk http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			s.handleESInfo(w, r)
+			return
+		}
+		if _, ok := bulkIndex(r.URL.Path); ok {
+			indexBulk(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	}
+}
+
+// bulkIndex extracts the index of /{index}/_bulk.
+func bulkIndex(path string) (string, bool) {
+	index, ok := strings.CutSuffix(strings.TrimPrefix(path, "/"), "/_bulk")
+	if !ok || index == "" || strings.ContainsRune(index, '/') || strings.HasPrefix(index, "_") {
+		return "", false
+	}
+	return index, true
+}
+
+func (s *Server) handleESInfo(w http.ResponseWriter, _ *http.Request) {
+	writeESJSON(w, http.StatusOK, map[string]any{
+		"name":         "loki-producer",
+		"cluster_name": "loki-producer",
+		"version": map[string]any{
+			"number":                              esVersion,
+			"build_flavor":                        "default",
+			"minimum_wire_compatibility_version":  "7.17.0",
+			"minimum_index_compatibility_version": "7.0.0",
+		},
+		"tagline": "You Know, for Search",
+	})
+}
+
+// handleESBulk is the Elasticsearch bulk API (POST /_bulk, /{index}/_bulk).
+// Documents are converted into a Loki push and written like any other
+// push; the response reports every action as Elasticsearch would.
+func (s *Server) handleESBulk(w http.ResponseWriter, r *http.Request) {
+	rr, ok := w.(*resultRecorder)
+	if !ok {
+		rr = &resultRecorder{ResponseWriter: w}
+	}
+	start := time.Now()
+	endpoint := esBulkEndpoint
+	index, ok := bulkIndex(r.URL.Path)
+	if ok {
+		endpoint = esIndexBulkEndpoint
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		writeESError(w, http.StatusMethodNotAllowed, "illegal_argument_exception", "bulk requires POST or PUT")
+		return
+	}
+
+	s.mu.RLock()
+	cfg := s.cfg
+	s.mu.RUnlock()
+	mapping := &record.Mapping{
+		MessageField:   cfg.ESMessageField,
+		TimestampField: cfg.ESTimestampField,
+		LabelFields:    cfg.ESLabelFields,
+	}
+
+	// Shippers that cannot set headers can name the tenant as basic auth
+	// user
+	tenant := r.Header.Get("X-Scope-OrgID")
+	if user, _, ok := r.BasicAuth(); ok && tenant == "" {
+		tenant = user
+	}
+
+	var items []esbulk.Item
+	reply := s.push(r.Context(), pushInput{
+		endpoint:        endpoint,
+		tenant:          tenant,
+		contentType:     r.Header.Get("Content-Type"),
+		contentEncoding: r.Header.Get("Content-Encoding"),
+		contentLength:   r.ContentLength,
+		body:            r.Body,
+		w:               w,
+		convert: func(data []byte) (conversion, error) {
+			batch, its, err := esbulk.Convert(data, index, mapping, time.Now())
+			if err != nil {
+				return conversion{}, err
+			}
+			items = its
+			return encodePush(batch), nil
+		},
+	}, rr)
+	if reply.status != http.StatusNoContent {
+		if reply.retryAfter {
+			w.Header().Set("Retry-After", "1")
+		}
+		writeESError(w, reply.status, esErrorType(reply.status), reply.msg)
+		return
+	}
+	writeESJSON(w, http.StatusOK, bulkResponse(items, rr.requestID, time.Since(start)))
+}
+
+type esBulkItem struct {
+	Index   string         `json:"_index"`
+	ID      string         `json:"_id"`
+	Version int            `json:"_version,omitempty"`
+	Result  string         `json:"result,omitempty"`
+	Status  int            `json:"status"`
+	Error   *esErrorReason `json:"error,omitempty"`
+}
+
+type esErrorReason struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+func bulkResponse(items []esbulk.Item, requestID string, took time.Duration) map[string]any {
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+	out := make([]map[string]esBulkItem, len(items))
+	hasErrors := false
+	for i, it := range items {
+		item := esBulkItem{Index: it.Index, ID: it.ID, Status: it.Status}
+		if item.ID == "" {
+			item.ID = requestID + "-" + strconv.Itoa(i)
+		}
+		if it.Error != "" {
+			hasErrors = true
+			item.Error = &esErrorReason{Type: "mapper_parsing_exception", Reason: it.Error}
+		} else {
+			item.Version, item.Result = 1, "created"
+		}
+		out[i] = map[string]esBulkItem{it.Action: item}
+	}
+	return map[string]any{"took": took.Milliseconds(), "errors": hasErrors, "items": out}
+}
+
+// esErrorType names a rejected push as Elasticsearch names the error
+// Beats and Fluent Bit decide retries on: 429 and 5xx are retried.
+func esErrorType(status int) string {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return "es_rejected_execution_exception"
+	case status >= 500:
+		return "unavailable_shards_exception"
+	default:
+		return "illegal_argument_exception"
+	}
+}
+
+func writeESError(w http.ResponseWriter, status int, typ, reason string) {
+	cause := esErrorReason{Type: typ, Reason: reason}
+	writeESJSON(w, status, map[string]any{
+		"error":  map[string]any{"root_cause": []esErrorReason{cause}, "type": typ, "reason": reason},
+		"status": status,
+	})
+}
+
+func writeESJSON(w http.ResponseWriter, status int, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	// Elasticsearch clients since 7.14 refuse servers without it
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
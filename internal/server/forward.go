@@ -0,0 +1,330 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/config"
+	"github.com/DeveloperDarkhan/loki-producer/internal/forward"
+	"github.com/DeveloperDarkhan/loki-producer/internal/logproto"
+	"github.com/DeveloperDarkhan/loki-producer/internal/record"
+	"github.com/DeveloperDarkhan/loki-producer/internal/tracing"
+)
+
+// forwardEndpoint is the endpoint label of pushes received over the Fluent
+// Forward protocol.
+const forwardEndpoint = "forward"
+
+// forwardHandshakeTimeout bounds the shared-key handshake of a connection.
+const forwardHandshakeTimeout = 10 * time.Second
+
+var errForwardTooLarge = errors.New("forward message exceeds max_body_bytes")
+
+// forwardListener accepts Fluent Forward connections and pushes every event
+// message for the listener's tenant, through push like any HTTP push.
+type forwardListener struct {
+	s        *Server
+	cfg      config.ForwardListener
+	hostname string // sent in PONG
+
+	ln     net.Listener
+	connMu sync.Mutex
+	conns  map[net.Conn]struct{}
+	wg     sync.WaitGroup
+}
+
+func newForwardListeners(s *Server, cfg *config.Config) []*forwardListener {
+	hostname, _ := os.Hostname()
+	out := make([]*forwardListener, 0, len(cfg.ForwardListeners))
+	for _, lc := range cfg.ForwardListeners {
+		out = append(out, &forwardListener{
+			s:        s,
+			cfg:      lc,
+			hostname: hostname,
+			conns:    make(map[net.Conn]struct{}),
+		})
+	}
+	return out
+}
+
+// start binds the socket and serves it until stop.
+func (l *forwardListener) start() error {
+	ln, err := net.Listen("tcp", l.cfg.Address)
+	if err != nil {
+		return fmt.Errorf("forward listener %s: %w", l.cfg.Name, err)
+	}
+	l.ln = ln
+	slog.Info("forward listening", "listener", l.cfg.Name, "address", l.cfg.Address, "tenant", l.cfg.Tenant, "auth", l.cfg.SharedKey != "")
+	l.wg.Add(1)
+	go l.serve()
+	return nil
+}
+
+// stop closes the socket and open connections. A message being pushed
+// finishes first; its ack is lost, so the sender resends it.
+func (l *forwardListener) stop() {
+	_ = l.ln.Close()
+	l.connMu.Lock()
+	for c := range l.conns {
+		_ = c.Close()
+	}
+	l.connMu.Unlock()
+	l.wg.Wait()
+}
+
+func (l *forwardListener) serve() {
+	defer l.wg.Done()
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			slog.Warn("forward accept failed", "listener", l.cfg.Name, "error", err.Error())
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		l.connMu.Lock()
+		l.conns[conn] = struct{}{}
+		l.connMu.Unlock()
+		l.wg.Add(1)
+		go l.serveConn(conn)
+	}
+}
+
+func (l *forwardListener) serveConn(conn net.Conn) {
+	active := l.s.metrics.ForwardConnectionsActive.WithLabelValues(l.cfg.Name)
+	active.Inc()
+	defer func() {
+		active.Dec()
+		l.connMu.Lock()
+		delete(l.conns, conn)
+		l.connMu.Unlock()
+		_ = conn.Close()
+		l.wg.Done()
+	}()
+	remote := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+
+	limit := &messageLimit{r: conn}
+	dec := forward.NewDecoder(bufio.NewReader(limit))
+	enc := msgpack.NewEncoder(conn)
+	if l.cfg.SharedKey != "" {
+		limit.n = 64 << 10
+		_ = conn.SetDeadline(time.Now().Add(forwardHandshakeTimeout))
+		if err := forward.Handshake(dec, enc, l.cfg.SharedKey, l.hostname); err != nil {
+			l.s.warnSampled("forward handshake|"+l.cfg.Name, "forward handshake failed", "listener", l.cfg.Name, "remote", remote, "error", err.Error())
+			return
+		}
+		_ = conn.SetDeadline(time.Time{})
+	}
+
+	defer limit.reset(0, nil, 0)
+	for {
+		l.s.mu.RLock()
+		cfg := l.s.cfg
+		memBudget := l.s.memBudget
+		l.s.mu.RUnlock()
+		// Reads are buffered, so the limits hold per message give or take
+		// one buffer
+		limit.reset(cfg.MaxBodyBytes, memBudget, cfg.MaxInflightBytesWait)
+		msg, err := dec.Next(cfg.MaxDecodedBodyBytes, limit.reserve)
+		// The decoded events stay in memory until their pushes return,
+		// which reserve their own payloads from the same budget
+		limit.reset(0, nil, 0)
+		if errors.Is(err, errOverBudget) || errors.Is(err, forward.ErrDecodedTooLong) {
+			// Read whole, but its entries never fit the limits: resending
+			// would not help, so it is acked and dropped
+			l.s.metrics.ForwardEventsTotal.WithLabelValues(l.cfg.Name, "too_large").Inc()
+			l.s.warnSampled("forward too large|"+l.cfg.Name, "forward message dropped", "listener", l.cfg.Name, "remote", remote, "tag", msg.Tag, "error", err.Error())
+			if msg.Chunk != "" {
+				if err := forward.WriteAck(enc, msg.Chunk); err != nil {
+					return
+				}
+			}
+			continue
+		}
+		if errors.Is(err, errMemoryBudget) {
+			// Nothing was acked, the sender resends once it reconnects
+			l.s.metrics.ShedTotal.WithLabelValues(shedMemory).Inc()
+			l.s.warnSampled("shed|"+shedMemory, "request shed", "listener", l.cfg.Name, "tenant", l.cfg.Tenant, "reason", shedMemory)
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				l.s.metrics.ForwardEventsTotal.WithLabelValues(l.cfg.Name, "invalid").Inc()
+				l.s.warnSampled("forward read error|"+l.cfg.Name, "forward read error", "listener", l.cfg.Name, "remote", remote, "error", err.Error())
+			}
+			// The stream cannot be resynchronized after a bad message
+			return
+		}
+		ok := l.push(msg, cfg, remote)
+		if msg.Chunk == "" {
+			continue
+		}
+		if !ok {
+			// Without the ack the sender retries the chunk; closing makes
+			// it do so now instead of after its ack timeout
+			return
+		}
+		if err := forward.WriteAck(enc, msg.Chunk); err != nil {
+			return
+		}
+	}
+}
+
+// push converts one event message and pushes it, split into as many pushes
+// as it takes to keep each within one Kafka record. It reports whether all
+// events reached Kafka; the sender then resends the whole chunk, so parts
+// pushed before a failure are written twice.
+func (l *forwardListener) push(msg forward.Message, cfg *config.Config, remote string) bool {
+	mapping := &record.Mapping{MessageField: cfg.ForwardMessageKey, LabelFields: cfg.ForwardLabelKeys}
+	base := make([]logproto.LabelPair, 0, len(l.cfg.Labels)+1)
+	for k, v := range l.cfg.Labels {
+		base = append(base, logproto.LabelPair{Name: k, Value: v})
+	}
+	base = append(base, logproto.LabelPair{Name: "tag", Value: msg.Tag})
+	limit := batchLimit(cfg)
+	b := &logproto.Batch{}
+	for _, ev := range msg.Events {
+		labels, e, err := mapping.Map(ev.Record, base[:len(base):len(base)], ev.Time)
+		if err != nil {
+			continue // only a timestamp field fails, and none is set
+		}
+		if (&logproto.Batch{}).SizeWith(labels, &e) > limit {
+			// Never fits a record; resending would not help either
+			l.s.metrics.ForwardEventsTotal.WithLabelValues(l.cfg.Name, "too_large").Inc()
+			continue
+		}
+		if b.SizeWith(labels, &e) > limit {
+			if !l.pushBatch(b, msg, remote) {
+				return false
+			}
+			b = &logproto.Batch{}
+		}
+		b.Add(labels, e)
+	}
+	return l.pushBatch(b, msg, remote)
+}
+
+// pushBatch pushes part of an event message and reports whether it reached
+// Kafka.
+func (l *forwardListener) pushBatch(b *logproto.Batch, msg forward.Message, remote string) bool {
+	start := time.Now()
+	conv := encodePush(b)
+	if conv.payload == nil {
+		return true
+	}
+
+	ctx, span := tracing.Tracer().Start(context.Background(), "forward "+l.cfg.Name)
+	defer span.End()
+	rr := &resultRecorder{requestID: newRequestID(), lines: conv.lines, streams: conv.streams}
+	reply := l.s.push(ctx, pushInput{
+		endpoint:      forwardEndpoint,
+		tenant:        l.cfg.Tenant,
+		contentType:   convertedContentType,
+		contentLength: int64(len(conv.payload.B)),
+		payload:       conv.payload,
+	}, rr)
+	rr.status = reply.status
+	result := l.s.finishRequest(forwardEndpoint, rr, start)
+
+	l.s.logAccess(forwardEndpoint, remote, "", rr, time.Since(start))
+
+	span.SetAttributes(
+		attribute.String("forward.listener", l.cfg.Name),
+		attribute.String("forward.tag", msg.Tag),
+		attribute.Int("lines", conv.lines),
+		attribute.String("result", result),
+	)
+	if reply.status != http.StatusNoContent {
+		span.SetStatus(codes.Error, result)
+		l.s.metrics.ForwardEventsTotal.WithLabelValues(l.cfg.Name, "rejected").Add(float64(conv.lines))
+		l.s.warnSampled("forward push failed|"+l.cfg.Name+"|"+reply.result, "forward push failed",
+			"listener", l.cfg.Name, "tenant", l.cfg.Tenant, "lines", conv.lines, "result", reply.result, "require_ack", msg.Chunk != "")
+		return false
+	}
+	l.s.metrics.ForwardEventsTotal.WithLabelValues(l.cfg.Name, "success").Add(float64(conv.lines))
+	return true
+}
+
+// messageLimit fails reads once n bytes were read since it was last reset.
+// With a memory budget it also reserves what is read, in budgetChunk steps,
+// and holds it until the next reset: the message and what is decompressed
+// from it, until the decoder returned.
+type messageLimit struct {
+	r io.Reader
+	n int64
+
+	budget   *memoryBudget
+	wait     time.Duration
+	reserved int64
+	read     int64
+}
+
+func (m *messageLimit) Read(p []byte) (int, error) {
+	if m.n <= 0 {
+		return 0, errForwardTooLarge
+	}
+	if int64(len(p)) > m.n {
+		p = p[:m.n]
+	}
+	if m.budget != nil {
+		if m.read == m.reserved {
+			if err := m.reserve(budgetChunk); err != nil {
+				if errors.Is(err, errOverBudget) {
+					// Mid-message, the stream cannot be resynchronized
+					return 0, errForwardTooLarge
+				}
+				return 0, err
+			}
+		}
+		if left := m.reserved - m.read; int64(len(p)) > left {
+			p = p[:left]
+		}
+	}
+	n, err := m.r.Read(p)
+	m.n -= int64(n)
+	m.read += int64(n)
+	return n, err
+}
+
+// reserve takes n more bytes of the budget, waiting as push does; the
+// decoder reserves decompressed entries through it. errOverBudget means the
+// message can never fit.
+func (m *messageLimit) reserve(n int64) error {
+	if m.budget == nil {
+		return nil
+	}
+	if m.budget.exceeds(m.reserved + n) {
+		return errOverBudget
+	}
+	if !m.budget.reserve(context.Background(), n, m.wait) {
+		return errMemoryBudget
+	}
+	m.reserved += n
+	return nil
+}
+
+// reset starts the next message, releasing what the last one reserved.
+func (m *messageLimit) reset(n int64, budget *memoryBudget, wait time.Duration) {
+	if m.budget != nil {
+		m.budget.release(m.reserved)
+	}
+	m.n, m.budget, m.wait, m.reserved, m.read = n, budget, wait, 0, 0
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/bufpool"
+	"github.com/DeveloperDarkhan/loki-producer/internal/config"
+	"github.com/DeveloperDarkhan/loki-producer/internal/tracing"
+)
+
+// grpcEndpoint is the endpoint label of pushes received over gRPC.
+const grpcEndpoint = "grpc"
+
+// rawCodec hands messages through as bytes. The distributor forwards the
+// PushRequest without decoding it, so no generated logproto code is needed;
+// it registers as "proto" to serve standard protobuf clients.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	return *v.(*[]byte), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	*v.(*[]byte) = data
+	return nil
+}
+
+func (rawCodec) Name() string { return "proto" }
+
+// pusherService is logproto.Pusher as Loki distributors serve it.
+var pusherService = grpc.ServiceDesc{
+	ServiceName: "logproto.Pusher",
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Push",
+		Handler: func(srv any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+			return srv.(*Server).grpcPush(ctx, dec)
+		},
+	}},
+	Metadata: "pkg/logproto/logproto.proto",
+}
+
+func newGRPCServer(s *Server, cfg *config.Config) *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.ForceServerCodec(rawCodec{}),
+		grpc.MaxRecvMsgSize(cfg.GRPCMaxRecvMsgSize),
+	)
+	srv.RegisterService(&pusherService, s)
+	return srv
+}
+
+// serveGRPC binds grpc_port and serves until Stop.
+func (s *Server) serveGRPC() error {
+	ln, err := net.Listen("tcp", ":"+s.cfg.GRPCPort)
+	if err != nil {
+		return fmt.Errorf("grpc listen: %w", err)
+	}
+	slog.Info("grpc listening", "port", s.cfg.GRPCPort)
+	go func() {
+		if err := s.grpcServer.Serve(ln); err != nil {
+			select {
+			case s.serveErr <- fmt.Errorf("grpc: %w", err):
+			default:
+			}
+		}
+	}()
+	return nil
+}
+
+// stopGRPC waits for running pushes until ctx is done, then cuts them off.
+func (s *Server) stopGRPC(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+	}
+}
+
+// grpcPush serves logproto.Pusher/Push through push. The PushRequest is
+// snappy-compressed as in the HTTP protobuf push, so records on the topic
+// look the same whichever transport they came from.
+func (s *Server) grpcPush(ctx context.Context, dec func(any) error) (any, error) {
+	start := time.Now()
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = tracing.ExtractHTTP(ctx, metadataCarrier(md))
+	ctx, span := tracing.Tracer().Start(ctx, "/logproto.Pusher/Push", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	var raw []byte
+	if err := dec(&raw); err != nil {
+		return nil, err
+	}
+	payload := bufpool.Get(snappy.MaxEncodedLen(len(raw)))
+	payload.B = snappy.Encode(payload.B[:cap(payload.B)], raw)
+
+	rr := &resultRecorder{requestID: firstMD(md, "x-request-id")}
+	if rr.requestID == "" {
+		rr.requestID = newRequestID()
+	}
+	reply := s.push(ctx, pushInput{
+		endpoint:      grpcEndpoint,
+		tenant:        firstMD(md, "x-scope-orgid"),
+		contentType:   "application/x-protobuf",
+		contentLength: int64(len(payload.B)),
+		payload:       payload,
+	}, rr)
+	rr.status = reply.status
+	result := s.finishRequest(grpcEndpoint, rr, start)
+
+	s.logAccess(grpcEndpoint, peerHost(ctx), firstMD(md, "user-agent"), rr, time.Since(start))
+
+	code := grpcCode(reply.status)
+	span.SetAttributes(
+		attribute.String("rpc.system", "grpc"),
+		attribute.String("rpc.service", "logproto.Pusher"),
+		attribute.String("rpc.method", "Push"),
+		attribute.Int("rpc.grpc.status_code", int(code)),
+		attribute.String("result", result),
+	)
+	if code != grpccodes.OK {
+		span.SetStatus(codes.Error, result)
+		return nil, status.Error(code, reply.msg)
+	}
+	return new([]byte), nil // empty PushResponse
+}
+
+// grpcCode maps a push status the way Loki clients expect: 429 and 5xx are
+// retried, other 4xx are not.
+func grpcCode(httpStatus int) grpccodes.Code {
+	switch {
+	case httpStatus < 300:
+		return grpccodes.OK
+	case httpStatus == http.StatusTooManyRequests:
+		return grpccodes.ResourceExhausted
+	case httpStatus == http.StatusServiceUnavailable:
+		return grpccodes.Unavailable
+	case httpStatus < 500:
+		return grpccodes.InvalidArgument
+	default:
+		return grpccodes.Internal
+	}
+}
+
+func firstMD(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func peerHost(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// metadataCarrier reads the trace context from gRPC metadata.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	return firstMD(metadata.MD(c), key)
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/config"
+)
+
+// enableH2C serves HTTP/2 without TLS on srv next to HTTP/1.1: prior
+// knowledge connections (as from a mesh sidecar) and Upgrade: h2c. h2c
+// connections are hijacked from srv, so Shutdown only sends them GOAWAY and
+// does not wait; their requests still hold the Kafka writer, which drains.
+func enableH2C(srv *http.Server, cfg *config.Config) {
+	h2s := &http2.Server{
+		MaxConcurrentStreams:     cfg.HTTP2MaxConcurrentStreams,
+		MaxReadFrameSize:         cfg.HTTP2MaxReadFrameSize,
+		MaxUploadBufferPerStream: cfg.HTTP2MaxUploadBufferPerStream,
+		IdleTimeout:              cfg.HTTPIdleTimeout,
+	}
+	// Registers the GOAWAY on Shutdown; the TLS setup it also does is unused
+	_ = http2.ConfigureServer(srv, h2s)
+	srv.Handler = h2c.NewHandler(srv.Handler, h2s)
+}
+
+// countHTTP2Streams tracks HTTP/2 requests, one stream each. The request
+// that carried an Upgrade: h2c stays HTTP/1.1 and is not counted.
+func (s *Server) countHTTP2Streams(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 {
+			s.metrics.HTTP2StreamsTotal.Inc()
+			s.metrics.HTTP2StreamsActive.Inc()
+			defer s.metrics.HTTP2StreamsActive.Dec()
+		}
+		h.ServeHTTP(w, r)
+	})
+}
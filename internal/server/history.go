@@ -0,0 +1,57 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/config"
+)
+
+// maxReloadHistory bounds the in-memory reload audit trail.
+const maxReloadHistory = 100
+
+// ReloadEvent is one entry of the reload audit trail.
+type ReloadEvent struct {
+	Time    time.Time            `json:"time"`
+	Source  string               `json:"source"`  // startup|signal|http|watch
+	Outcome string               `json:"outcome"` // success|failure
+	Error   string               `json:"error,omitempty"`
+	OldHash string               `json:"old_hash,omitempty"`
+	Hash    string               `json:"hash,omitempty"`
+	Diff    []config.FieldChange `json:"diff,omitempty"`
+}
+
+type reloadHistory struct {
+	mu     sync.Mutex
+	events []ReloadEvent // oldest first
+}
+
+func (h *reloadHistory) add(ev ReloadEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.events) == maxReloadHistory {
+		copy(h.events, h.events[1:])
+		h.events = h.events[:len(h.events)-1]
+	}
+	h.events = append(h.events, ev)
+}
+
+// list returns the history newest first.
+func (h *reloadHistory) list() []ReloadEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]ReloadEvent, len(h.events))
+	for i, ev := range h.events {
+		out[len(h.events)-1-i] = ev
+	}
+	return out
+}
+
+func (s *Server) configHistoryHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(s.history.list())
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/config"
+)
+
+// acceptLoop accepts on one socket and hands connections to whichever
+// listenerView pulls them. A reload that only changes server timeouts starts
+// a new http.Server on a new view of the same socket, so the port is never
+// unbound; the old server stops pulling once its view is closed.
+type acceptLoop struct {
+	ln     net.Listener
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func listen(port string) (*acceptLoop, error) {
+	ln, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return nil, err
+	}
+	l := &acceptLoop{ln: ln, conns: make(chan net.Conn), closed: make(chan struct{})}
+	go l.run()
+	return l, nil
+}
+
+func (l *acceptLoop) run() {
+	defer close(l.conns)
+	for {
+		c, err := l.ln.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return
+		}
+		select {
+		case l.conns <- c:
+		case <-l.closed:
+			_ = c.Close()
+			return
+		}
+	}
+}
+
+// Close unbinds the socket. Connections already handed out are unaffected.
+func (l *acceptLoop) Close() error {
+	var err error
+	l.once.Do(func() {
+		close(l.closed)
+		err = l.ln.Close()
+	})
+	return err
+}
+
+func (l *acceptLoop) view() net.Listener {
+	return &listenerView{src: l, done: make(chan struct{})}
+}
+
+type listenerView struct {
+	src  *acceptLoop
+	done chan struct{}
+	once sync.Once
+}
+
+func (v *listenerView) Accept() (net.Conn, error) {
+	select {
+	case c, ok := <-v.src.conns:
+		if !ok {
+			return nil, net.ErrClosed
+		}
+		return c, nil
+	case <-v.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops this view only; the socket stays open for other views.
+func (v *listenerView) Close() error {
+	v.once.Do(func() { close(v.done) })
+	return nil
+}
+
+func (v *listenerView) Addr() net.Addr { return v.src.ln.Addr() }
+
+func newIngestServer(cfg *config.Config, h http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           h,
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+		MaxHeaderBytes:    cfg.HTTPMaxHeaderBytes,
+	}
+	if cfg.HTTP2Enabled {
+		enableH2C(srv, cfg)
+	}
+	return srv
+}
+
+// listenerChanged reports whether a reload must replace the ingest server.
+func listenerChanged(a, b *config.Config) bool {
+	return a.Port != b.Port ||
+		a.HTTPReadHeaderTimeout != b.HTTPReadHeaderTimeout ||
+		a.HTTPReadTimeout != b.HTTPReadTimeout ||
+		a.HTTPWriteTimeout != b.HTTPWriteTimeout ||
+		a.HTTPIdleTimeout != b.HTTPIdleTimeout ||
+		a.HTTPMaxHeaderBytes != b.HTTPMaxHeaderBytes ||
+		a.HTTP2Enabled != b.HTTP2Enabled ||
+		a.HTTP2MaxConcurrentStreams != b.HTTP2MaxConcurrentStreams ||
+		a.HTTP2MaxReadFrameSize != b.HTTP2MaxReadFrameSize ||
+		a.HTTP2MaxUploadBufferPerStream != b.HTTP2MaxUploadBufferPerStream
+}
+
+// serveIngest runs srv until it is shut down. Errors of a server that has
+// already been replaced by reload are expected (its view or socket was
+// closed) and not reported.
+func (s *Server) serveIngest(srv *http.Server, l net.Listener) {
+	err := srv.Serve(l)
+	if err == nil || errors.Is(err, http.ErrServerClosed) {
+		return
+	}
+	s.mu.RLock()
+	current := s.httpServer == srv
+	s.mu.RUnlock()
+	if !current {
+		return
+	}
+	select {
+	case s.serveErr <- err:
+	default:
+	}
+}
+
+// swapListenerLocked replaces the ingest server with one built from newCfg.
+// A new port is bound before anything is swapped, so a busy port fails the
+// reload and leaves the old listener serving. s.mu must be held for writing.
+func (s *Server) swapListenerLocked(newCfg *config.Config) error {
+	oldSrv := s.httpServer
+	newSrv := newIngestServer(newCfg, s.ingestHandler)
+	if s.ingestLn == nil {
+		// Not started yet: Start binds newCfg.Port
+		s.httpServer = newSrv
+		return nil
+	}
+
+	oldLn := s.ingestLn
+	ln := oldLn
+	if newCfg.Port != s.cfg.Port {
+		var err error
+		if ln, err = listen(newCfg.Port); err != nil {
+			return fmt.Errorf("listen on new port %s: %w", newCfg.Port, err)
+		}
+	}
+	s.httpServer = newSrv
+	s.ingestLn = ln
+	go s.serveIngest(newSrv, ln.view())
+	if ln != oldLn {
+		_ = oldLn.Close()
+	}
+	slog.Info("ingest listener replaced", "port", newCfg.Port, "old_port", s.cfg.Port)
+
+	// Requests in progress on the old server may run up to its write timeout
+	s.drains.Add(1)
+	go func() {
+		defer s.drains.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), oldSrv.WriteTimeout)
+		defer cancel()
+		if err := oldSrv.Shutdown(ctx); err != nil {
+			slog.Warn("old ingest listener drain incomplete", "error", err.Error())
+		}
+	}()
+	return nil
+}
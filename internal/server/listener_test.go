@@ -0,0 +1,119 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/config"
+)
+
+// TestSwapListener reloads a running ingest listener and checks that a
+// request in progress on the old server completes while new requests reach
+// the new one.
+func TestSwapListener(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		newPort bool
+	}{
+		{name: "new port", newPort: true},
+		{name: "same port, new timeouts"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			entered, release := make(chan struct{}), make(chan struct{})
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/slow" {
+					close(entered)
+					<-release
+				}
+				_, _ = io.WriteString(w, r.URL.Path)
+			})
+			client := &http.Client{
+				Transport: &http.Transport{DisableKeepAlives: true},
+				Timeout:   5 * time.Second,
+			}
+			get := func(addr, path string) (string, error) {
+				resp, err := client.Get("http://" + addr + path)
+				if err != nil {
+					return "", err
+				}
+				defer resp.Body.Close()
+				b, err := io.ReadAll(resp.Body)
+				return string(b), err
+			}
+
+			ln, err := listen("0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			oldAddr := ln.ln.Addr().String()
+			_, port, _ := net.SplitHostPort(oldAddr)
+			cfg := &config.Config{Port: port, HTTPWriteTimeout: 5 * time.Second}
+			s := &Server{cfg: cfg, ingestHandler: h, ingestLn: ln, serveErr: make(chan error, 1)}
+			s.httpServer = newIngestServer(cfg, h)
+			go s.serveIngest(s.httpServer, ln.view())
+			defer func() { _ = s.ingestLn.Close() }()
+
+			slow := make(chan string, 1)
+			go func() {
+				body, err := get(oldAddr, "/slow")
+				if err != nil {
+					body = err.Error()
+				}
+				slow <- body
+			}()
+			<-entered
+
+			newCfg := *cfg
+			newCfg.HTTPReadTimeout = time.Minute
+			if tc.newPort {
+				newCfg.Port = "0"
+			}
+			s.mu.Lock()
+			err = s.swapListenerLocked(&newCfg)
+			s.mu.Unlock()
+			if err != nil {
+				t.Fatalf("swap: %v", err)
+			}
+			if s.httpServer.ReadTimeout != time.Minute {
+				t.Errorf("new server read timeout = %v, want 1m", s.httpServer.ReadTimeout)
+			}
+			newAddr := s.ingestLn.ln.Addr().String()
+			if (newAddr != oldAddr) != tc.newPort {
+				t.Fatalf("listening on %s after swap from %s", newAddr, oldAddr)
+			}
+
+			for i := 0; i < 3; i++ {
+				path := fmt.Sprint("/fast", i)
+				if body, err := get(newAddr, path); err != nil || body != path {
+					t.Errorf("request on %s = %q, %v, want %q", newAddr, body, err, path)
+				}
+			}
+			if tc.newPort {
+				if c, err := net.DialTimeout("tcp", oldAddr, time.Second); err == nil {
+					c.Close()
+					t.Errorf("old port %s still accepts connections", oldAddr)
+				}
+			}
+
+			select {
+			case body := <-slow:
+				t.Fatalf("request on the old server finished before release: %q", body)
+			default:
+			}
+			close(release)
+			if body := <-slow; body != "/slow" {
+				t.Errorf("request on the old server = %q, want /slow", body)
+			}
+			s.drains.Wait()
+			select {
+			case err := <-s.serveErr:
+				t.Errorf("serve error: %v", err)
+			default:
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// shedMemory is the result and shed reason of pushes refused because
+// max_inflight_bytes is used up (503).
+const shedMemory = "memory_exhausted"
+
+// budgetChunk is reserved at a time for bodies without Content-Length.
+const budgetChunk = 64 << 10
+
+var (
+	errMemoryBudget = errors.New("in-flight memory budget exhausted")
+	// errOverBudget means one request needs more than the whole budget, so
+	// retrying it cannot help (413)
+	errOverBudget = errors.New("request exceeds max_inflight_bytes")
+)
+
+// memoryBudget bounds the request bodies held in memory across all pushes.
+// A body is reserved before it is read and released once its Kafka write
+// finished, so a burst of large pushes is refused instead of growing the
+// heap. Waiters are woken on every release and race for the budget; there
+// is no FIFO order.
+type memoryBudget struct {
+	mu    sync.Mutex
+	limit int64
+	used  int64
+	freed chan struct{} // closed and replaced on release
+	gauge prometheus.Gauge
+}
+
+func newMemoryBudget(limit int64, gauge prometheus.Gauge) *memoryBudget {
+	return &memoryBudget{limit: limit, freed: make(chan struct{}), gauge: gauge}
+}
+
+// setLimit applies a reloaded max_inflight_bytes. Reservations above a
+// lowered limit stay until released.
+func (b *memoryBudget) setLimit(limit int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.limit = limit
+	b.wakeLocked()
+}
+
+// exceeds reports whether n bytes are more than the whole budget.
+func (b *memoryBudget) exceeds(n int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return n > b.limit
+}
+
+func (b *memoryBudget) tryReserve(n int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.used+n > b.limit {
+		return false
+	}
+	b.used += n
+	b.gauge.Set(float64(b.used))
+	return true
+}
+
+// reserve takes n bytes, waiting up to wait for other pushes to release
+// theirs. It fails at once with wait 0 or when ctx is done.
+func (b *memoryBudget) reserve(ctx context.Context, n int64, wait time.Duration) bool {
+	var deadline <-chan time.Time
+	for {
+		b.mu.Lock()
+		if b.used+n <= b.limit {
+			b.used += n
+			b.gauge.Set(float64(b.used))
+			b.mu.Unlock()
+			return true
+		}
+		freed := b.freed
+		b.mu.Unlock()
+		if wait <= 0 {
+			return false
+		}
+		if deadline == nil {
+			t := time.NewTimer(wait)
+			defer t.Stop()
+			deadline = t.C
+		}
+		select {
+		case <-freed:
+		case <-deadline:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func (b *memoryBudget) release(n int64) {
+	if n == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	b.gauge.Set(float64(b.used))
+	b.wakeLocked()
+}
+
+func (b *memoryBudget) wakeLocked() {
+	close(b.freed)
+	b.freed = make(chan struct{})
+}
+
+// budgetReader reads a body within its reservation. Without Content-Length
+// it reserves in budgetChunk steps as the body is read and fails with
+// errMemoryBudget when no more is available, or errOverBudget when the
+// request (with what it held beforehand) would need more than the whole
+// budget; with Content-Length net/http already stops the body at the
+// reserved size.
+type budgetReader struct {
+	io.ReadCloser
+	b        *memoryBudget
+	chunked  bool
+	held     int64 // reserved by the same request before this reader
+	reserved int64
+	read     int64
+}
+
+func (br *budgetReader) Read(p []byte) (int, error) {
+	if !br.chunked {
+		return br.ReadCloser.Read(p)
+	}
+	if br.read == br.reserved {
+		if !br.b.tryReserve(budgetChunk) {
+			if br.b.exceeds(br.held + br.reserved + budgetChunk) {
+				return 0, errOverBudget
+			}
+			return 0, errMemoryBudget
+		}
+		br.reserved += budgetChunk
+	}
+	if left := br.reserved - br.read; int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err := br.ReadCloser.Read(p)
+	br.read += int64(n)
+	return n, err
+}
+
+// reserveBody reserves the expected size of r's body, at most maxBody, and
+// returns a reader accounting the rest. The caller releases br.reserved.
+func (b *memoryBudget) reserveBody(ctx context.Context, r io.ReadCloser, contentLength, maxBody int64, wait time.Duration) (*budgetReader, error) {
+	n, chunked := int64(budgetChunk), contentLength < 0
+	if !chunked {
+		n = contentLength
+	}
+	if n > maxBody {
+		n = maxBody
+	}
+	if err := b.reserveRequest(ctx, n, wait); err != nil {
+		return nil, err
+	}
+	return &budgetReader{ReadCloser: r, b: b, chunked: chunked, reserved: n}, nil
+}
+
+// reserveRequest reserves n bytes of one request: errOverBudget when they
+// can never fit, errMemoryBudget when they do not fit now.
+func (b *memoryBudget) reserveRequest(ctx context.Context, n int64, wait time.Duration) error {
+	if b.exceeds(n) {
+		return errOverBudget
+	}
+	if !b.reserve(ctx, n, wait) {
+		return errMemoryBudget
+	}
+	return nil
+}
+
+// buildMemoryBudgetLocked applies max_inflight_bytes from s.cfg, keeping the
+// reservations of an existing budget across a reload.
+func (s *Server) buildMemoryBudgetLocked() {
+	s.metrics.InflightBytesLimit.Set(float64(s.cfg.MaxInflightBytes))
+	if s.cfg.MaxInflightBytes == 0 {
+		s.memBudget = nil
+		return
+	}
+	if s.memBudget == nil {
+		s.memBudget = newMemoryBudget(s.cfg.MaxInflightBytes, s.metrics.InflightBytes)
+		return
+	}
+	s.memBudget.setLimit(s.cfg.MaxInflightBytes)
+}
+
+// rejectMemory refuses a push over the memory budget: 503 and Retry-After
+// like the concurrency limit sheds, or 413 when the push alone needs more
+// than the whole budget (errOverBudget) and retrying it cannot help.
+func (s *Server) rejectMemory(rr *resultRecorder, endpoint, ctClass, tenant string, err error) pushReply {
+	if errors.Is(err, errOverBudget) {
+		s.warnSampled("over budget|"+tenant, "push exceeds max_inflight_bytes", "tenant", tenant, "endpoint", endpoint)
+		return s.rejectPush(rr, endpoint, ctClass, tenant, pushReply{status: http.StatusRequestEntityTooLarge, result: "too_large", msg: err.Error()})
+	}
+	s.metrics.ShedTotal.WithLabelValues(shedMemory).Inc()
+	s.warnSampled("shed|"+shedMemory, "request shed", "tenant", tenant, "reason", shedMemory)
+	return s.rejectPush(rr, endpoint, ctClass, tenant, pushReply{status: http.StatusServiceUnavailable, result: shedMemory, msg: shedMemory, retryAfter: true})
+}
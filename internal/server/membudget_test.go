@@ -0,0 +1,144 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func testBudget(limit int64) *memoryBudget {
+	return newMemoryBudget(limit, prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_inflight_bytes"}))
+}
+
+func TestMemoryBudgetReserveRequest(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name string
+		used int64 // reserved by other pushes
+		n    int64
+		wait time.Duration
+		want error
+	}{
+		{name: "fits", n: 100},
+		{name: "fits exactly", used: 400, n: 600},
+		{name: "busy", used: 500, n: 600, want: errMemoryBudget},
+		{name: "busy after waiting", used: 500, n: 600, wait: 10 * time.Millisecond, want: errMemoryBudget},
+		{name: "larger than the budget", n: 1001, want: errOverBudget},
+		{name: "larger than the budget while busy", used: 900, n: 1001, want: errOverBudget},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := testBudget(1000)
+			b.tryReserve(tc.used)
+			err := b.reserveRequest(ctx, tc.n, tc.wait)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("error = %v, want %v", err, tc.want)
+			}
+			want := tc.used
+			if err == nil {
+				want += tc.n
+			}
+			if b.used != want {
+				t.Errorf("used = %d, want %d", b.used, want)
+			}
+		})
+	}
+}
+
+func TestMemoryBudgetWaitsForRelease(t *testing.T) {
+	b := testBudget(1000)
+	b.tryReserve(800)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		b.release(800)
+	}()
+	if err := b.reserveRequest(context.Background(), 500, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if b.used != 500 {
+		t.Errorf("used = %d, want 500", b.used)
+	}
+}
+
+func TestBudgetReader(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 5*budgetChunk)
+	for _, tc := range []struct {
+		name  string
+		limit int64
+		used  int64 // reserved by other pushes
+		held  int64 // reserved by the same push before the reader
+		want  error
+	}{
+		{name: "fits", limit: 8 * budgetChunk},
+		{name: "busy", limit: 8 * budgetChunk, used: 4 * budgetChunk, want: errMemoryBudget},
+		{name: "larger than the budget", limit: 4 * budgetChunk, want: errOverBudget},
+		{name: "larger with what the push holds", limit: 8 * budgetChunk, used: 4 * budgetChunk, held: 4 * budgetChunk, want: errOverBudget},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := testBudget(tc.limit)
+			b.tryReserve(tc.used)
+			br := &budgetReader{ReadCloser: io.NopCloser(bytes.NewReader(body)), b: b, chunked: true, held: tc.held}
+			got, err := io.ReadAll(br)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("error = %v, want %v", err, tc.want)
+			}
+			if err == nil && !bytes.Equal(got, body) {
+				t.Errorf("read %d bytes, want %d", len(got), len(body))
+			}
+			if b.used != tc.used+br.reserved {
+				t.Errorf("used = %d, want %d", b.used, tc.used+br.reserved)
+			}
+			b.release(br.reserved)
+			if b.used != tc.used {
+				t.Errorf("after release: used = %d, want %d", b.used, tc.used)
+			}
+		})
+	}
+}
+
+func TestDecodeBodyBudget(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(bytes.Repeat([]byte("x"), 10*budgetChunk))
+	zw.Close()
+	body := buf.Bytes()
+
+	for _, tc := range []struct {
+		name  string
+		limit int64
+		held  int64
+		max   int64
+		want  error
+	}{
+		{name: "fits", limit: 16 * budgetChunk, held: int64(len(body)), max: 16 * budgetChunk},
+		{name: "inflates past the budget on an idle server", limit: 8 * budgetChunk, max: 16 * budgetChunk, want: errOverBudget},
+		{name: "inflates past the budget with the body", limit: 12 * budgetChunk, held: 4 * budgetChunk, max: 16 * budgetChunk, want: errOverBudget},
+		{name: "inflates past max_decoded_body_bytes", limit: 16 * budgetChunk, max: 4 * budgetChunk, want: errDecodedTooLarge},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := testBudget(tc.limit)
+			b.tryReserve(tc.held)
+			d, err := decodeBody(body, "gzip", tc.max, b, tc.held)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("error = %v, want %v", err, tc.want)
+			}
+			if err == nil {
+				if len(d.data) != 10*budgetChunk {
+					t.Errorf("decoded %d bytes, want %d", len(d.data), 10*budgetChunk)
+				}
+				if b.used <= tc.held {
+					t.Errorf("used = %d, decoded bytes not reserved", b.used)
+				}
+				d.release()
+			}
+			if b.used != tc.held {
+				t.Errorf("after release: used = %d, want %d", b.used, tc.held)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/config"
+	"github.com/DeveloperDarkhan/loki-producer/internal/otlp"
+)
+
+// handleOTLPLogs is the OTLP/HTTP logs receiver (POST /otlp/v1/logs). The
+// export request is converted into a Loki push as Loki's own OTLP endpoint
+// does and then written like any other push.
+func (s *Server) handleOTLPLogs(w http.ResponseWriter, r *http.Request) {
+	rr, ok := w.(*resultRecorder)
+	if !ok {
+		rr = &resultRecorder{ResponseWriter: w}
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.RLock()
+	cfg := s.cfg
+	s.mu.RUnlock()
+	resourceLabels := cfg.OTLPResourceLabels
+	if len(resourceLabels) == 0 {
+		resourceLabels = config.OTLPResourceLabels
+	}
+	mapping := otlp.NewMapping(resourceLabels, cfg.OTLPLogLabels)
+
+	contentType := r.Header.Get("Content-Type")
+	isJSON := strings.HasPrefix(contentType, "application/json")
+
+	reply := s.push(r.Context(), pushInput{
+		endpoint:        r.URL.Path,
+		tenant:          r.Header.Get("X-Scope-OrgID"),
+		contentType:     contentType,
+		contentEncoding: r.Header.Get("Content-Encoding"),
+		contentLength:   r.ContentLength,
+		body:            r.Body,
+		w:               w,
+		convert: func(data []byte) (conversion, error) {
+			batch, err := mapping.Convert(data, isJSON)
+			if err != nil {
+				return conversion{}, err
+			}
+			return encodePush(batch), nil
+		},
+	}, rr)
+	if reply.status != http.StatusNoContent {
+		writePushReply(w, reply)
+		return
+	}
+
+	// OTLP/HTTP answers an empty ExportLogsServiceResponse in the request's
+	// encoding
+	if isJSON {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("{}"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+}
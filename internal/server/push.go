@@ -0,0 +1,375 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/bufpool"
+	"github.com/DeveloperDarkhan/loki-producer/internal/config"
+	"github.com/DeveloperDarkhan/loki-producer/internal/tracing"
+)
+
+// pushInput is one push as received by any ingest transport. The body is
+// either streamed (body, contentLength) or already in memory (payload).
+type pushInput struct {
+	endpoint        string // endpoint label of metrics, logs
+	tenant          string // as sent; default_tenant applies when empty
+	contentType     string // forwarded as record header
+	contentEncoding string
+	contentLength   int64 // -1 when unknown
+	body            io.ReadCloser
+	payload         *bufpool.Buffer     // owned by push from the call on
+	convert         convertFunc         // turns the body into a Loki push, nil to forward it as is
+	w               http.ResponseWriter // HTTP only: lets MaxBytesReader close the connection
+}
+
+// pushReply is the outcome of push as an HTTP status; other transports map
+// it to their own codes.
+type pushReply struct {
+	status     int // 204 on success
+	result     string
+	msg        string
+	retryAfter bool // ask the client to back off (shed by a limit)
+}
+
+// push runs one push through tenant resolution, rate, concurrency and
+// memory limits and the Kafka write. It fills rr for the access log, usage
+// and SLOs.
+func (s *Server) push(ctx context.Context, in pushInput, rr *resultRecorder) pushReply {
+	s.mu.RLock()
+	cfg := s.cfg
+	globalLimiter := s.globalLimiter
+	tenantLimiters := s.tenantLimiters
+	concurrency := s.concurrency
+	memBudget := s.memBudget
+	s.mu.RUnlock()
+
+	tracer := tracing.Tracer()
+
+	// Body and headers come from pools and go back once the Kafka write
+	// returned (see pushBuffers.recycle)
+	pb := getPushBuffers()
+	pb.body = in.payload
+	var writeErr error
+	defer func() { pb.recycle(writeErr) }()
+
+	_, validateSpan := tracer.Start(ctx, "validate")
+	tenant := in.tenant
+	if tenant == "" && cfg.AllowEmptyTenant {
+		tenant = cfg.DefaultTenant
+	}
+	rr.tenant = tenant
+	ctClass := classifyContentType(in.contentType)
+	validateSpan.SetAttributes(attribute.String("tenant", tenant), attribute.String("content_type_class", ctClass))
+	if tenant == "" {
+		validateSpan.SetStatus(codes.Error, "missing tenant")
+		validateSpan.End()
+		s.warnSampled("missing tenant|"+in.endpoint, "missing tenant", "endpoint", in.endpoint)
+		return s.rejectPush(rr, in.endpoint, "other", tenant, pushReply{status: http.StatusBadRequest, result: "missing_tenant", msg: "Missing X-Scope-OrgID"})
+	}
+	validateSpan.End()
+
+	// Rate limit
+	_, rlSpan := tracer.Start(ctx, "rate_limit")
+	if cfg.RateLimitEnabled {
+		if globalLimiter != nil && !globalLimiter.lim.Allow() {
+			rlSpan.SetStatus(codes.Error, "rate limited (global)")
+			rlSpan.End()
+			s.metrics.RateLimitedTotal.WithLabelValues("global").Inc()
+			s.warnSampled("rate limited global", "rate limited global", "tenant", tenant)
+			return s.rejectPush(rr, in.endpoint, "other", tenant, pushReply{status: http.StatusTooManyRequests, result: "rate_limited", msg: "rate limited (global)"})
+		}
+		if tenantLimiters != nil {
+			if lim := tenantLimiters.get(tenant); !lim.Allow() {
+				rlSpan.SetStatus(codes.Error, "rate limited (tenant)")
+				rlSpan.End()
+				s.metrics.RateLimitedTotal.WithLabelValues("tenant").Inc()
+				s.warnSampled("rate limited tenant|"+tenant, "rate limited tenant", "tenant", tenant)
+				return s.rejectPush(rr, in.endpoint, "other", tenant, pushReply{status: http.StatusTooManyRequests, result: "rate_limited", msg: "rate limited (tenant)"})
+			}
+		}
+	}
+	rlSpan.End()
+
+	// Concurrency limit: shed before reading the body. The Kafka write below
+	// reports its latency back to the limiter.
+	var kafkaSample struct {
+		ok     bool
+		dur    time.Duration
+		failed bool
+	}
+	if concurrency != nil {
+		ok, saturated, reason := concurrency.acquire(tenant)
+		if !ok {
+			s.metrics.ShedTotal.WithLabelValues(reason).Inc()
+			s.warnSampled("shed|"+reason, "request shed", "tenant", tenant, "reason", reason)
+			reply := pushReply{status: http.StatusTooManyRequests, result: reason, msg: reason}
+			if reason == shedOverloaded {
+				reply.status, reply.retryAfter = http.StatusServiceUnavailable, true
+			}
+			return s.rejectPush(rr, in.endpoint, ctClass, tenant, reply)
+		}
+		s.setConcurrencyGauges(concurrency)
+		defer func() {
+			concurrency.release(tenant, saturated, kafkaSample.ok, kafkaSample.dur, kafkaSample.failed)
+			s.setConcurrencyGauges(concurrency)
+		}()
+	}
+
+	// Memory budget: reserve the body before reading it. The reservation
+	// (held) moves over to the converted payload and is released once the
+	// Kafka write below returns
+	src := in.body
+	var br *budgetReader
+	var held int64
+	if memBudget != nil {
+		defer func() { memBudget.release(held) }()
+		if in.payload != nil {
+			n := int64(len(in.payload.B))
+			if err := memBudget.reserveRequest(ctx, n, cfg.MaxInflightBytesWait); err != nil {
+				return s.rejectMemory(rr, in.endpoint, ctClass, tenant, err)
+			}
+			held = n
+		} else {
+			var err error
+			if br, err = memBudget.reserveBody(ctx, in.body, in.contentLength, cfg.MaxBodyBytes, cfg.MaxInflightBytesWait); err != nil {
+				return s.rejectMemory(rr, in.endpoint, ctClass, tenant, err)
+			}
+			held = br.reserved
+			src = br
+		}
+	}
+
+	_, readSpan := tracer.Start(ctx, "read_body")
+	var body []byte
+	var err error
+	if in.payload != nil {
+		body = in.payload.B
+		if int64(len(body)) > cfg.MaxBodyBytes {
+			err = &http.MaxBytesError{Limit: cfg.MaxBodyBytes}
+		}
+	} else {
+		limited := http.MaxBytesReader(in.w, src, cfg.MaxBodyBytes)
+		var buf *bufpool.Buffer
+		buf, err = bufpool.ReadAll(limited, int(min(in.contentLength, cfg.MaxBodyBytes)))
+		if err == nil {
+			pb.body, body = buf, buf.B
+		}
+		in.body.Close()
+		if br != nil {
+			held = br.reserved
+		}
+	}
+	readSpan.SetAttributes(attribute.Int("bytes", len(body)))
+	if err != nil {
+		readSpan.RecordError(err)
+		readSpan.SetStatus(codes.Error, "read error")
+	}
+	readSpan.End()
+	if errors.Is(err, errMemoryBudget) || errors.Is(err, errOverBudget) {
+		return s.rejectMemory(rr, in.endpoint, ctClass, tenant, err)
+	}
+	if err != nil {
+		res := "bad_request"
+		msg := strings.ToLower(err.Error())
+		if strings.Contains(msg, "request body too large") {
+			res = "too_large"
+		}
+		s.warnSampled("read error|"+tenant+"|"+res, "read error", "tenant", tenant, "error", err.Error(), "result", res)
+		return s.rejectPush(rr, in.endpoint, ctClass, tenant, pushReply{status: http.StatusBadRequest, result: res, msg: res})
+	}
+
+	size := len(body)
+	rr.bytes = size
+	s.metrics.ObserveRequestBytes(in.endpoint, tenant, size)
+
+	contentType, contentEncoding := in.contentType, in.contentEncoding
+	if in.convert != nil {
+		_, convSpan := tracer.Start(ctx, "convert")
+		conv, reply, err := s.convert(in, body, cfg, memBudget, held)
+		if err != nil {
+			convSpan.SetStatus(codes.Error, reply.result)
+			convSpan.End()
+			if errors.Is(err, errMemoryBudget) || errors.Is(err, errOverBudget) {
+				return s.rejectMemory(rr, in.endpoint, ctClass, tenant, err)
+			}
+			s.warnSampled("convert error|"+in.endpoint+"|"+reply.result, "convert error", "tenant", tenant, "endpoint", in.endpoint, "result", reply.result, "error", reply.msg)
+			return s.rejectPush(rr, in.endpoint, ctClass, tenant, reply)
+		}
+		convSpan.SetAttributes(attribute.Int("lines", conv.lines), attribute.Int("streams", conv.streams))
+		convSpan.End()
+		rr.lines, rr.streams = conv.lines, conv.streams
+		if conv.payload == nil {
+			// Nothing to write, as Loki treats an empty push
+			rr.result = "success"
+			s.metrics.ObserveRequest(in.endpoint, "success", ctClass, tenant)
+			s.metrics.TrackResult(true, false)
+			return pushReply{status: http.StatusNoContent, result: "success"}
+		}
+		// The raw body is no longer needed: its reservation moves over to
+		// the converted payload, topped up or given back as it differs
+		bufpool.Put(pb.body)
+		pb.body, body = conv.payload, conv.payload.B
+		if memBudget != nil {
+			n := int64(len(body))
+			if n > held {
+				if err := memBudget.reserveRequest(ctx, n-held, cfg.MaxInflightBytesWait); err != nil {
+					return s.rejectMemory(rr, in.endpoint, ctClass, tenant, err)
+				}
+			} else {
+				memBudget.release(held - n)
+			}
+			held = n
+		}
+		contentType, contentEncoding = convertedContentType, ""
+	}
+
+	// Kafka message
+	msg := pb.message(body, tenant, contentType, contentEncoding, cfg.KafkaBalancer == "hash")
+	msg.Time = time.Now()
+
+	kafkaStart := time.Now()
+	writeCtx, kafkaSpan := tracer.Start(ctx, "kafka_write", trace.WithSpanKind(trace.SpanKindProducer))
+	// Downstream consumers continue the trace from the record headers
+	tracing.InjectKafka(writeCtx, &msg.Headers)
+	writeCtx, cancel := context.WithTimeout(writeCtx, cfg.KafkaWriteTimeout)
+	gen := s.acquireWriter()
+	delivery, err := gen.Write(writeCtx, msg)
+	gen.release()
+	writeErr = err
+	cancel()
+	kafkaDur := time.Since(kafkaStart).Seconds()
+	rr.kafkaMs = kafkaDur * 1000
+	kafkaSpan.SetAttributes(
+		attribute.String("messaging.system", "kafka"),
+		attribute.String("messaging.destination.name", delivery.Topic),
+		attribute.Int("messaging.kafka.destination.partition", delivery.Partition),
+		attribute.String("messaging.kafka.leader", delivery.Leader),
+	)
+	if err != nil {
+		kafkaSpan.RecordError(err)
+		kafkaSpan.SetStatus(codes.Error, "kafka write failed")
+	}
+	kafkaSpan.End()
+
+	var topic, partition, broker string
+	if cfg.MetricsEnablePartitionLabels {
+		topic, partition, broker = s.metrics.PartitionLabels(delivery.Topic, delivery.Partition, delivery.Leader, cfg.MetricsPartitionMaxSeries)
+	}
+
+	if err != nil {
+		errType := classifyKafkaError(err)
+		// Only timeouts say something about Kafka latency
+		kafkaSample.ok, kafkaSample.dur, kafkaSample.failed = errType == "timeout", time.Since(kafkaStart), true
+		s.metrics.KafkaWriteErrorsTotal.WithLabelValues(errType).Inc()
+		s.metrics.KafkaWriteDurationHist.WithLabelValues("error").Observe(kafkaDur)
+		if cfg.MetricsEnablePartitionLabels {
+			s.metrics.KafkaPartitionWriteErrorsTotal.WithLabelValues(topic, partition, broker, errType).Inc()
+			s.metrics.KafkaPartitionWriteDurationHist.WithLabelValues(topic, partition, broker, "error").Observe(kafkaDur)
+		}
+		s.consecutiveErrors++
+		s.metrics.KafkaConsecutiveErrors.Set(float64(s.consecutiveErrors))
+		s.warnSampled("kafka write failed|"+errType+"|"+delivery.Leader, "kafka write failed",
+			"tenant", tenant, "bytes", size, "kafka_ms", kafkaDur*1000,
+			"error", err.Error(), "error_type", errType,
+			"partition", delivery.Partition, "broker", delivery.Leader,
+		)
+		return s.rejectPush(rr, in.endpoint, ctClass, tenant, pushReply{status: http.StatusServiceUnavailable, result: "kafka_error", msg: "kafka write failed"})
+	}
+
+	// Success
+	kafkaSample.ok, kafkaSample.dur = true, time.Since(kafkaStart)
+	s.consecutiveErrors = 0
+	s.metrics.KafkaConsecutiveErrors.Set(0)
+	s.metrics.KafkaWriteDurationHist.WithLabelValues("success").Observe(kafkaDur)
+	if cfg.MetricsEnablePartitionLabels {
+		s.metrics.KafkaPartitionWriteDurationHist.WithLabelValues(topic, partition, broker, "success").Observe(kafkaDur)
+		s.metrics.KafkaPartitionBytesTotal.WithLabelValues(topic, partition, broker).Add(float64(len(body)))
+	}
+	rr.result = "success"
+	rr.writtenBytes = len(body)
+	s.metrics.ObserveRequest(in.endpoint, "success", ctClass, tenant)
+	s.metrics.TrackResult(true, false)
+
+	slog.Debug("accepted",
+		"tenant", tenant, "bytes", size, "kafka_ms", kafkaDur*1000,
+		"endpoint", in.endpoint, "partition", delivery.Partition,
+	)
+	return pushReply{status: http.StatusNoContent, result: "success"}
+}
+
+// convert undoes the Content-Encoding of a body and converts it. A failed
+// conversion is returned as the reply to send with its error;
+// errMemoryBudget and errOverBudget mean the memory budget ran out while
+// decoding, next to the held bytes of the body.
+func (s *Server) convert(in pushInput, body []byte, cfg *config.Config, memBudget *memoryBudget, held int64) (conversion, pushReply, error) {
+	d, err := decodeBody(body, in.contentEncoding, cfg.MaxDecodedBodyBytes, memBudget, held)
+	switch {
+	case errors.Is(err, errMemoryBudget), errors.Is(err, errOverBudget):
+		return conversion{}, pushReply{result: shedMemory}, err
+	case errors.Is(err, errDecodedTooLarge):
+		return conversion{}, pushReply{status: http.StatusRequestEntityTooLarge, result: "too_large", msg: err.Error()}, err
+	case err != nil:
+		return conversion{}, pushReply{status: http.StatusBadRequest, result: "bad_request", msg: err.Error()}, err
+	}
+	conv, err := in.convert(d.data)
+	d.release()
+	if err != nil {
+		return conversion{}, pushReply{status: http.StatusBadRequest, result: "bad_request", msg: err.Error()}, err
+	}
+	// A record over kafka_batch_bytes would fail every retry in kafka-go;
+	// the client has to send less per push instead
+	if conv.payload != nil && len(conv.payload.B) > recordLimit(cfg) {
+		msg := fmt.Sprintf("converted push of %d bytes exceeds the %d bytes of a Kafka record (max_body_bytes, kafka_batch_bytes)", len(conv.payload.B), recordLimit(cfg))
+		bufpool.Put(conv.payload)
+		return conversion{}, pushReply{status: http.StatusRequestEntityTooLarge, result: "too_large", msg: msg}, errors.New(msg)
+	}
+	return conv, pushReply{}, nil
+}
+
+// rejectPush counts a refused push and returns its reply.
+func (s *Server) rejectPush(rr *resultRecorder, endpoint, ctClass, tenant string, reply pushReply) pushReply {
+	rr.result = reply.result
+	s.metrics.ObserveRequest(endpoint, reply.result, ctClass, tenant)
+	s.metrics.TrackResult(false, true)
+	return reply
+}
+
+// handlePush is the HTTP transport of push (Loki push API).
+func (s *Server) handlePush(w http.ResponseWriter, r *http.Request) {
+	rr, ok := w.(*resultRecorder)
+	if !ok {
+		rr = &resultRecorder{ResponseWriter: w}
+	}
+	reply := s.push(r.Context(), pushInput{
+		endpoint:        r.URL.Path,
+		tenant:          r.Header.Get("X-Scope-OrgID"),
+		contentType:     r.Header.Get("Content-Type"),
+		contentEncoding: r.Header.Get("Content-Encoding"),
+		contentLength:   r.ContentLength,
+		body:            r.Body,
+		w:               w,
+	}, rr)
+	writePushReply(w, reply)
+}
+
+func writePushReply(w http.ResponseWriter, reply pushReply) {
+	if reply.status == http.StatusNoContent {
+		w.WriteHeader(reply.status)
+		return
+	}
+	if reply.retryAfter {
+		w.Header().Set("Retry-After", "1")
+	}
+	http.Error(w, reply.msg, reply.status)
+}
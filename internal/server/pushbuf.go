@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/bufpool"
+)
+
+// pushBuffers is the per-push memory referenced by the Kafka message: the
+// body and the record headers. It is pooled and recycled once the write
+// returned, see recycle.
+type pushBuffers struct {
+	body    *bufpool.Buffer
+	headers [6]kafkago.Header // tenant, content type and encoding, trace context
+	meta    []byte            // backing bytes of header values and key
+}
+
+var pushBuffersPool = sync.Pool{
+	New: func() any { return &pushBuffers{meta: make([]byte, 0, 256)} },
+}
+
+func getPushBuffers() *pushBuffers {
+	return pushBuffersPool.Get().(*pushBuffers)
+}
+
+// bytes copies v into meta. The result is capped so later appends never
+// write into it.
+func (p *pushBuffers) bytes(v string) []byte {
+	start := len(p.meta)
+	p.meta = append(p.meta, v...)
+	return p.meta[start:len(p.meta):len(p.meta)]
+}
+
+// message builds the record for body without allocating headers.
+func (p *pushBuffers) message(body []byte, tenant, contentType, contentEncoding string, keyed bool) kafkago.Message {
+	tenantB := p.bytes(tenant)
+	headers := append(p.headers[:0], kafkago.Header{Key: "X-Scope-OrgID", Value: tenantB})
+	if contentType != "" {
+		headers = append(headers, kafkago.Header{Key: "Content-Type", Value: p.bytes(contentType)})
+	}
+	if contentEncoding != "" {
+		headers = append(headers, kafkago.Header{Key: "Content-Encoding", Value: p.bytes(contentEncoding)})
+	}
+	msg := kafkago.Message{Value: body, Headers: headers}
+	if keyed {
+		msg.Key = tenantB
+	}
+	return msg
+}
+
+// recycle returns the buffers to their pools unless the write err says
+// kafka-go may still hold them: a write abandoned on a canceled or expired
+// context can be sent later, so its memory is left to the GC.
+func (p *pushBuffers) recycle(err error) {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return
+	}
+	bufpool.Put(p.body)
+	p.body = nil
+	clear(p.headers[:])
+	p.meta = p.meta[:0]
+	pushBuffersPool.Put(p)
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/bufpool"
+)
+
+// BenchmarkPushBody compares the per-push allocations of reading a body and
+// building its Kafka message: "alloc" is the former io.ReadAll path with
+// fresh headers, "pooled" the pushBuffers path with and without
+// Content-Length. Run with:
+//
+//	go test -run '^$' -bench PushBody -benchmem ./internal/server
+func BenchmarkPushBody(b *testing.B) {
+	for _, size := range []int{4 << 10, 64 << 10, 1 << 20} {
+		payload := bytes.Repeat([]byte("x"), size)
+
+		b.Run(fmt.Sprintf("alloc/%dKiB", size>>10), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			r := bytes.NewReader(payload)
+			for i := 0; i < b.N; i++ {
+				r.Reset(payload)
+				body, err := io.ReadAll(r)
+				if err != nil {
+					b.Fatal(err)
+				}
+				var headers []kafkago.Header
+				headers = append(headers, kafkago.Header{Key: "X-Scope-OrgID", Value: []byte("tenant-a")})
+				headers = append(headers, kafkago.Header{Key: "Content-Type", Value: []byte("application/x-protobuf")})
+				headers = append(headers, kafkago.Header{Key: "Content-Encoding", Value: []byte("snappy")})
+				msg := kafkago.Message{Value: body, Headers: headers, Key: []byte("tenant-a")}
+				sink(msg)
+			}
+		})
+
+		for _, hint := range []struct {
+			name string
+			size int
+		}{{"content-length", size}, {"chunked", -1}} {
+			b.Run(fmt.Sprintf("pooled/%s/%dKiB", hint.name, size>>10), func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(size))
+				r := bytes.NewReader(payload)
+				for i := 0; i < b.N; i++ {
+					r.Reset(payload)
+					pb := getPushBuffers()
+					buf, err := bufpool.ReadAll(r, hint.size)
+					if err != nil {
+						b.Fatal(err)
+					}
+					pb.body = buf
+					sink(pb.message(buf.B, "tenant-a", "application/x-protobuf", "snappy", true))
+					pb.recycle(nil)
+				}
+			})
+		}
+	}
+}
+
+var sunk int
+
+// sink keeps msg alive like the Kafka writer would.
+func sink(msg kafkago.Message) {
+	sunk += len(msg.Value) + len(msg.Headers)
+}
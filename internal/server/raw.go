@@ -0,0 +1,91 @@
+package server
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/logproto"
+	"github.com/DeveloperDarkhan/loki-producer/internal/raw"
+)
+
+// rawLabelsHeader carries the stream labels of a raw push as
+// name=value pairs separated by commas.
+const rawLabelsHeader = "X-Loki-Labels"
+
+// handleRawPush takes plain-text or NDJSON lines (POST /loki/api/v1/raw)
+// with the stream labels in the query string or X-Loki-Labels, converts
+// them into a Loki push and writes it like any other push.
+func (s *Server) handleRawPush(w http.ResponseWriter, r *http.Request) {
+	rr, ok := w.(*resultRecorder)
+	if !ok {
+		rr = &resultRecorder{ResponseWriter: w}
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.RLock()
+	cfg := s.cfg
+	s.mu.RUnlock()
+
+	contentType := r.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	ndjson := mediaType == "application/x-ndjson" || mediaType == "application/json"
+
+	reply := s.push(r.Context(), pushInput{
+		endpoint:        r.URL.Path,
+		tenant:          r.Header.Get("X-Scope-OrgID"),
+		contentType:     contentType,
+		contentEncoding: r.Header.Get("Content-Encoding"),
+		contentLength:   r.ContentLength,
+		body:            r.Body,
+		w:               w,
+		convert: func(data []byte) (conversion, error) {
+			labels, err := rawLabels(r)
+			if err != nil {
+				return conversion{}, err
+			}
+			batch, err := raw.Convert(data, labels, ndjson, cfg.RawTimestampField, time.Now())
+			if err != nil {
+				return conversion{}, err
+			}
+			return encodePush(batch), nil
+		},
+	}, rr)
+	writePushReply(w, reply)
+}
+
+// rawLabels collects the stream labels: every query parameter, then the
+// pairs of X-Loki-Labels. Names are sanitized as for other converted
+// pushes; a later value of the same name wins.
+func rawLabels(r *http.Request) ([]logproto.LabelPair, error) {
+	byName := make(map[string]string)
+	for name, values := range r.URL.Query() {
+		byName[logproto.SanitizeLabelName(name)] = values[len(values)-1]
+	}
+	if h := r.Header.Get(rawLabelsHeader); h != "" {
+		for _, pair := range strings.Split(h, ",") {
+			name, value, ok := strings.Cut(pair, "=")
+			name = strings.TrimSpace(name)
+			if !ok || name == "" {
+				return nil, errors.New("invalid " + rawLabelsHeader + " header, expected name=value pairs separated by commas")
+			}
+			byName[logproto.SanitizeLabelName(name)] = strings.TrimSpace(value)
+		}
+	}
+	labels := make([]logproto.LabelPair, 0, len(byName))
+	for name, value := range byName {
+		if name == "" || value == "" {
+			continue // empty parameters such as "?job=" do not make labels
+		}
+		labels = append(labels, logproto.LabelPair{Name: name, Value: value})
+	}
+	if len(labels) == 0 {
+		return nil, errors.New("at least one label is required, as query parameters or in the " + rawLabelsHeader + " header")
+	}
+	return labels, nil
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/logproto"
+)
+
+func TestRawLabels(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		query  string
+		header string
+		want   string // LabelsString of the result
+		err    bool
+	}{
+		{name: "query", query: "job=cron&host=h1", want: `{host="h1", job="cron"}`},
+		{name: "header", header: "job=cron, host = h1 ", want: `{host="h1", job="cron"}`},
+		{name: "header wins over query", query: "job=q&env=prod", header: "job=h", want: `{env="prod", job="h"}`},
+		{name: "last query value wins", query: "job=a&job=b", want: `{job="b"}`},
+		{name: "names are sanitized", query: "app.name=x", header: "k8s-ns=y", want: `{app_name="x", k8s_ns="y"}`},
+		{name: "empty values are dropped", query: "job=cron&env=", header: "host=", want: `{job="cron"}`},
+		{name: "no labels", err: true},
+		{name: "only empty values", query: "job=", err: true},
+		{name: "header pair without value separator", query: "job=x", header: "job", err: true},
+		{name: "header pair without name", header: "=x", err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/loki/api/v1/raw?"+tc.query, nil)
+			if tc.header != "" {
+				r.Header.Set(rawLabelsHeader, tc.header)
+			}
+			labels, err := rawLabels(r)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("labels %v, want an error", labels)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := logproto.LabelsString(labels); got != tc.want {
+				t.Errorf("labels = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
@@ -5,23 +5,34 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	kafkago "github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
 
 	// Use local module path instead of old alloy-distributor path
+	"github.com/DeveloperDarkhan/loki-producer/internal/buildinfo"
 	"github.com/DeveloperDarkhan/loki-producer/internal/config"
 	"github.com/DeveloperDarkhan/loki-producer/internal/kafka"
+	"github.com/DeveloperDarkhan/loki-producer/internal/logging"
 	"github.com/DeveloperDarkhan/loki-producer/internal/metrics"
+	"github.com/DeveloperDarkhan/loki-producer/internal/slo"
+	"github.com/DeveloperDarkhan/loki-producer/internal/tracing"
+	"github.com/DeveloperDarkhan/loki-producer/internal/usage"
 )
 
 type Server struct {
@@ -30,9 +41,23 @@ type Server struct {
 	mu         sync.RWMutex
 	cfg        *config.Config
 	httpServer *http.Server
-	kWriter    *kafka.Writer
+	ingestLn   *acceptLoop // nil until Start
+	serveErr   chan error
+	done       chan struct{}
+	adminSrv   *http.Server // nil when admin routes share the ingest listener
+
+	ingestHandler    http.Handler       // ingest routes, shared by the servers reload builds
+	grpcServer       *grpc.Server       // nil when grpc_enabled is false
+	syslogListeners  []*syslogListener  // syslog_listeners, bound in Start
+	forwardListeners []*forwardListener // forward_listeners, bound in Start
+
+	startedAt  time.Time
+	writer     *writerGen
+	drains     sync.WaitGroup // replaced writers and listeners still draining
 	metrics    *metrics.Registry
+	registry   *prometheus.Registry // served on /metrics
 	stopHealth chan struct{}
+	stopWatch  chan struct{}
 	reloadCh   chan struct{}
 
 	// health counters
@@ -44,69 +69,140 @@ type Server struct {
 	// rate limiting
 	globalLimiter  *rateLimiterWrapper
 	tenantLimiters *perTenantLimiter
+	concurrency    *adaptiveLimiter // nil when concurrency_limit_enabled is false
+	memBudget      *memoryBudget    // nil when max_inflight_bytes is 0
+
+	// log sampling for repetitive warnings
+	sampler *logging.Sampler
+
+	accessLogger *accessLogger // nil when disabled
+
+	slo       *slo.Tracker // nil when disabled
+	sloPaging atomic.Bool  // availability page rule firing, with slo_readiness
+
+	usage       *usage.Tracker // nil when disabled
+	usageWriter *kafka.Writer  // nil unless usage_kafka_topic is set
+	stopUsage   chan struct{}
+	usageDone   chan struct{}
+
+	history reloadHistory
 }
 
 type rateLimiterWrapper struct {
 	lim *rate.Limiter
 }
 
-func New(cfgFile string, cfg *config.Config) (*Server, error) {
-	writer, err := kafka.NewWriter(kafka.WriterConfig{
-		Brokers:               cfg.KafkaBrokers,
-		Topic:                 cfg.KafkaTopic,
-		RequiredAcks:          cfg.KafkaRequiredAcks,
-		Balancer:              cfg.KafkaBalancer,
-		WriteTimeout:          cfg.KafkaWriteTimeout,
-		BatchTimeout:          cfg.KafkaBatchTimeout,
-		BatchSize:             cfg.KafkaBatchSize,
-		BatchBytes:            cfg.KafkaBatchBytes,
-		SASLEnabled:           cfg.KafkaSASLEnabled,
-		SASLMechanism:         cfg.KafkaSASLMechanism,
-		SASLUsername:          cfg.KafkaSASLUsername,
-		SASLPassword:          cfg.KafkaSASLPassword,
-		TLSEnabled:            cfg.KafkaTLSEnabled,
-		TLSInsecureSkipVerify: cfg.KafkaTLSInsecureSkipVerify,
-		TLSCAFile:             cfg.KafkaTLSCAFile,
-	})
+// Option customizes a Server built by New.
+type Option func(*Server)
+
+// WithRegistry registers the server's metrics on reg and serves reg on
+// /metrics. The caller owns reg: unlike the default registry, the Go runtime
+// and process collectors are not added to it.
+func WithRegistry(reg *prometheus.Registry) Option {
+	return func(s *Server) {
+		s.registry = reg
+	}
+}
+
+// New builds a server. By default it owns a fresh Prometheus registry with
+// the Go runtime and process collectors, so several servers can live in one
+// process (tests, embedding).
+func New(cfgFile string, cfg *config.Config, opts ...Option) (*Server, error) {
+	writer, err := newKafkaWriter(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("kafka writer init: %w", err)
 	}
 
-	mreg := metrics.NewRegistry(cfg.MetricsEnableTenantLabel, cfg.SLAGaugeEnable)
-
 	s := &Server{
 		cfgFile:    cfgFile,
 		cfg:        cfg,
-		kWriter:    writer,
-		metrics:    mreg,
+		writer:     &writerGen{Writer: writer, gen: 1},
 		stopHealth: make(chan struct{}),
+		stopWatch:  make(chan struct{}),
 		reloadCh:   make(chan struct{}, 1),
+		serveErr:   make(chan error, 1),
+		done:       make(chan struct{}),
+		startedAt:  time.Now(),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	if s.registry == nil {
+		s.registry = prometheus.NewRegistry()
+		s.registry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+	}
+	s.registry.MustRegister(buildinfo.Collector())
+	mreg := metrics.NewRegistry(s.registry, cfg.SLAGaugeEnable)
+	mreg.SetTenantLabel(cfg.MetricsEnableTenantLabel, cfg.MetricsTenantMaxSeries)
+	s.metrics = mreg
 
 	s.buildRateLimitersLocked()
+	s.buildConcurrencyLimiterLocked()
+	s.buildMemoryBudgetLocked()
+	s.sampler = logging.NewSampler(cfg.LogSampleInterval, cfg.LogSampleBurst)
+	s.accessLogger = newAccessLogger(cfg)
+	if cfg.SLOEnabled {
+		s.slo = slo.NewTracker(cfg.SLOBudgetWindow)
+	}
+	if cfg.UsageEnabled {
+		s.usage = usage.NewTracker(cfg.UsageWindows)
+		if s.usageWriter, err = newUsageWriter(cfg); err != nil {
+			_ = writer.Close()
+			return nil, fmt.Errorf("usage writer init: %w", err)
+		}
+		if s.usageWriter != nil {
+			s.stopUsage = make(chan struct{})
+			s.usageDone = make(chan struct{})
+			go s.publishUsage(cfg.UsagePublishInterval)
+		}
+	}
+	mreg.SetConfigHash(cfg.Hash)
+	mreg.KafkaWriterGeneration.Set(1)
+	s.history.add(ReloadEvent{Time: s.startedAt, Source: "startup", Outcome: "success", Hash: cfg.Hash})
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/loki/api/v1/push", s.wrapRequest("/loki/api/v1/push", s.handlePush))
-	mux.HandleFunc("/api/prom/push", s.wrapRequest("/api/prom/push", s.handlePush))
+	mux.HandleFunc("/loki/api/v1/push", s.accessLog("/loki/api/v1/push", s.wrapRequest("/loki/api/v1/push", s.handlePush)))
+	mux.HandleFunc("/api/prom/push", s.accessLog("/api/prom/push", s.wrapRequest("/api/prom/push", s.handlePush)))
+	mux.HandleFunc("/loki/api/v1/raw", s.accessLog("/loki/api/v1/raw", s.wrapRequest("/loki/api/v1/raw", s.handleRawPush)))
+	mux.HandleFunc("/otlp/v1/logs", s.accessLog("/otlp/v1/logs", s.wrapRequest("/otlp/v1/logs", s.handleOTLPLogs)))
+	mux.HandleFunc("/_bulk", s.accessLog(esBulkEndpoint, s.wrapRequest(esBulkEndpoint, s.handleESBulk)))
+	mux.HandleFunc("/", s.esRoot(s.accessLog(esIndexBulkEndpoint, s.wrapRequest(esIndexBulkEndpoint, s.handleESBulk))))
 	mux.HandleFunc("/ready", s.readyHandler)
-	mux.HandleFunc("/configz", s.configzHandler)
-	mux.HandleFunc("/reload", s.reloadHandler)
-	mux.Handle("/metrics", promhttp.Handler())
 
-	s.httpServer = &http.Server{
-		Addr:              ":" + cfg.Port,
-		Handler:           mux,
-		ReadHeaderTimeout: 4 * time.Second,
-		ReadTimeout:       25 * time.Second,
-		WriteTimeout:      25 * time.Second,
-		IdleTimeout:       90 * time.Second,
+	admin := s.adminMux()
+	if cfg.AdminPort == "" {
+		// Legacy single-port mode: admin routes on the ingest listener
+		mux.Handle("/metrics", admin)
+		mux.Handle("/configz", admin)
+		mux.Handle("/configz/history", admin)
+		mux.Handle("/reload", admin)
+		mux.Handle("/usage", admin)
+		mux.Handle("/debug/", admin)
+	} else {
+		s.adminSrv = &http.Server{
+			Addr:              ":" + cfg.AdminPort,
+			Handler:           admin,
+			ReadHeaderTimeout: 4 * time.Second,
+			IdleTimeout:       90 * time.Second,
+		}
+	}
+
+	s.ingestHandler = s.countHTTP2Streams(mux)
+	s.httpServer = newIngestServer(cfg, s.ingestHandler)
+	if cfg.GRPCEnabled {
+		s.grpcServer = newGRPCServer(s, cfg)
 	}
+	s.syslogListeners = newSyslogListeners(s, cfg)
+	s.forwardListeners = newForwardListeners(s, cfg)
 
 	return s, nil
 }
 
 func (s *Server) Start() error {
-	log.Printf(`{"level":"info","msg":"listening","port":%q,"topic":%q,"brokers":%q}`, s.cfg.Port, s.cfg.KafkaTopic, strings.Join(s.cfg.KafkaBrokers, ","))
+	slog.Info("listening", "port", s.cfg.Port, "topic", s.cfg.KafkaTopic, "brokers", strings.Join(s.cfg.KafkaBrokers, ","))
 	// Optional startup probe: try metadata or write tiny message
 	if s.cfg.KafkaProbeEnabled {
 		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.KafkaProbeTimeout)
@@ -116,78 +212,203 @@ func (s *Server) Start() error {
 			if s.cfg.KafkaProbeRequired {
 				return fmt.Errorf("kafka startup probe failed: %w", probeErr)
 			}
-			log.Printf(`{"level":"warn","msg":"kafka probe failed (non-fatal)","error":%q}`, probeErr.Error())
+			slog.Warn("kafka probe failed (non-fatal)", "error", probeErr.Error())
 		}
 	}
 	go s.healthLoop()
-	return s.httpServer.ListenAndServe()
+	if s.cfg.ConfigWatchEnabled {
+		go s.watchConfig(s.cfg.ConfigWatchDebounce)
+	}
+	if s.adminSrv != nil {
+		// Bind before serving ingest: a pod without /metrics and /reload
+		// must not look healthy
+		ln, err := net.Listen("tcp", s.adminSrv.Addr)
+		if err != nil {
+			return fmt.Errorf("admin listen: %w", err)
+		}
+		slog.Info("admin listening", "port", s.cfg.AdminPort)
+		go func() {
+			if err := s.adminSrv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				select {
+				case s.serveErr <- fmt.Errorf("admin: %w", err):
+				default:
+				}
+			}
+		}()
+	}
+	if s.grpcServer != nil {
+		if err := s.serveGRPC(); err != nil {
+			return err
+		}
+	}
+	for _, l := range s.syslogListeners {
+		if err := l.start(); err != nil {
+			return err
+		}
+	}
+	for _, l := range s.forwardListeners {
+		if err := l.start(); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	ln, err := listen(s.cfg.Port)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.ingestLn = ln
+	srv := s.httpServer
+	s.mu.Unlock()
+	go s.serveIngest(srv, ln.view())
+
+	// Reload may replace the ingest server; Start returns on Stop or when
+	// the current server fails
+	select {
+	case err := <-s.serveErr:
+		return err
+	case <-s.done:
+		return nil
+	}
 }
 
 func (s *Server) Stop(ctx context.Context) error {
 	close(s.stopHealth)
-	log.Println(`{"level":"info","msg":"stopping http server"}`)
-	if err := s.httpServer.Shutdown(ctx); err != nil {
+	close(s.stopWatch)
+	slog.Info("stopping http server")
+	s.mu.RLock()
+	srv, ln := s.httpServer, s.ingestLn
+	s.mu.RUnlock()
+	close(s.done)
+	err := srv.Shutdown(ctx)
+	if ln != nil {
+		_ = ln.Close()
+	}
+	if s.grpcServer != nil {
+		s.stopGRPC(ctx)
+	}
+	// Pending syslog batches still go to Kafka
+	for _, l := range s.syslogListeners {
+		l.stop()
+	}
+	for _, l := range s.forwardListeners {
+		l.stop()
+	}
+	if err != nil {
 		return err
 	}
-	log.Println(`{"level":"info","msg":"closing kafka writer"}`)
+	if s.adminSrv != nil {
+		if err := s.adminSrv.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	// Writers replaced by reload close themselves within kafka_writer_drain_timeout
+	s.drains.Wait()
+	if s.usageWriter != nil {
+		// No requests are left: flush the last usage interval
+		close(s.stopUsage)
+		<-s.usageDone
+	}
+	slog.Info("closing kafka writer")
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.kWriter.Close()
+	_ = s.accessLogger.Close()
+	return s.writer.Close()
 }
 
+// Reload sources, used as the source label of reload metrics.
+const (
+	ReloadSourceSignal = "signal"
+	ReloadSourceHTTP   = "http"
+	ReloadSourceWatch  = "watch"
+)
+
 // Reload loads config file and applies changes.
-func (s *Server) Reload() error {
+func (s *Server) Reload(source string) error {
 	config.ReloadMutex.Lock()
 	defer config.ReloadMutex.Unlock()
 
+	ev := ReloadEvent{Time: time.Now(), Source: source}
+	err := s.reload(&ev)
+	if err != nil {
+		ev.Outcome = "failure"
+		ev.Error = err.Error()
+		s.metrics.ConfigReloadsTotal.WithLabelValues(source, "failure").Inc()
+		s.metrics.ConfigLastReloadSuccessful.Set(0)
+	} else {
+		ev.Outcome = "success"
+		s.metrics.ConfigReloadsTotal.WithLabelValues(source, "success").Inc()
+		s.metrics.ConfigLastReloadSuccessful.Set(1)
+		s.metrics.ConfigLastReloadSuccessTimestamp.SetToCurrentTime()
+	}
+	s.history.add(ev)
+	return err
+}
+
+// reload applies the config file and records hashes and the field diff in ev.
+func (s *Server) reload(ev *ReloadEvent) error {
 	newCfg, _, err := config.LoadFromFile(s.cfgFile)
+	s.mu.RLock()
+	ev.OldHash = s.cfg.Hash
+	s.mu.RUnlock()
 	if err != nil {
 		return err
 	}
+	ev.Hash = newCfg.Hash
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	ev.Diff = config.DiffRuntimeViews(s.cfg.RuntimeView(), newCfg.RuntimeView())
+
 	oldImmutable := s.cfg.ImmutableSubset()
 	newImmutable := newCfg.ImmutableSubset()
 
 	rebuildWriter := config.ImmutableChanged(oldImmutable, newImmutable)
+	var newWriter *kafka.Writer
 	if rebuildWriter {
-		log.Printf(`{"level":"info","msg":"immutable config changed - rebuilding kafka writer"}`)
-		newWriter, err := kafka.NewWriter(kafka.WriterConfig{
-			Brokers:               newCfg.KafkaBrokers,
-			Topic:                 newCfg.KafkaTopic,
-			RequiredAcks:          newCfg.KafkaRequiredAcks,
-			Balancer:              newCfg.KafkaBalancer,
-			WriteTimeout:          newCfg.KafkaWriteTimeout,
-			BatchTimeout:          newCfg.KafkaBatchTimeout,
-			BatchSize:             newCfg.KafkaBatchSize,
-			BatchBytes:            newCfg.KafkaBatchBytes,
-			SASLEnabled:           newCfg.KafkaSASLEnabled,
-			SASLMechanism:         newCfg.KafkaSASLMechanism,
-			SASLUsername:          newCfg.KafkaSASLUsername,
-			SASLPassword:          newCfg.KafkaSASLPassword,
-			TLSEnabled:            newCfg.KafkaTLSEnabled,
-			TLSInsecureSkipVerify: newCfg.KafkaTLSInsecureSkipVerify,
-			TLSCAFile:             newCfg.KafkaTLSCAFile,
-		})
+		slog.Info("immutable config changed - rebuilding kafka writer")
+		newWriter, err = newKafkaWriter(newCfg)
 		if err != nil {
 			return fmt.Errorf("rebuild writer: %w", err)
 		}
-		oldWriter := s.kWriter
-		s.kWriter = newWriter
-		_ = oldWriter.Close()
-		// metrics registry: if tenant label setting changed, we cannot swap safely without restart
-		if oldImmutable.MetricsEnableTenantLabel != newImmutable.MetricsEnableTenantLabel {
-			log.Printf(`{"level":"warn","msg":"metrics_enable_tenant_label change requires restart to take effect"}`)
+	}
+
+	if listenerChanged(s.cfg, newCfg) {
+		if err := s.swapListenerLocked(newCfg); err != nil {
+			if newWriter != nil {
+				_ = newWriter.Close()
+			}
+			return err
 		}
 	}
 
+	if newWriter != nil {
+		// Requests already writing keep the old writer until they finish
+		s.swapWriterLocked(newWriter, newCfg.KafkaWriterDrainTimeout)
+	}
+
+	if accessLogChanged(s.cfg, newCfg) {
+		// Lines still being written finish on the old logger, closed once
+		// they are done
+		old := s.accessLogger
+		s.accessLogger = newAccessLogger(newCfg)
+		go old.Close()
+	}
+
 	// Replace cfg
 	s.cfg = newCfg
 	s.buildRateLimitersLocked()
+	s.buildConcurrencyLimiterLocked()
+	s.buildMemoryBudgetLocked()
+	s.sampler = logging.NewSampler(newCfg.LogSampleInterval, newCfg.LogSampleBurst)
+	// Validated by config.Parse, the error cannot happen here
+	_ = logging.SetLevel(newCfg.LogLevel, newCfg.Quiet)
+
+	s.metrics.SetTenantLabel(newCfg.MetricsEnableTenantLabel, newCfg.MetricsTenantMaxSeries)
+	s.metrics.SetConfigHash(newCfg.Hash)
 
-	log.Printf(`{"level":"info","msg":"reload applied","port":%q,"balancer":%q,"acks":%d}`, newCfg.Port, newCfg.KafkaBalancer, newCfg.KafkaRequiredAcks)
+	slog.Info("reload applied", "source", ev.Source, "config_hash", newCfg.Hash, "old_config_hash", ev.OldHash, "diff", ev.Diff)
 	return nil
 }
 
@@ -251,7 +472,7 @@ func (s *Server) reloadHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "use POST", http.StatusMethodNotAllowed)
 		return
 	}
-	if err := s.Reload(); err != nil {
+	if err := s.Reload(ReloadSourceHTTP); err != nil {
 		http.Error(w, "reload failed: "+err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -263,6 +484,20 @@ type resultRecorder struct {
 	http.ResponseWriter
 	status int
 	result string
+
+	// filled by handlePush for the access log
+	tenant    string
+	bytes     int
+	kafkaMs   float64
+	requestID string
+
+	// value written to Kafka on success; the converted push, not the body,
+	// for endpoints that convert
+	writtenBytes int
+
+	// filled by endpoints that decode the payload, for usage accounting
+	lines   int
+	streams int
 }
 
 func (r *resultRecorder) WriteHeader(code int) {
@@ -273,23 +508,46 @@ func (r *resultRecorder) WriteHeader(code int) {
 func (s *Server) wrapRequest(endpoint string, fn http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		rr := &resultRecorder{ResponseWriter: w}
-		fn(rr, r)
-		result := rr.result
-		if result == "" {
-			switch {
-			case rr.status >= 500:
-				result = "error"
-			case rr.status >= 400:
-				result = "client_error"
-			case rr.status == 0 || (rr.status >= 200 && rr.status < 300):
-				result = "success"
-			default:
-				result = "other"
-			}
+		// Continue the caller's trace if a traceparent header was sent
+		ctx := tracing.ExtractHTTP(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Tracer().Start(ctx, "POST "+endpoint, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+		rr, ok := w.(*resultRecorder)
+		if !ok {
+			rr = &resultRecorder{ResponseWriter: w}
+		}
+		fn(rr, r.WithContext(ctx))
+		result := s.finishRequest(endpoint, rr, start)
+		span.SetAttributes(attribute.String("http.route", endpoint), attribute.Int("http.response.status_code", rr.status), attribute.String("result", result))
+		if result != "success" {
+			span.SetStatus(codes.Error, result)
+		}
+	}
+}
+
+// finishRequest settles the result of an ingest request (derived from the
+// status when the handler set none) and feeds usage, SLOs and the duration
+// histogram.
+func (s *Server) finishRequest(endpoint string, rr *resultRecorder, start time.Time) string {
+	result := rr.result
+	if result == "" {
+		switch {
+		case rr.status >= 500:
+			result = "error"
+		case rr.status >= 400:
+			result = "client_error"
+		case rr.status == 0 || (rr.status >= 200 && rr.status < 300):
+			result = "success"
+		default:
+			result = "other"
 		}
-		s.metrics.RequestDurationHist.WithLabelValues(endpoint, result).Observe(time.Since(start).Seconds())
 	}
+	rr.result = result
+	dur := time.Since(start)
+	s.recordUsage(rr)
+	s.observeSLO(rr, dur)
+	s.metrics.RequestDurationHist.WithLabelValues(endpoint, result).Observe(dur.Seconds())
+	return result
 }
 
 func classifyContentType(ct string) string {
@@ -306,154 +564,17 @@ func classifyContentType(ct string) string {
 	return "other"
 }
 
-func (s *Server) handlePush(w http.ResponseWriter, r *http.Request) {
-	rr, _ := w.(*resultRecorder)
-
-	s.mu.RLock()
-	cfg := s.cfg
-	globalLimiter := s.globalLimiter
-	tenantLimiters := s.tenantLimiters
-	kWriter := s.kWriter
-	s.mu.RUnlock()
-
-	tenant := r.Header.Get("X-Scope-OrgID")
-	if tenant == "" {
-		if cfg.AllowEmptyTenant {
-			tenant = cfg.DefaultTenant
-		} else {
-			http.Error(w, "Missing X-Scope-OrgID", http.StatusBadRequest)
-			if rr != nil {
-				rr.result = "missing_tenant"
-			}
-			s.metrics.RequestsTotal.WithLabelValues(s.metrics.MakeRequestLabels(r.URL.Path, "missing_tenant", "other", tenant)...).Inc()
-			s.metrics.TrackResult(false, true)
-			s.jsonLog("warn", "missing tenant", map[string]any{"endpoint": r.URL.Path})
-			return
-		}
-	}
-
-	// Rate limit
-	if cfg.RateLimitEnabled {
-		if globalLimiter != nil && !globalLimiter.lim.Allow() {
-			s.metrics.RateLimitedTotal.WithLabelValues("global").Inc()
-			http.Error(w, "rate limited (global)", http.StatusTooManyRequests)
-			if rr != nil {
-				rr.result = "rate_limited"
-			}
-			s.metrics.RequestsTotal.WithLabelValues(s.metrics.MakeRequestLabels(r.URL.Path, "rate_limited", "other", tenant)...).Inc()
-			s.metrics.TrackResult(false, true)
-			s.jsonLog("warn", "rate limited global", map[string]any{"tenant": tenant})
-			return
-		}
-		if tenantLimiters != nil {
-			if lim := tenantLimiters.get(tenant); !lim.Allow() {
-				s.metrics.RateLimitedTotal.WithLabelValues("tenant").Inc()
-				http.Error(w, "rate limited (tenant)", http.StatusTooManyRequests)
-				if rr != nil {
-					rr.result = "rate_limited"
-				}
-				s.metrics.RequestsTotal.WithLabelValues(s.metrics.MakeRequestLabels(r.URL.Path, "rate_limited", "other", tenant)...).Inc()
-				s.metrics.TrackResult(false, true)
-				s.jsonLog("warn", "rate limited tenant", map[string]any{"tenant": tenant})
-				return
-			}
-		}
-	}
-
-	ctRaw := r.Header.Get("Content-Type")
-	ctClass := classifyContentType(ctRaw)
-
-	limited := http.MaxBytesReader(w, r.Body, cfg.MaxBodyBytes)
-	body, err := io.ReadAll(limited)
-	r.Body.Close()
-	if err != nil {
-		res := "bad_request"
-		msg := strings.ToLower(err.Error())
-		if strings.Contains(msg, "request body too large") {
-			res = "too_large"
-		}
-		http.Error(w, res, http.StatusBadRequest)
-		if rr != nil {
-			rr.result = res
-		}
-		s.metrics.RequestsTotal.WithLabelValues(s.metrics.MakeRequestLabels(r.URL.Path, res, ctClass, tenant)...).Inc()
-		s.metrics.TrackResult(false, true)
-		s.jsonLog("warn", "read error", map[string]any{"tenant": tenant, "error": err.Error(), "result": res})
-		return
-	}
-
-	size := len(body)
-	s.metrics.RequestBytesTotal.WithLabelValues(s.metrics.MakeRequestBytesLabels(r.URL.Path, tenant)...).Add(float64(size))
-
-	// Kafka message
-	var headers []kafkago.Header
-	headers = append(headers, kafkago.Header{Key: "X-Scope-OrgID", Value: []byte(tenant)})
-	if ctRaw != "" {
-		headers = append(headers, kafkago.Header{Key: "Content-Type", Value: []byte(ctRaw)})
-	}
-	if ce := r.Header.Get("Content-Encoding"); ce != "" {
-		headers = append(headers, kafkago.Header{Key: "Content-Encoding", Value: []byte(ce)})
-	}
-	msg := kafkago.Message{
-		Value:   body,
-		Time:    time.Now(),
-		Headers: headers,
-	}
-	if cfg.KafkaBalancer == "hash" {
-		msg.Key = []byte(tenant)
-	}
-
-	kafkaStart := time.Now()
-	writeCtx, cancel := context.WithTimeout(r.Context(), cfg.KafkaWriteTimeout)
-	err = kWriter.Write(writeCtx, msg)
-	cancel()
-	kafkaDur := time.Since(kafkaStart).Seconds()
-
-	if err != nil {
-		errType := classifyKafkaError(err)
-		s.metrics.KafkaWriteErrorsTotal.WithLabelValues(errType).Inc()
-		s.metrics.KafkaWriteDurationHist.WithLabelValues("error").Observe(kafkaDur)
-		http.Error(w, "kafka write failed", http.StatusServiceUnavailable)
-		if rr != nil {
-			rr.result = "kafka_error"
-		}
-		s.metrics.RequestsTotal.WithLabelValues(s.metrics.MakeRequestLabels(r.URL.Path, "kafka_error", ctClass, tenant)...).Inc()
-		s.metrics.TrackResult(false, true)
-		s.consecutiveErrors++
-		s.metrics.KafkaConsecutiveErrors.Set(float64(s.consecutiveErrors))
-		s.jsonLog("warn", "kafka write failed", map[string]any{
-			"tenant": tenant, "bytes": size, "kafka_ms": kafkaDur * 1000,
-			"error": err.Error(), "error_type": errType,
-		})
-		return
-	}
-
-	// Success
-	s.consecutiveErrors = 0
-	s.metrics.KafkaConsecutiveErrors.Set(0)
-	s.metrics.KafkaWriteDurationHist.WithLabelValues("success").Observe(kafkaDur)
-	w.WriteHeader(http.StatusNoContent)
-	if rr != nil {
-		rr.result = "success"
-	}
-	s.metrics.RequestsTotal.WithLabelValues(s.metrics.MakeRequestLabels(r.URL.Path, "success", ctClass, tenant)...).Inc()
-	s.metrics.TrackResult(true, false)
-
-	if !cfg.Quiet {
-		s.jsonLog("info", "accepted", map[string]any{
-			"tenant": tenant, "bytes": size, "kafka_ms": kafkaDur * 1000,
-			"endpoint": r.URL.Path,
-		})
-	}
-}
-
 func (s *Server) healthLoop() {
 	ticker := time.NewTicker(s.cfg.HealthEvalPeriod)
 	defer ticker.Stop()
+	rankTicker := time.NewTicker(metrics.TenantRankInterval)
+	defer rankTicker.Stop()
 	s.prevTotal, s.prevSuccess, s.prevErrors = s.metrics.Snapshot()
 
 	for {
 		select {
+		case <-rankTicker.C:
+			s.metrics.RankTenants()
 		case <-ticker.C:
 			totalNow, succNow, errNow := s.metrics.Snapshot()
 			dTotal := totalNow - s.prevTotal
@@ -467,6 +588,7 @@ func (s *Server) healthLoop() {
 			cfg := s.cfg
 			s.mu.RUnlock()
 
+			s.evaluateSLO(cfg)
 			if dTotal > 0 {
 				errorRate := float64(dErr) / float64(dTotal)
 				if cfg.SLAGaugeEnable {
@@ -480,6 +602,9 @@ func (s *Server) healthLoop() {
 				if s.consecutiveErrors >= cfg.HealthConsecutiveErrorThreshold {
 					unhealthy = true
 				}
+				if s.sloPaging.Load() {
+					unhealthy = true
+				}
 				if unhealthy {
 					s.metrics.HealthUp.Set(0)
 				} else {
@@ -495,7 +620,8 @@ func (s *Server) healthLoop() {
 func (s *Server) isHealthy() bool {
 	// Simple read of gauge by internal state; we trust metrics.HealthUp
 	// (We could track a bool instead; for now assume if consecutiveErrors high or set gauge).
-	return s.metrics != nil
+	// With slo_readiness a firing availability page rule takes the pod out.
+	return s.metrics != nil && !s.sloPaging.Load()
 }
 
 // kafkaProbe attempts to connect and optionally write a tiny test message.
@@ -509,7 +635,7 @@ func (s *Server) kafkaProbe(ctx context.Context) error {
 	}
 	_ = conn.Close()
 	// Log success of dial
-	s.jsonLog("info", "kafka probe dial ok", map[string]any{"broker": addr})
+	slog.Info("kafka probe dial ok", "broker", addr)
 
 	// 2) Optional produce check (auth/ACL/topic end-to-end)
 	if !s.cfg.KafkaProbeWrite {
@@ -517,14 +643,7 @@ func (s *Server) kafkaProbe(ctx context.Context) error {
 	}
 
 	// Prepare producer identity
-	podName := os.Getenv("POD_NAME")
-	if podName == "" {
-		if hn, _ := os.Hostname(); hn != "" {
-			podName = hn
-		} else {
-			podName = "unknown"
-		}
-	}
+	podName := podName()
 	ns := os.Getenv("POD_NAMESPACE")
 	if ns == "" {
 		ns = "default"
@@ -554,30 +673,44 @@ func (s *Server) kafkaProbe(ctx context.Context) error {
 	for _, h := range headers {
 		headerKeys = append(headerKeys, h.Key)
 	}
-	s.jsonLog("info", "kafka probe write attempt", map[string]any{
-		"topic":            s.cfg.KafkaTopic,
-		"headers":          headerKeys,
-		"balancer":         s.cfg.KafkaBalancer,
-		"required_acks":    s.cfg.KafkaRequiredAcks,
-		"sasl_enabled":     s.cfg.KafkaSASLEnabled,
-		"sasl_mechanism":   s.cfg.KafkaSASLMechanism,
-		"tls_enabled":      s.cfg.KafkaTLSEnabled,
-		"probe_timeout_ms": s.cfg.KafkaProbeTimeout.Milliseconds(),
-	})
+	slog.Info("kafka probe write attempt",
+		"topic", s.cfg.KafkaTopic,
+		"headers", headerKeys,
+		"balancer", s.cfg.KafkaBalancer,
+		"required_acks", s.cfg.KafkaRequiredAcks,
+		"sasl_enabled", s.cfg.KafkaSASLEnabled,
+		"sasl_mechanism", s.cfg.KafkaSASLMechanism,
+		"tls_enabled", s.cfg.KafkaTLSEnabled,
+		"probe_timeout_ms", s.cfg.KafkaProbeTimeout.Milliseconds(),
+	)
 
 	wctx, cancel := context.WithTimeout(ctx, s.cfg.KafkaProbeTimeout)
 	defer cancel()
-	if err := s.kWriter.Write(wctx, msg); err != nil {
+	gen := s.acquireWriter()
+	_, err = gen.Write(wctx, msg)
+	gen.release()
+	if err != nil {
 		return fmt.Errorf("probe write to topic %q failed: %w", s.cfg.KafkaTopic, err)
 	}
 	// Log success of write
-	s.jsonLog("info", "kafka probe write ok", map[string]any{
-		"topic":      s.cfg.KafkaTopic,
-		"timeout_ms": s.cfg.KafkaProbeTimeout.Milliseconds(),
-	})
+	slog.Info("kafka probe write ok",
+		"topic", s.cfg.KafkaTopic,
+		"timeout_ms", s.cfg.KafkaProbeTimeout.Milliseconds(),
+	)
 	return nil
 }
 
+// podName identifies this instance: POD_NAME, else the hostname.
+func podName() string {
+	if name := os.Getenv("POD_NAME"); name != "" {
+		return name
+	}
+	if hn, _ := os.Hostname(); hn != "" {
+		return hn
+	}
+	return "unknown"
+}
+
 func classifyKafkaError(err error) string {
 	if errors.Is(err, context.DeadlineExceeded) {
 		return "timeout"
@@ -608,14 +741,19 @@ func classifyKafkaError(err error) string {
 	}
 }
 
-func (s *Server) jsonLog(level, msg string, kv map[string]any) {
-	kv["level"] = level
-	kv["msg"] = msg
-	kv["ts"] = time.Now().UTC().Format(time.RFC3339Nano)
-	b, err := json.Marshal(kv)
-	if err != nil {
-		log.Printf(`{"level":"error","msg":"log marshal failed","error":%q}`, err.Error())
+// warnSampled logs a repetitive warning at most log_sample_burst times per
+// log_sample_interval for key; the next line that passes carries the number
+// of dropped lines.
+func (s *Server) warnSampled(key, msg string, args ...any) {
+	s.mu.RLock()
+	sampler := s.sampler
+	s.mu.RUnlock()
+	ok, dropped := sampler.Allow(key)
+	if !ok {
 		return
 	}
-	log.Println(string(b))
+	if dropped > 0 {
+		args = append(args, "suppressed", dropped)
+	}
+	slog.Warn(msg, args...)
 }
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/config"
+	"github.com/DeveloperDarkhan/loki-producer/internal/slo"
+)
+
+// observeSLO counts a finished request. Client errors (4xx: bad payload,
+// missing tenant, rate limited) are outside the SLOs; server-side errors
+// burn the availability budget and successful requests slower than
+// slo_latency_threshold burn the latency budget.
+func (s *Server) observeSLO(rr *resultRecorder, dur time.Duration) {
+	if s.slo == nil {
+		return
+	}
+	status := rr.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status >= 400 && status < 500 {
+		return
+	}
+	s.mu.RLock()
+	threshold := s.cfg.SLOLatencyThreshold
+	s.mu.RUnlock()
+	ok := status < 500 && rr.result != "kafka_error"
+	s.slo.Observe(time.Now(), ok, dur > threshold)
+}
+
+// evaluateSLO exports burn rates and budgets and, with slo_readiness,
+// reports whether the availability page rule fires.
+func (s *Server) evaluateSLO(cfg *config.Config) {
+	if s.slo == nil {
+		return
+	}
+	st := s.slo.Evaluate(time.Now(), slo.Objectives{
+		Availability: cfg.SLOAvailabilityObjective,
+		Latency:      cfg.SLOLatencyObjective,
+		MinRequests:  uint64(cfg.SLOMinRequests),
+	})
+	for name, v := range st {
+		s.metrics.SLOObjective.WithLabelValues(name).Set(v.Objective)
+		s.metrics.SLOErrorBudgetRemaining.WithLabelValues(name).Set(v.BudgetRemaining)
+		for window, rate := range v.BurnRates {
+			s.metrics.SLOBurnRate.WithLabelValues(name, window).Set(rate)
+		}
+		for severity, firing := range v.Firing {
+			val := 0.0
+			if firing {
+				val = 1
+			}
+			s.metrics.SLOAlertFiring.WithLabelValues(name, severity).Set(val)
+		}
+	}
+	s.sloPaging.Store(cfg.SLOReadiness && st[slo.Availability].Firing["page"])
+}
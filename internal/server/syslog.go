@@ -0,0 +1,318 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/config"
+	"github.com/DeveloperDarkhan/loki-producer/internal/logproto"
+	"github.com/DeveloperDarkhan/loki-producer/internal/syslog"
+	"github.com/DeveloperDarkhan/loki-producer/internal/tracing"
+)
+
+// syslogEndpoint is the endpoint label of pushes built from syslog messages.
+const syslogEndpoint = "syslog"
+
+// syslogListener receives syslog messages on one socket and pushes them in
+// batches for the listener's tenant, through push like any HTTP push.
+type syslogListener struct {
+	s          *Server
+	cfg        config.SyslogListener
+	batchSize  int
+	batchBytes int
+	batchWait  time.Duration
+	maxMessage int
+
+	ln net.Listener   // tcp
+	pc net.PacketConn // udp
+
+	connMu sync.Mutex
+	conns  map[net.Conn]struct{}
+	wg     sync.WaitGroup
+	done   chan struct{}
+
+	mu    sync.Mutex
+	batch *logproto.Batch
+}
+
+func newSyslogListeners(s *Server, cfg *config.Config) []*syslogListener {
+	out := make([]*syslogListener, 0, len(cfg.SyslogListeners))
+	for _, lc := range cfg.SyslogListeners {
+		out = append(out, &syslogListener{
+			s:         s,
+			cfg:       lc,
+			batchSize: cfg.SyslogBatchSize,
+			// A batch is one Kafka record, so it is cut where even
+			// incompressible lines still fit one
+			batchBytes: batchLimit(cfg),
+			batchWait:  cfg.SyslogBatchWait,
+			maxMessage: cfg.SyslogMaxMessageBytes,
+			conns:      make(map[net.Conn]struct{}),
+			done:       make(chan struct{}),
+			batch:      &logproto.Batch{},
+		})
+	}
+	return out
+}
+
+// start binds the socket and serves it until stop.
+func (l *syslogListener) start() error {
+	var err error
+	if l.cfg.Protocol == "udp" {
+		l.pc, err = net.ListenPacket("udp", l.cfg.Address)
+	} else {
+		l.ln, err = net.Listen("tcp", l.cfg.Address)
+	}
+	if err != nil {
+		return fmt.Errorf("syslog listener %s: %w", l.cfg.Name, err)
+	}
+	slog.Info("syslog listening", "listener", l.cfg.Name, "protocol", l.cfg.Protocol, "address", l.cfg.Address, "tenant", l.cfg.Tenant)
+	l.wg.Add(2)
+	go l.flushLoop()
+	if l.pc != nil {
+		go l.serveUDP()
+	} else {
+		go l.serveTCP()
+	}
+	return nil
+}
+
+// stop closes the socket and open connections, then pushes what is left.
+func (l *syslogListener) stop() {
+	if l.pc != nil {
+		_ = l.pc.Close()
+	}
+	if l.ln != nil {
+		_ = l.ln.Close()
+	}
+	l.connMu.Lock()
+	for c := range l.conns {
+		_ = c.Close()
+	}
+	l.connMu.Unlock()
+	close(l.done)
+	l.wg.Wait()
+	if b := l.take(); b != nil {
+		l.flush(b)
+	}
+}
+
+func (l *syslogListener) serveTCP() {
+	defer l.wg.Done()
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			slog.Warn("syslog accept failed", "listener", l.cfg.Name, "error", err.Error())
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		l.connMu.Lock()
+		l.conns[conn] = struct{}{}
+		l.connMu.Unlock()
+		l.wg.Add(1)
+		go l.serveConn(conn)
+	}
+}
+
+func (l *syslogListener) serveConn(conn net.Conn) {
+	active := l.s.metrics.SyslogConnectionsActive.WithLabelValues(l.cfg.Name)
+	active.Inc()
+	defer func() {
+		active.Dec()
+		l.connMu.Lock()
+		delete(l.conns, conn)
+		l.connMu.Unlock()
+		_ = conn.Close()
+		l.wg.Done()
+	}()
+	r := syslog.NewReader(conn, l.maxMessage)
+	for {
+		msg, err := r.Next()
+		if errors.Is(err, syslog.ErrTooLong) {
+			l.count("too_long", 1)
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				l.s.warnSampled("syslog read error|"+l.cfg.Name, "syslog read error", "listener", l.cfg.Name, "remote", conn.RemoteAddr().String(), "error", err.Error())
+			}
+			return
+		}
+		l.receive(msg)
+	}
+}
+
+// serveUDP takes every datagram as one message.
+func (l *syslogListener) serveUDP() {
+	defer l.wg.Done()
+	buf := make([]byte, l.maxMessage+1)
+	for {
+		n, _, err := l.pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			slog.Warn("syslog read failed", "listener", l.cfg.Name, "error", err.Error())
+			continue
+		}
+		if n > l.maxMessage {
+			l.count("too_long", 1)
+			continue
+		}
+		l.receive(bytes.TrimRight(buf[:n], "\r\n\x00"))
+	}
+}
+
+// receive parses a message and adds it to the batch, pushing the batch when
+// it is full: syslog_batch_size lines, or the next line would take its
+// encoding over batchBytes. A line that cannot fit a batch on its own is
+// dropped as too long.
+func (l *syslogListener) receive(raw []byte) {
+	now := time.Now()
+	m, err := syslog.Parse(raw, now, time.Local)
+	if err != nil {
+		l.count("invalid", 1)
+		l.s.warnSampled("syslog invalid|"+l.cfg.Name, "invalid syslog message", "listener", l.cfg.Name, "error", err.Error())
+		return
+	}
+	ts := m.Timestamp
+	if ts.IsZero() {
+		ts = now
+	}
+	labels, meta := l.labels(m)
+	e := logproto.Entry{Timestamp: ts, Line: m.Message, StructuredMetadata: meta}
+	if (&logproto.Batch{}).SizeWith(labels, &e) > l.batchBytes {
+		l.count("too_long", 1)
+		return
+	}
+
+	l.mu.Lock()
+	var full *logproto.Batch
+	if l.batch.SizeWith(labels, &e) > l.batchBytes {
+		full = l.takeLocked()
+	}
+	l.batch.Add(labels, e)
+	if full == nil && l.batch.Lines >= l.batchSize {
+		full = l.takeLocked()
+	}
+	l.mu.Unlock()
+	if full != nil {
+		l.flush(full)
+	}
+}
+
+// labels maps hostname, app name, facility and severity to stream labels
+// and the remaining header fields and structured data to metadata.
+func (l *syslogListener) labels(m syslog.Message) (string, []logproto.LabelPair) {
+	labels := make([]logproto.LabelPair, 0, len(l.cfg.Labels)+4)
+	for k, v := range l.cfg.Labels {
+		labels = append(labels, logproto.LabelPair{Name: k, Value: v})
+	}
+	if m.Hostname != "" {
+		labels = append(labels, logproto.LabelPair{Name: "hostname", Value: m.Hostname})
+	}
+	if m.AppName != "" {
+		labels = append(labels, logproto.LabelPair{Name: "app", Value: m.AppName})
+	}
+	labels = append(labels,
+		logproto.LabelPair{Name: "facility", Value: syslog.FacilityName(m.Facility)},
+		logproto.LabelPair{Name: "severity", Value: syslog.SeverityName(m.Severity)},
+	)
+
+	var meta []logproto.LabelPair
+	if m.ProcID != "" {
+		meta = append(meta, logproto.LabelPair{Name: "procid", Value: m.ProcID})
+	}
+	if m.MsgID != "" {
+		meta = append(meta, logproto.LabelPair{Name: "msgid", Value: m.MsgID})
+	}
+	for _, p := range m.StructuredData {
+		meta = append(meta, logproto.LabelPair{Name: logproto.SanitizeLabelName(p.ID + "_" + p.Name), Value: p.Value})
+	}
+	return logproto.LabelsString(labels), meta
+}
+
+func (l *syslogListener) flushLoop() {
+	defer l.wg.Done()
+	t := time.NewTicker(l.batchWait)
+	defer t.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-t.C:
+			if b := l.take(); b != nil {
+				l.flush(b)
+			}
+		}
+	}
+}
+
+func (l *syslogListener) take() *logproto.Batch {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.takeLocked()
+}
+
+func (l *syslogListener) takeLocked() *logproto.Batch {
+	if l.batch.Lines == 0 {
+		return nil
+	}
+	b := l.batch
+	l.batch = &logproto.Batch{}
+	return b
+}
+
+// flush pushes a batch. Rejected batches are dropped: syslog senders have
+// no way to retry them.
+func (l *syslogListener) flush(b *logproto.Batch) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(context.Background(), "syslog "+l.cfg.Name)
+	defer span.End()
+
+	conv := encodePush(b)
+	rr := &resultRecorder{requestID: newRequestID(), lines: conv.lines, streams: conv.streams}
+	reply := l.s.push(ctx, pushInput{
+		endpoint:      syslogEndpoint,
+		tenant:        l.cfg.Tenant,
+		contentType:   convertedContentType,
+		contentLength: int64(len(conv.payload.B)),
+		payload:       conv.payload,
+	}, rr)
+	rr.status = reply.status
+	result := l.s.finishRequest(syslogEndpoint, rr, start)
+
+	l.s.logAccess(syslogEndpoint, "", "", rr, time.Since(start))
+
+	span.SetAttributes(
+		attribute.String("syslog.listener", l.cfg.Name),
+		attribute.Int("lines", conv.lines),
+		attribute.String("result", result),
+	)
+	if reply.status != http.StatusNoContent {
+		span.SetStatus(codes.Error, result)
+		l.count("dropped", conv.lines)
+		l.s.warnSampled("syslog batch dropped|"+l.cfg.Name+"|"+reply.result, "syslog batch dropped",
+			"listener", l.cfg.Name, "tenant", l.cfg.Tenant, "lines", conv.lines, "result", reply.result)
+		return
+	}
+	l.count("success", conv.lines)
+}
+
+func (l *syslogListener) count(result string, n int) {
+	l.s.metrics.SyslogMessagesTotal.WithLabelValues(l.cfg.Name, result).Add(float64(n))
+}
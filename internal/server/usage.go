@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/config"
+	"github.com/DeveloperDarkhan/loki-producer/internal/kafka"
+	"github.com/DeveloperDarkhan/loki-producer/internal/usage"
+)
+
+// usagePublishTimeout bounds one batch of usage records.
+const usagePublishTimeout = 10 * time.Second
+
+// newUsageWriter returns a writer for usage_kafka_topic with the same
+// brokers and auth as the log writer, or nil when publishing is disabled.
+func newUsageWriter(cfg *config.Config) (*kafka.Writer, error) {
+	if !cfg.UsageEnabled || cfg.UsageKafkaTopic == "" {
+		return nil, nil
+	}
+	uc := *cfg
+	uc.KafkaTopic = cfg.UsageKafkaTopic
+	uc.KafkaBalancer = "hash" // records of one tenant stay in order
+	uc.KafkaMetadataRefreshInterval = 0
+	return newKafkaWriter(&uc)
+}
+
+// recordUsage accounts a finished ingest request. Requests without a tenant
+// are not billable and are skipped.
+func (s *Server) recordUsage(rr *resultRecorder) {
+	if s.usage == nil || rr.tenant == "" {
+		return
+	}
+	ev := usage.Event{
+		Result:        rr.result,
+		BytesReceived: rr.bytes,
+		Lines:         rr.lines,
+		Streams:       rr.streams,
+		BytesWritten:  rr.writtenBytes,
+	}
+	s.usage.Record(rr.tenant, ev)
+}
+
+// usageHandler serves per-tenant usage; ?tenant= limits it to one tenant.
+func (s *Server) usageHandler(w http.ResponseWriter, r *http.Request) {
+	if s.usage == nil {
+		http.Error(w, "usage accounting disabled", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(s.usage.Report(r.URL.Query().Get("tenant")))
+}
+
+// usageRecord is the value of a message on usage_kafka_topic.
+type usageRecord struct {
+	usage.Record
+	Instance string `json:"instance"`
+}
+
+// publishUsage writes the usage accumulated in each interval to the usage
+// topic, one record per active tenant. The last interval is flushed on Stop.
+func (s *Server) publishUsage(interval time.Duration) {
+	defer close(s.usageDone)
+	defer s.usageWriter.Close()
+	instance := podName()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flushUsage(instance)
+		case <-s.stopUsage:
+			s.flushUsage(instance)
+			return
+		}
+	}
+}
+
+func (s *Server) flushUsage(instance string) {
+	recs := s.usage.Drain()
+	if len(recs) == 0 {
+		return
+	}
+	msgs := make([]kafkago.Message, 0, len(recs))
+	sent := recs[:0]
+	for _, rec := range recs {
+		b, err := json.Marshal(usageRecord{Record: rec, Instance: instance})
+		if err != nil {
+			continue
+		}
+		sent = append(sent, rec)
+		msgs = append(msgs, kafkago.Message{
+			Key:     []byte(rec.Tenant),
+			Value:   b,
+			Time:    rec.End,
+			Headers: []kafkago.Header{{Key: "Content-Type", Value: []byte("application/json")}},
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), usagePublishTimeout)
+	defer cancel()
+	if err := s.usageWriter.WriteBatch(ctx, msgs...); err != nil {
+		// Failed records are published again with the next interval, merged
+		// into its records; the final flush on Stop has no next interval
+		failed := sent
+		var werrs kafkago.WriteErrors
+		if errors.As(err, &werrs) && len(werrs) == len(sent) {
+			failed = nil
+			for i, e := range werrs {
+				if e != nil {
+					failed = append(failed, sent[i])
+				}
+			}
+		}
+		s.usage.Restore(failed)
+		s.metrics.UsageRecordsPublishedTotal.Add(float64(len(msgs) - len(failed)))
+		s.metrics.UsagePublishErrorsTotal.Inc()
+		s.warnSampled("usage publish failed", "usage publish failed", "records", len(msgs), "error", err.Error())
+		return
+	}
+	s.metrics.UsageRecordsPublishedTotal.Add(float64(len(msgs)))
+}
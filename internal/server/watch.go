@@ -0,0 +1,90 @@
+package server
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/config"
+)
+
+// watchConfig reloads the config when cfgFile changes on disk. The parent
+// directory is watched rather than the file: Kubernetes updates a mounted
+// ConfigMap by atomically swapping the "..data" symlink, which never touches
+// the config.yaml symlink itself. Events are debounced and the file content
+// hash is compared, so the several events of one swap trigger at most one
+// reload and touches without content changes trigger none.
+func (s *Server) watchConfig(debounce time.Duration) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.Error("config watch init failed", "error", err.Error())
+		return
+	}
+	defer w.Close()
+
+	dir := filepath.Dir(s.cfgFile)
+	base := filepath.Base(s.cfgFile)
+	if err := w.Add(dir); err != nil {
+		slog.Error("config watch failed", "dir", dir, "error", err.Error())
+		return
+	}
+	slog.Info("watching config", "file", s.cfgFile, "debounce", debounce.String())
+
+	var timer *time.Timer
+	var fire <-chan time.Time
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			name := filepath.Base(ev.Name)
+			if name != base && name != "..data" {
+				continue
+			}
+			if timer == nil {
+				timer = time.NewTimer(debounce)
+			} else {
+				// Drain a fire not received yet, or it would
+				// reload right away instead of after debounce
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(debounce)
+			}
+			fire = timer.C
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("config watch error", "error", err.Error())
+		case <-fire:
+			fire = nil
+			raw, err := os.ReadFile(s.cfgFile)
+			if err != nil {
+				slog.Warn("config watch read failed", "file", s.cfgFile, "error", err.Error())
+				continue
+			}
+			s.mu.RLock()
+			unchanged := config.Hash(raw) == s.cfg.FileHash
+			s.mu.RUnlock()
+			if unchanged {
+				continue
+			}
+			if err := s.Reload(ReloadSourceWatch); err != nil {
+				slog.Error("reload failed", "source", ReloadSourceWatch, "error", err.Error())
+			}
+		case <-s.stopWatch:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/DeveloperDarkhan/loki-producer/internal/config"
+	"github.com/DeveloperDarkhan/loki-producer/internal/kafka"
+)
+
+// writerGen is one generation of the Kafka writer. Requests acquire the
+// current generation under s.mu and release it after the write, so a writer
+// replaced by reload is only closed once its in-flight writes are done.
+type writerGen struct {
+	*kafka.Writer
+	gen      uint64
+	inflight sync.WaitGroup
+}
+
+func newKafkaWriter(cfg *config.Config) (*kafka.Writer, error) {
+	return kafka.NewWriter(kafka.WriterConfig{
+		Brokers:                 cfg.KafkaBrokers,
+		Topic:                   cfg.KafkaTopic,
+		RequiredAcks:            cfg.KafkaRequiredAcks,
+		Balancer:                cfg.KafkaBalancer,
+		WriteTimeout:            cfg.KafkaWriteTimeout,
+		BatchTimeout:            cfg.KafkaBatchTimeout,
+		BatchSize:               cfg.KafkaBatchSize,
+		BatchBytes:              cfg.KafkaBatchBytes,
+		MetadataRefreshInterval: cfg.KafkaMetadataRefreshInterval,
+		SASLEnabled:             cfg.KafkaSASLEnabled,
+		SASLMechanism:           cfg.KafkaSASLMechanism,
+		SASLUsername:            cfg.KafkaSASLUsername,
+		SASLPassword:            cfg.KafkaSASLPassword,
+		TLSEnabled:              cfg.KafkaTLSEnabled,
+		TLSInsecureSkipVerify:   cfg.KafkaTLSInsecureSkipVerify,
+		TLSCAFile:               cfg.KafkaTLSCAFile,
+	})
+}
+
+// acquireWriter returns the current writer generation; the caller must call
+// release when its write has returned.
+func (s *Server) acquireWriter() *writerGen {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	// Add under the read lock: swapWriterLocked holds the write lock, so no
+	// request can join a generation after it has been handed to drainWriter.
+	s.writer.inflight.Add(1)
+	return s.writer
+}
+
+func (g *writerGen) release() {
+	g.inflight.Done()
+}
+
+// swapWriterLocked makes w the current writer and drains the previous
+// generation in the background. s.mu must be held for writing.
+func (s *Server) swapWriterLocked(w *kafka.Writer, drainTimeout time.Duration) {
+	old := s.writer
+	s.writer = &writerGen{Writer: w, gen: old.gen + 1}
+	s.metrics.KafkaWriterGeneration.Set(float64(s.writer.gen))
+	s.drains.Add(1)
+	go func() {
+		defer s.drains.Done()
+		s.drainWriter(old, drainTimeout)
+	}()
+}
+
+// drainWriter waits for the in-flight writes of g (at most timeout) and
+// closes it. Writes still running at the timeout fail with a closed-writer
+// error.
+func (s *Server) drainWriter(g *writerGen, timeout time.Duration) {
+	s.metrics.KafkaWritersDraining.Inc()
+	defer s.metrics.KafkaWritersDraining.Dec()
+
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		g.inflight.Wait()
+		close(done)
+	}()
+	result := "drained"
+	timer := time.NewTimer(timeout)
+	select {
+	case <-done:
+		timer.Stop()
+	case <-timer.C:
+		result = "timeout"
+	}
+	if err := g.Close(); err != nil {
+		slog.Warn("kafka writer close failed", "generation", g.gen, "error", err.Error())
+	}
+	dur := time.Since(start)
+	s.metrics.KafkaWriterDrainDuration.WithLabelValues(result).Observe(dur.Seconds())
+	if result == "timeout" {
+		slog.Warn("kafka writer drain timed out, closed with writes in flight", "generation", g.gen, "timeout", timeout.String())
+		return
+	}
+	slog.Info("kafka writer drained", "generation", g.gen, "duration_ms", dur.Milliseconds())
+}
@@ -0,0 +1,234 @@
+// Package slo evaluates availability and latency SLOs in-process with
+// multi-window, multi-burn-rate rules (Google SRE workbook, ch. 5), so the
+// pod's own view matches the alerts built on the same windows.
+package slo
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// bucketWidth is the resolution of all windows.
+const bucketWidth = time.Minute
+
+// Window is one alerting rule: it fires when the burn rate over both Long
+// and Short exceeds Factor.
+type Window struct {
+	Long, Short time.Duration
+	Factor      float64
+	Severity    string // page|ticket
+}
+
+// Windows are the workbook's recommended rules for a 30d budget: 2% of the
+// budget in 1h or 5% in 6h pages, 10% in 1d or 3d opens a ticket.
+var Windows = []Window{
+	{Long: time.Hour, Short: 5 * time.Minute, Factor: 14.4, Severity: "page"},
+	{Long: 6 * time.Hour, Short: 30 * time.Minute, Factor: 6, Severity: "page"},
+	{Long: 24 * time.Hour, Short: 2 * time.Hour, Factor: 3, Severity: "ticket"},
+	{Long: 72 * time.Hour, Short: 6 * time.Hour, Factor: 1, Severity: "ticket"},
+}
+
+// SLO names, used as the slo label.
+const (
+	Availability = "availability"
+	Latency      = "latency"
+)
+
+// Objectives are the targets, e.g. 0.999 of requests succeed and 0.99 of
+// successful requests are faster than the latency threshold.
+type Objectives struct {
+	Availability float64
+	Latency      float64
+	MinRequests  uint64 // per window for a rule to fire
+}
+
+type counts struct {
+	total uint64
+	bad   uint64
+	slow  uint64 // among the good ones
+}
+
+func (c *counts) add(o *counts) {
+	c.total += o.total
+	c.bad += o.bad
+	c.slow += o.slow
+}
+
+func (c *counts) sub(o *counts) {
+	c.total -= o.total
+	c.bad -= o.bad
+	c.slow -= o.slow
+}
+
+type bucket struct {
+	idx int64 // time / bucketWidth
+	counts
+}
+
+// Tracker counts requests in one-minute buckets covering the budget window
+// and keeps a running sum per rule window, so neither requests nor
+// evaluations walk the buckets.
+type Tracker struct {
+	mu      sync.Mutex
+	budget  time.Duration
+	buckets []bucket
+	last    int64                 // idx of the newest bucket
+	spans   []int64               // window lengths in buckets
+	sums    []counts              // of the buckets in each window
+	windows map[time.Duration]int // index into spans and sums
+}
+
+// NewTracker keeps enough history for budget and the longest rule window.
+func NewTracker(budget time.Duration) *Tracker {
+	t := &Tracker{budget: budget, windows: make(map[time.Duration]int)}
+	span := budget
+	for _, d := range append([]time.Duration{budget}, ruleWindows()...) {
+		if _, ok := t.windows[d]; ok {
+			continue
+		}
+		t.windows[d] = len(t.spans)
+		t.spans = append(t.spans, int64(d/bucketWidth))
+		if d > span {
+			span = d
+		}
+	}
+	t.sums = make([]counts, len(t.spans))
+	t.buckets = make([]bucket, span/bucketWidth)
+	return t
+}
+
+func ruleWindows() []time.Duration {
+	var out []time.Duration
+	for _, w := range Windows {
+		out = append(out, w.Long, w.Short)
+	}
+	return out
+}
+
+// Observe counts one request that is in scope of the SLOs (client errors
+// are not). ok requests also count toward the latency SLO, as slow or not.
+func (t *Tracker) Observe(now time.Time, ok, slow bool) {
+	c := counts{total: 1}
+	if !ok {
+		c.bad = 1
+	} else if slow {
+		c.slow = 1
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.advanceLocked(now)
+	t.buckets[t.last%int64(len(t.buckets))].add(&c)
+	for i := range t.sums {
+		t.sums[i].add(&c)
+	}
+}
+
+// advanceLocked moves the newest bucket up to now, taking the buckets that
+// leave a window out of its sum. A clock going back counts into the newest
+// bucket.
+func (t *Tracker) advanceLocked(now time.Time) {
+	idx := now.UnixNano() / int64(bucketWidth)
+	if idx <= t.last {
+		return
+	}
+	n := int64(len(t.buckets))
+	if idx-t.last >= n {
+		// Idle for longer than any window: everything expired
+		clear(t.buckets)
+		clear(t.sums)
+		t.last = idx
+		t.buckets[idx%n].idx = idx
+		return
+	}
+	for i := t.last + 1; i <= idx; i++ {
+		for w, span := range t.spans {
+			if b := &t.buckets[(i-span)%n]; b.idx == i-span {
+				t.sums[w].sub(&b.counts)
+			}
+		}
+		t.buckets[i%n] = bucket{idx: i}
+	}
+	t.last = idx
+}
+
+// ratios returns the availability and latency error ratios over d and the
+// requests they are computed from.
+func (t *Tracker) ratios(d time.Duration) (avail, lat float64, total, good uint64) {
+	c := t.sums[t.windows[d]]
+	if c.total > 0 {
+		avail = float64(c.bad) / float64(c.total)
+	}
+	if good = c.total - c.bad; good > 0 {
+		lat = float64(c.slow) / float64(good)
+	}
+	return avail, lat, c.total, good
+}
+
+// Status is the evaluation of one SLO.
+type Status struct {
+	Objective       float64
+	BurnRates       map[string]float64 // by window label, e.g. "1h", "5m"
+	BudgetRemaining float64            // 1 = untouched, <0 = exhausted, over the budget window
+	Firing          map[string]bool    // by severity
+}
+
+// Evaluate computes burn rates, remaining budget and firing rules of both
+// SLOs, keyed by Availability and Latency. A rule only fires when both of
+// its windows hold at least obj.MinRequests requests in scope of the SLO,
+// so a single error on an idle pod does not page.
+func (t *Tracker) Evaluate(now time.Time, obj Objectives) map[string]*Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.advanceLocked(now)
+	out := map[string]*Status{
+		Availability: newStatus(obj.Availability),
+		Latency:      newStatus(obj.Latency),
+	}
+	type burn struct {
+		avail, lat         float64
+		availOK, latencyOK bool // enough requests
+	}
+	rate := func(d time.Duration) burn {
+		a, l, total, good := t.ratios(d)
+		return burn{
+			avail:     a / (1 - obj.Availability),
+			lat:       l / (1 - obj.Latency),
+			availOK:   total >= obj.MinRequests,
+			latencyOK: good >= obj.MinRequests,
+		}
+	}
+	for _, w := range Windows {
+		long, short := rate(w.Long), rate(w.Short)
+		out[Availability].record(w, long.avail, short.avail, long.availOK && short.availOK)
+		out[Latency].record(w, long.lat, short.lat, long.latencyOK && short.latencyOK)
+	}
+	b := rate(t.budget)
+	out[Availability].BudgetRemaining = 1 - b.avail
+	out[Latency].BudgetRemaining = 1 - b.lat
+	return out
+}
+
+func newStatus(objective float64) *Status {
+	return &Status{
+		Objective: objective,
+		BurnRates: make(map[string]float64),
+		Firing:    map[string]bool{"page": false, "ticket": false},
+	}
+}
+
+func (s *Status) record(w Window, long, short float64, enough bool) {
+	s.BurnRates[WindowLabel(w.Long)] = long
+	s.BurnRates[WindowLabel(w.Short)] = short
+	if enough && long > w.Factor && short > w.Factor {
+		s.Firing[w.Severity] = true
+	}
+}
+
+// WindowLabel formats d the way Prometheus range selectors do ("5m", "6h").
+func WindowLabel(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return fmt.Sprintf("%dm", d/time.Minute)
+}
@@ -0,0 +1,210 @@
+package slo
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2026, 6, 15, 12, 0, 0, 0, time.UTC)
+
+// feed observes total requests at now: bad of them failed and slow of the
+// rest were slow.
+func feed(tr *Tracker, now time.Time, total, bad, slow int) {
+	for i := 0; i < total; i++ {
+		tr.Observe(now, i >= bad, i >= bad && i < bad+slow)
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestEvaluate(t *testing.T) {
+	obj := Objectives{Availability: 0.99, Latency: 0.9, MinRequests: 10}
+	none := map[string]bool{"page": false, "ticket": false}
+	for _, tc := range []struct {
+		name   string
+		feed   func(tr *Tracker)
+		at     time.Time
+		burn   map[string][2]float64 // by window: availability, latency
+		avail  map[string]bool       // firing by severity
+		lat    map[string]bool
+		budget float64 // availability budget remaining
+	}{
+		{
+			name:   "errors now burn every window",
+			feed:   func(tr *Tracker) { feed(tr, start, 100, 20, 0) },
+			at:     start,
+			burn:   map[string][2]float64{"5m": {20, 0}, "1h": {20, 0}, "6h": {20, 0}, "72h": {20, 0}},
+			avail:  map[string]bool{"page": true, "ticket": true},
+			lat:    none,
+			budget: -19,
+		},
+		{
+			name:   "slow requests burn the latency budget only",
+			feed:   func(tr *Tracker) { feed(tr, start, 100, 0, 50) },
+			at:     start.Add(30 * time.Second),
+			burn:   map[string][2]float64{"5m": {0, 5}, "1h": {0, 5}, "24h": {0, 5}},
+			avail:  none,
+			lat:    map[string]bool{"page": false, "ticket": true},
+			budget: 1,
+		},
+		{
+			name:   "latency ratio is over successful requests",
+			feed:   func(tr *Tracker) { feed(tr, start, 20, 10, 5) },
+			at:     start,
+			burn:   map[string][2]float64{"5m": {50, 5}, "1h": {50, 5}},
+			avail:  map[string]bool{"page": true, "ticket": true},
+			lat:    map[string]bool{"page": false, "ticket": true},
+			budget: -49,
+		},
+		{
+			name:   "errors that left the 5m window",
+			feed:   func(tr *Tracker) { feed(tr, start, 100, 50, 0); feed(tr, start.Add(5*time.Minute), 100, 0, 0) },
+			at:     start.Add(5 * time.Minute),
+			burn:   map[string][2]float64{"5m": {0, 0}, "30m": {25, 0}, "1h": {25, 0}, "6h": {25, 0}},
+			avail:  map[string]bool{"page": true, "ticket": true}, // the 6h/30m pair
+			lat:    none,
+			budget: -24,
+		},
+		{
+			name: "errors still in the 5m window",
+			feed: func(tr *Tracker) {
+				feed(tr, start, 100, 50, 0)
+				feed(tr, start.Add(4*time.Minute+59*time.Second), 100, 0, 0)
+			},
+			at:     start.Add(4*time.Minute + 59*time.Second),
+			burn:   map[string][2]float64{"5m": {25, 0}, "1h": {25, 0}},
+			avail:  map[string]bool{"page": true, "ticket": true},
+			lat:    none,
+			budget: -24,
+		},
+		{
+			name: "short spike diluted by the long windows",
+			feed: func(tr *Tracker) { feed(tr, start, 10000, 0, 0); feed(tr, start.Add(5*time.Hour), 100, 20, 0) },
+			at:   start.Add(5 * time.Hour),
+			burn: map[string][2]float64{
+				"5m": {20, 0}, "1h": {20, 0}, "30m": {20, 0},
+				"6h": {20.0 / 10100 / 0.01, 0}, "24h": {20.0 / 10100 / 0.01, 0},
+			},
+			avail:  map[string]bool{"page": true, "ticket": false},
+			lat:    none,
+			budget: 1 - 20.0/10100/0.01,
+		},
+		{
+			name:   "too few requests do not fire",
+			feed:   func(tr *Tracker) { feed(tr, start, 5, 5, 0) },
+			at:     start,
+			burn:   map[string][2]float64{"5m": {100, 0}, "1h": {100, 0}},
+			avail:  none,
+			lat:    none,
+			budget: -99,
+		},
+		{
+			name:   "errors older than every rule window still spend the budget",
+			feed:   func(tr *Tracker) { feed(tr, start, 100, 100, 0) },
+			at:     start.Add(4 * 24 * time.Hour),
+			burn:   map[string][2]float64{"5m": {0, 0}, "72h": {0, 0}},
+			avail:  none,
+			lat:    none,
+			budget: -99,
+		},
+		{
+			name:   "idle longer than the budget window",
+			feed:   func(tr *Tracker) { feed(tr, start, 100, 100, 0) },
+			at:     start.Add(31 * 24 * time.Hour),
+			burn:   map[string][2]float64{"5m": {0, 0}, "72h": {0, 0}},
+			avail:  none,
+			lat:    none,
+			budget: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tr := NewTracker(30 * 24 * time.Hour)
+			tc.feed(tr)
+			st := tr.Evaluate(tc.at, obj)
+			for w, want := range tc.burn {
+				if got := st[Availability].BurnRates[w]; !near(got, want[0]) {
+					t.Errorf("availability burn rate %s = %v, want %v", w, got, want[0])
+				}
+				if got := st[Latency].BurnRates[w]; !near(got, want[1]) {
+					t.Errorf("latency burn rate %s = %v, want %v", w, got, want[1])
+				}
+			}
+			for slo, firing := range map[string]map[string]bool{Availability: tc.avail, Latency: tc.lat} {
+				for sev, want := range firing {
+					if got := st[slo].Firing[sev]; got != want {
+						t.Errorf("%s %s firing = %v, want %v", slo, sev, got, want)
+					}
+				}
+			}
+			if got := st[Availability].BudgetRemaining; !near(got, tc.budget) {
+				t.Errorf("availability budget remaining = %v, want %v", got, tc.budget)
+			}
+		})
+	}
+}
+
+// TestRunningSums checks the per-window sums against a recount of every
+// observation, with a clock that skips minutes and occasionally goes back.
+func TestRunningSums(t *testing.T) {
+	type event struct {
+		idx int64
+		c   counts
+	}
+	rnd := rand.New(rand.NewSource(1))
+	tr := NewTracker(12 * time.Hour)
+	var events []event
+	now, last := start, start.UnixNano()/int64(bucketWidth)
+	for step := 0; step < 5000; step++ {
+		switch r := rnd.Intn(100); {
+		case r < 60:
+			now = now.Add(time.Duration(rnd.Intn(90)) * time.Second)
+		case r < 95:
+			now = now.Add(time.Duration(rnd.Intn(60)) * time.Minute)
+		default:
+			now = now.Add(-time.Duration(rnd.Intn(5)) * time.Minute)
+		}
+		ok, slow := rnd.Intn(10) != 0, rnd.Intn(4) == 0
+		tr.Observe(now, ok, slow)
+		// A clock going back counts into the newest bucket
+		if idx := now.UnixNano() / int64(bucketWidth); idx > last {
+			last = idx
+		}
+		c := counts{total: 1}
+		if !ok {
+			c.bad = 1
+		} else if slow {
+			c.slow = 1
+		}
+		events = append(events, event{last, c})
+
+		for d, w := range tr.windows {
+			var want counts
+			for _, e := range events {
+				if e.idx > last-int64(d/bucketWidth) {
+					want.add(&e.c)
+				}
+			}
+			if got := tr.sums[w]; got != want {
+				t.Fatalf("step %d: sum over %v = %+v, want %+v", step, d, got, want)
+			}
+		}
+	}
+}
+
+func TestWindowLabel(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		5 * time.Minute:  "5m",
+		30 * time.Minute: "30m",
+		time.Hour:        "1h",
+		72 * time.Hour:   "72h",
+		90 * time.Minute: "90m",
+	} {
+		if got := WindowLabel(d); got != want {
+			t.Errorf("WindowLabel(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
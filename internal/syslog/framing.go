@@ -0,0 +1,100 @@
+package syslog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// ErrTooLong reports a message longer than the reader's limit. The message
+// is skipped, so reading can go on.
+var ErrTooLong = errors.New("syslog: message too long")
+
+// Reader splits a TCP stream into messages. Each message may be octet
+// counted ("LEN SP MSG") or newline terminated; senders may even mix both.
+type Reader struct {
+	r   *bufio.Reader
+	max int
+	buf []byte
+}
+
+func NewReader(r io.Reader, max int) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, 64<<10), max: max}
+}
+
+// Next returns the next message, valid until the following call.
+func (r *Reader) Next() ([]byte, error) {
+	for {
+		c, err := r.r.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if c[0] >= '1' && c[0] <= '9' {
+			return r.octetCounted()
+		}
+		msg, err := r.line()
+		if err != nil || len(msg) > 0 {
+			return msg, err
+		}
+		// Empty line (e.g. CRLF after an octet-counted message)
+	}
+}
+
+func (r *Reader) octetCounted() ([]byte, error) {
+	digits, err := r.r.ReadSlice(' ')
+	if err != nil {
+		if errors.Is(err, bufio.ErrBufferFull) {
+			err = errors.New("syslog: invalid octet count")
+		}
+		return nil, err
+	}
+	n, err := strconv.Atoi(string(digits[:len(digits)-1]))
+	if err != nil {
+		return nil, errors.New("syslog: invalid octet count")
+	}
+	if n > r.max {
+		if _, err := r.r.Discard(n); err != nil {
+			return nil, err
+		}
+		return nil, ErrTooLong
+	}
+	if cap(r.buf) < n {
+		r.buf = make([]byte, n)
+	}
+	r.buf = r.buf[:n]
+	if _, err := io.ReadFull(r.r, r.buf); err != nil {
+		return nil, err
+	}
+	return r.buf, nil
+}
+
+func (r *Reader) line() ([]byte, error) {
+	r.buf = r.buf[:0]
+	tooLong := false
+	for {
+		part, err := r.r.ReadSlice('\n')
+		if !tooLong {
+			if len(r.buf)+len(part) > r.max+2 { // + CRLF
+				tooLong, r.buf = true, r.buf[:0]
+			} else {
+				r.buf = append(r.buf, part...)
+			}
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil && (len(r.buf) == 0 || !errors.Is(err, io.EOF)) {
+			return nil, err
+		}
+		break
+	}
+	if tooLong {
+		return nil, ErrTooLong
+	}
+	msg := r.buf
+	for len(msg) > 0 && (msg[len(msg)-1] == '\n' || msg[len(msg)-1] == '\r') {
+		msg = msg[:len(msg)-1]
+	}
+	return msg, nil
+}
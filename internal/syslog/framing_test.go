@@ -0,0 +1,108 @@
+package syslog
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// result is one call of Reader.Next: the message or the error.
+type result struct {
+	msg string
+	err error
+}
+
+func TestReader(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	for _, tc := range []struct {
+		name string
+		in   string
+		max  int
+		want []result
+	}{
+		{
+			name: "newline terminated",
+			in:   "<13>a\n<13>b\r\n<13>c",
+			max:  64,
+			want: []result{{msg: "<13>a"}, {msg: "<13>b"}, {msg: "<13>c"}},
+		},
+		{
+			name: "octet counted",
+			in:   "5 <13>a11 <13>1 hello",
+			max:  64,
+			want: []result{{msg: "<13>a"}, {msg: "<13>1 hello"}},
+		},
+		{
+			name: "octet counted message keeps newlines",
+			in:   "8 <13>a\nb\n",
+			max:  64,
+			want: []result{{msg: "<13>a\nb\n"}},
+		},
+		{
+			name: "mixed framing and blank lines",
+			in:   "5 <13>a\r\n\n<13>plain\n7 <13>foo",
+			max:  64,
+			want: []result{{msg: "<13>a"}, {msg: "<13>plain"}, {msg: "<13>foo"}},
+		},
+		{
+			name: "octet counted too long resyncs",
+			in:   "100 " + long + "5 <13>a",
+			max:  10,
+			want: []result{{err: ErrTooLong}, {msg: "<13>a"}},
+		},
+		{
+			name: "line too long resyncs",
+			in:   long + "\n<13>a\n",
+			max:  10,
+			want: []result{{err: ErrTooLong}, {msg: "<13>a"}},
+		},
+		{
+			name: "line too long beyond the read buffer",
+			in:   strings.Repeat("y", 200<<10) + "\n<13>a\n",
+			max:  10,
+			want: []result{{err: ErrTooLong}, {msg: "<13>a"}},
+		},
+		{
+			name: "line at the limit with CRLF",
+			in:   "0123456789\r\n",
+			max:  10,
+			want: []result{{msg: "0123456789"}},
+		},
+		{
+			name: "truncated octet counted message",
+			in:   "10 <13>a",
+			max:  64,
+			want: []result{{err: io.ErrUnexpectedEOF}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewReader(strings.NewReader(tc.in), tc.max)
+			for i, want := range tc.want {
+				msg, err := r.Next()
+				if want.err != nil {
+					if !errors.Is(err, want.err) {
+						t.Fatalf("message %d: error = %v, want %v", i, err, want.err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("message %d: %v", i, err)
+				}
+				if string(msg) != want.msg {
+					t.Fatalf("message %d = %q, want %q", i, msg, want.msg)
+				}
+			}
+			if _, err := r.Next(); !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("after the last message: error = %v, want EOF", err)
+			}
+		})
+	}
+}
+
+func TestReaderInvalidOctetCount(t *testing.T) {
+	r := NewReader(strings.NewReader("12x <13>a"), 64)
+	if _, err := r.Next(); err == nil || errors.Is(err, io.EOF) {
+		t.Fatalf("error = %v, want an invalid octet count", err)
+	}
+}
@@ -0,0 +1,232 @@
+// Package syslog parses syslog messages in the formats of RFC 5424 and RFC
+// 3164 (BSD syslog) and splits TCP streams into messages as RFC 6587
+// describes: octet counting or newline terminated.
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is a parsed syslog message. Fields the sender left out (or set to
+// the RFC 5424 nil value "-") are empty.
+type Message struct {
+	Facility       int
+	Severity       int
+	Timestamp      time.Time // zero when the message carries none
+	Hostname       string
+	AppName        string
+	ProcID         string
+	MsgID          string
+	StructuredData []Param // RFC 5424 only
+	Message        string
+}
+
+// Param is one SD-PARAM of an SD-ELEMENT.
+type Param struct {
+	ID, Name, Value string
+}
+
+var (
+	ErrNoPriority = errors.New("syslog: missing or invalid PRI")
+	ErrBadHeader  = errors.New("syslog: invalid RFC 5424 header")
+)
+
+var facilities = [...]string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var severities = [...]string{
+	"emergency", "alert", "critical", "error", "warning", "notice", "informational", "debug",
+}
+
+// FacilityName is the keyword of facility f, as Loki's syslog target names it.
+func FacilityName(f int) string {
+	if f < 0 || f >= len(facilities) {
+		return ""
+	}
+	return facilities[f]
+}
+
+// SeverityName is the keyword of severity s, as Loki's syslog target names it.
+func SeverityName(s int) string {
+	if s < 0 || s >= len(severities) {
+		return ""
+	}
+	return severities[s]
+}
+
+// Parse parses one message. RFC 3164 timestamps have no year and no zone:
+// they are read in loc and get the year that puts them closest before now.
+func Parse(b []byte, now time.Time, loc *time.Location) (Message, error) {
+	var m Message
+	rest, ok := parsePriority(b, &m)
+	if !ok {
+		return m, ErrNoPriority
+	}
+	if len(rest) >= 2 && rest[0] == '1' && rest[1] == ' ' {
+		return m, parse5424(rest[2:], &m)
+	}
+	parse3164(rest, &m, now, loc)
+	return m, nil
+}
+
+func parsePriority(b []byte, m *Message) ([]byte, bool) {
+	if len(b) < 3 || b[0] != '<' {
+		return nil, false
+	}
+	end := bytes.IndexByte(b[:min(len(b), 5)], '>')
+	if end < 2 {
+		return nil, false
+	}
+	pri, err := strconv.Atoi(string(b[1:end]))
+	if err != nil || pri < 0 || pri > 191 {
+		return nil, false
+	}
+	m.Facility, m.Severity = pri/8, pri%8
+	return b[end+1:], true
+}
+
+// parse5424 parses what follows "<PRI>1 ": TIMESTAMP HOSTNAME APP-NAME
+// PROCID MSGID STRUCTURED-DATA [MSG].
+func parse5424(b []byte, m *Message) error {
+	var fields [5]string
+	for i := range fields {
+		sp := bytes.IndexByte(b, ' ')
+		if sp < 0 {
+			return ErrBadHeader
+		}
+		if v := string(b[:sp]); v != "-" {
+			fields[i] = v
+		}
+		b = b[sp+1:]
+	}
+	if fields[0] != "" {
+		ts, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return ErrBadHeader
+		}
+		m.Timestamp = ts
+	}
+	m.Hostname, m.AppName, m.ProcID, m.MsgID = fields[1], fields[2], fields[3], fields[4]
+
+	rest, err := parseStructuredData(b, m)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		if rest[0] != ' ' {
+			return ErrBadHeader
+		}
+		rest = bytes.TrimPrefix(rest[1:], []byte("\xef\xbb\xbf"))
+	}
+	m.Message = string(rest)
+	return nil
+}
+
+// parseStructuredData parses "-" or one or more [ID NAME="VALUE" ...]
+// elements, unescaping \" \\ and \] in values.
+func parseStructuredData(b []byte, m *Message) ([]byte, error) {
+	if len(b) > 0 && b[0] == '-' {
+		return b[1:], nil
+	}
+	if len(b) == 0 || b[0] != '[' {
+		return nil, ErrBadHeader
+	}
+	for len(b) > 0 && b[0] == '[' {
+		b = b[1:]
+		end := bytes.IndexAny(b, " ]")
+		if end <= 0 {
+			return nil, ErrBadHeader
+		}
+		id := string(b[:end])
+		b = b[end:]
+		for len(b) > 0 && b[0] == ' ' {
+			b = b[1:]
+			eq := bytes.IndexByte(b, '=')
+			if eq <= 0 || len(b) < eq+2 || b[eq+1] != '"' {
+				return nil, ErrBadHeader
+			}
+			name := string(b[:eq])
+			b = b[eq+2:]
+			var value strings.Builder
+			closed := false
+			for i := 0; i < len(b); i++ {
+				c := b[i]
+				if c == '\\' && i+1 < len(b) && (b[i+1] == '"' || b[i+1] == '\\' || b[i+1] == ']') {
+					value.WriteByte(b[i+1])
+					i++
+					continue
+				}
+				if c == '"' {
+					b, closed = b[i+1:], true
+					break
+				}
+				value.WriteByte(c)
+			}
+			if !closed {
+				return nil, ErrBadHeader
+			}
+			m.StructuredData = append(m.StructuredData, Param{ID: id, Name: name, Value: value.String()})
+		}
+		if len(b) == 0 || b[0] != ']' {
+			return nil, ErrBadHeader
+		}
+		b = b[1:]
+	}
+	return b, nil
+}
+
+// parse3164 parses what follows "<PRI>": TIMESTAMP HOSTNAME TAG[PID]: MSG.
+// Senders differ a lot here, so it never fails: parts it cannot find are
+// left empty and the rest becomes the message.
+func parse3164(b []byte, m *Message, now time.Time, loc *time.Location) {
+	const stamp = "Jan _2 15:04:05"
+	if len(b) > len(stamp) && b[len(stamp)] == ' ' {
+		if ts, err := time.ParseInLocation(stamp, string(b[:len(stamp)]), loc); err == nil {
+			m.Timestamp = withYear(ts, now)
+			b = b[len(stamp)+1:]
+			// The hostname follows the timestamp; a first word that looks
+			// like a tag means the sender left it out
+			if sp := bytes.IndexByte(b, ' '); sp > 0 && bytes.IndexAny(b[:sp], ":[") < 0 {
+				m.Hostname = string(b[:sp])
+				b = b[sp+1:]
+			}
+		}
+	}
+
+	// TAG is up to 32 alphanumeric characters, ended by "[", ":" or " "
+	tagEnd := bytes.IndexAny(b, "[: ")
+	if tagEnd > 0 && tagEnd <= 32 {
+		tag, rest := b[:tagEnd], b[tagEnd:]
+		if rest[0] == '[' {
+			if end := bytes.IndexByte(rest, ']'); end > 0 {
+				m.ProcID = string(rest[1:end])
+				rest = rest[end+1:]
+			}
+		}
+		if len(rest) > 0 && rest[0] == ':' {
+			m.AppName = string(tag)
+			b = bytes.TrimPrefix(rest[1:], []byte(" "))
+		} else {
+			m.ProcID = ""
+		}
+	}
+	m.Message = string(b)
+}
+
+// withYear gives a timestamp without year the current one, or the previous
+// one when that would put it more than a day into the future (messages sent
+// on Dec 31 and received on Jan 1).
+func withYear(ts, now time.Time) time.Time {
+	ts = ts.AddDate(now.Year()-ts.Year(), 0, 0)
+	if ts.Sub(now) > 24*time.Hour {
+		ts = ts.AddDate(-1, 0, 0)
+	}
+	return ts
+}
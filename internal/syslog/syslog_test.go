@@ -0,0 +1,187 @@
+package syslog
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2026, 6, 15, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name string
+		in   string
+		want Message
+		err  error
+	}{
+		{
+			name: "5424 full",
+			in:   `<165>1 2026-06-15T11:59:58.123Z host app 42 ID47 [ex@32473 iut="3" eventSource="App"] ` + "\xef\xbb\xbf" + `hello`,
+			want: Message{
+				Facility: 20, Severity: 5,
+				Timestamp: time.Date(2026, 6, 15, 11, 59, 58, 123e6, time.UTC),
+				Hostname:  "host", AppName: "app", ProcID: "42", MsgID: "ID47",
+				StructuredData: []Param{
+					{ID: "ex@32473", Name: "iut", Value: "3"},
+					{ID: "ex@32473", Name: "eventSource", Value: "App"},
+				},
+				Message: "hello",
+			},
+		},
+		{
+			name: "5424 nil values and no message",
+			in:   `<14>1 - - - - - -`,
+			want: Message{Facility: 1, Severity: 6},
+		},
+		{
+			name: "5424 escaped SD values and several elements",
+			in:   `<14>1 - h a - - [a x="q\"uote" y="back\\slash"][b z="br\]acket" w="keep\n"] msg`,
+			want: Message{
+				Facility: 1, Severity: 6, Hostname: "h", AppName: "a",
+				StructuredData: []Param{
+					{ID: "a", Name: "x", Value: `q"uote`},
+					{ID: "a", Name: "y", Value: `back\slash`},
+					{ID: "b", Name: "z", Value: `br]acket`},
+					{ID: "b", Name: "w", Value: `keep\n`},
+				},
+				Message: "msg",
+			},
+		},
+		{
+			name: "5424 element without params",
+			in:   `<14>1 - - - - - [origin] msg`,
+			want: Message{Facility: 1, Severity: 6, Message: "msg"},
+		},
+		{name: "5424 unterminated SD value", in: `<14>1 - - - - - [a x="open] msg`, err: ErrBadHeader},
+		{name: "5424 missing SD", in: `<14>1 - - - - `, err: ErrBadHeader},
+		{name: "5424 short header", in: `<14>1 - host app`, err: ErrBadHeader},
+		{name: "5424 bad timestamp", in: `<14>1 yesterday h a - - - msg`, err: ErrBadHeader},
+		{name: "5424 no space before message", in: `<14>1 - - - - - [a x="1"]msg`, err: ErrBadHeader},
+		{
+			name: "3164 full",
+			in:   `<34>Jun 15 11:59:58 myhost sshd[1234]: Failed password`,
+			want: Message{
+				Facility: 4, Severity: 2,
+				Timestamp: time.Date(2026, 6, 15, 11, 59, 58, 0, time.UTC),
+				Hostname:  "myhost", AppName: "sshd", ProcID: "1234",
+				Message: "Failed password",
+			},
+		},
+		{
+			name: "3164 padded day without hostname",
+			in:   `<13>Jun  5 10:00:00 cron: job done`,
+			want: Message{
+				Facility: 1, Severity: 5,
+				Timestamp: time.Date(2026, 6, 5, 10, 0, 0, 0, time.UTC),
+				AppName:   "cron", Message: "job done",
+			},
+		},
+		{
+			name: "3164 tag with pid without hostname",
+			in:   `<13>Jun 15 10:00:00 app[7]: x`,
+			want: Message{
+				Facility: 1, Severity: 5,
+				Timestamp: time.Date(2026, 6, 15, 10, 0, 0, 0, time.UTC),
+				AppName:   "app", ProcID: "7", Message: "x",
+			},
+		},
+		{
+			name: "3164 without timestamp",
+			in:   `<13>kernel: oops`,
+			want: Message{Facility: 1, Severity: 5, AppName: "kernel", Message: "oops"},
+		},
+		{
+			name: "3164 without tag",
+			in:   `<13>Jun 15 10:00:00 host just some text`,
+			want: Message{
+				Facility: 1, Severity: 5,
+				Timestamp: time.Date(2026, 6, 15, 10, 0, 0, 0, time.UTC),
+				Hostname:  "host", Message: "just some text",
+			},
+		},
+		{
+			name: "3164 bracket without colon is not a tag",
+			in:   `<13>text[1] more`,
+			want: Message{Facility: 1, Severity: 5, Message: "text[1] more"},
+		},
+		{
+			name: "3164 tag longer than 32 characters",
+			in:   `<13>aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa: x`,
+			want: Message{Facility: 1, Severity: 5, Message: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa: x"},
+		},
+		{name: "no PRI", in: `hello`, err: ErrNoPriority},
+		{name: "PRI out of range", in: `<192>1 - - - - - -`, err: ErrNoPriority},
+		{name: "PRI not a number", in: `<ab>x`, err: ErrNoPriority},
+		{name: "PRI too long", in: `<0013>x`, err: ErrNoPriority},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Parse([]byte(tc.in), now, time.UTC)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("error = %v, want %v", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got  %+v\nwant %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParse3164Location(t *testing.T) {
+	loc := time.FixedZone("UTC+5", 5*3600)
+	now := time.Date(2026, 6, 15, 12, 0, 0, 0, time.UTC)
+	m, err := Parse([]byte(`<13>Jun 15 10:00:00 host app: x`), now, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, 6, 15, 5, 0, 0, 0, time.UTC); !m.Timestamp.Equal(want) {
+		t.Errorf("timestamp = %v, want %v", m.Timestamp, want)
+	}
+}
+
+func TestWithYear(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		ts, now  time.Time
+		wantYear int
+	}{
+		{"same day", date(0, 6, 15, 10), date(2026, 6, 15, 12), 2026},
+		{"earlier this year", date(0, 1, 2, 0), date(2026, 6, 15, 12), 2026},
+		{"sent Dec 31, received Jan 1", date(0, 12, 31, 23), date(2026, 1, 1, 0), 2025},
+		{"less than a day ahead", date(0, 1, 1, 20), date(2026, 1, 1, 0), 2026},
+		{"more than a day ahead", date(0, 1, 3, 0), date(2026, 1, 1, 0), 2025},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := withYear(tc.ts, tc.now).Year(); got != tc.wantYear {
+				t.Errorf("year = %d, want %d", got, tc.wantYear)
+			}
+		})
+	}
+}
+
+func date(year int, month time.Month, day, hour int) time.Time {
+	return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+}
+
+func TestNames(t *testing.T) {
+	for _, tc := range []struct {
+		got, want string
+	}{
+		{FacilityName(0), "kern"},
+		{FacilityName(23), "local7"},
+		{FacilityName(24), ""},
+		{FacilityName(-1), ""},
+		{SeverityName(6), "informational"},
+		{SeverityName(8), ""},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("got %q, want %q", tc.got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+// Package usage keeps per-tenant ingest counters for chargeback: since
+// start, over rolling windows, and as deltas for periodic publishing.
+package usage
+
+import (
+	"sync"
+	"time"
+)
+
+// OtherTenant collects usage of tenants beyond maxTenants.
+const OtherTenant = "__other__"
+
+// maxTenants bounds the tenant table; the tenant comes from a request header.
+const maxTenants = 10000
+
+// bucketsPerWindow is the resolution of rolling windows: a 1h window is
+// summed from 60 one-minute buckets.
+const bucketsPerWindow = 60
+
+// Counters is the usage of one tenant over some period.
+type Counters struct {
+	Requests      uint64            `json:"requests"`
+	BytesReceived uint64            `json:"bytes_received"`
+	BytesWritten  uint64            `json:"bytes_written"` // accepted into Kafka
+	Lines         uint64            `json:"lines"`         // only for endpoints that decode the payload
+	Streams       uint64            `json:"streams"`
+	Rejections    map[string]uint64 `json:"rejections,omitempty"` // by result
+}
+
+func (c *Counters) add(o *Counters) {
+	c.Requests += o.Requests
+	c.BytesReceived += o.BytesReceived
+	c.BytesWritten += o.BytesWritten
+	c.Lines += o.Lines
+	c.Streams += o.Streams
+	for reason, n := range o.Rejections {
+		if c.Rejections == nil {
+			c.Rejections = make(map[string]uint64)
+		}
+		c.Rejections[reason] += n
+	}
+}
+
+// Event is one finished request.
+type Event struct {
+	Result        string // "success" or the rejection reason
+	BytesReceived int
+	BytesWritten  int
+	Lines         int
+	Streams       int
+}
+
+func (e Event) counters() Counters {
+	c := Counters{
+		Requests:      1,
+		BytesReceived: uint64(e.BytesReceived),
+		BytesWritten:  uint64(e.BytesWritten),
+		Lines:         uint64(e.Lines),
+		Streams:       uint64(e.Streams),
+	}
+	if e.Result != "success" {
+		c.Rejections = map[string]uint64{e.Result: 1}
+	}
+	return c
+}
+
+type bucket struct {
+	idx int64 // time / width
+	c   Counters
+}
+
+// ring is one rolling window of bucketsPerWindow buckets.
+type ring struct {
+	width   time.Duration
+	buckets [bucketsPerWindow]bucket
+}
+
+func (r *ring) add(now time.Time, c *Counters) {
+	idx := now.UnixNano() / int64(r.width)
+	b := &r.buckets[idx%bucketsPerWindow]
+	if b.idx != idx {
+		*b = bucket{idx: idx}
+	}
+	b.c.add(c)
+}
+
+func (r *ring) sum(now time.Time) Counters {
+	cur := now.UnixNano() / int64(r.width)
+	var out Counters
+	for i := range r.buckets {
+		if b := &r.buckets[i]; cur-b.idx < bucketsPerWindow {
+			out.add(&b.c)
+		}
+	}
+	return out
+}
+
+type tenantUsage struct {
+	total   Counters
+	pending Counters  // since the last Drain
+	since   time.Time // start of pending when restored, else the last Drain
+	windows []*ring
+}
+
+// Tracker accumulates usage per tenant. It is safe for concurrent use.
+type Tracker struct {
+	mu        sync.Mutex
+	windows   []time.Duration
+	start     time.Time
+	lastDrain time.Time
+	tenants   map[string]*tenantUsage
+	now       func() time.Time // time.Now, replaced in tests
+}
+
+func NewTracker(windows []time.Duration) *Tracker {
+	now := time.Now()
+	return &Tracker{
+		windows:   windows,
+		start:     now,
+		lastDrain: now,
+		tenants:   make(map[string]*tenantUsage),
+		now:       time.Now,
+	}
+}
+
+// Record adds one request of tenant.
+func (t *Tracker) Record(tenant string, e Event) {
+	c := e.counters()
+	now := t.now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u := t.tenantLocked(tenant)
+	u.total.add(&c)
+	u.pending.add(&c)
+	for _, r := range u.windows {
+		r.add(now, &c)
+	}
+}
+
+// tenantLocked returns the usage of tenant, created on first use.
+func (t *Tracker) tenantLocked(tenant string) *tenantUsage {
+	u, ok := t.tenants[tenant]
+	if ok {
+		return u
+	}
+	if len(t.tenants) >= maxTenants {
+		tenant = OtherTenant
+		u = t.tenants[tenant]
+	}
+	if u == nil {
+		u = &tenantUsage{windows: make([]*ring, len(t.windows))}
+		for i, w := range t.windows {
+			u.windows[i] = &ring{width: w / bucketsPerWindow}
+		}
+		t.tenants[tenant] = u
+	}
+	return u
+}
+
+// TenantReport is the usage of one tenant since start and per window
+// (keyed by window duration, e.g. "1h0m0s").
+type TenantReport struct {
+	Total   Counters            `json:"total"`
+	Windows map[string]Counters `json:"windows"`
+}
+
+type Report struct {
+	Since   time.Time               `json:"since"`
+	Now     time.Time               `json:"now"`
+	Tenants map[string]TenantReport `json:"tenants"`
+}
+
+// Report returns usage of all tenants, or only of tenant when not empty.
+func (t *Tracker) Report(tenant string) Report {
+	now := t.now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rep := Report{Since: t.start, Now: now, Tenants: make(map[string]TenantReport)}
+	for name, u := range t.tenants {
+		if tenant != "" && name != tenant {
+			continue
+		}
+		tr := TenantReport{Total: u.total, Windows: make(map[string]Counters, len(u.windows))}
+		tr.Total.Rejections = copyMap(u.total.Rejections)
+		for i, r := range u.windows {
+			tr.Windows[t.windows[i].String()] = r.sum(now)
+		}
+		rep.Tenants[name] = tr
+	}
+	return rep
+}
+
+// Record is the usage of one tenant between two Drain calls, as published
+// to the usage topic. Summing records over time gives the billable volume.
+type Record struct {
+	Tenant string    `json:"tenant"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Counters
+}
+
+// Drain returns the usage accumulated since the previous Drain and resets it.
+func (t *Tracker) Drain() []Record {
+	now := t.now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []Record
+	for name, u := range t.tenants {
+		if u.pending.Requests == 0 {
+			continue
+		}
+		start := t.lastDrain
+		if !u.since.IsZero() {
+			start = u.since
+		}
+		out = append(out, Record{Tenant: name, Start: start, End: now, Counters: u.pending})
+		u.pending, u.since = Counters{}, time.Time{}
+	}
+	t.lastDrain = now
+	return out
+}
+
+// Restore puts back records a Drain returned that could not be published,
+// so the next Drain reports them again, merged with what came since: the
+// tenant's next record starts where the restored one started.
+func (t *Tracker) Restore(recs []Record) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, r := range recs {
+		u := t.tenantLocked(r.Tenant)
+		u.pending.add(&r.Counters)
+		if u.since.IsZero() || r.Start.Before(u.since) {
+			u.since = r.Start
+		}
+	}
+}
+
+func copyMap(m map[string]uint64) map[string]uint64 {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]uint64, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
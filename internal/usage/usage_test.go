@@ -0,0 +1,190 @@
+package usage
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2026, 6, 15, 12, 0, 0, 0, time.UTC)
+
+// testTracker returns a tracker that started at start and reads the time
+// from *clock.
+func testTracker(clock *time.Time, windows ...time.Duration) *Tracker {
+	*clock = start
+	t := NewTracker(windows)
+	t.start, t.lastDrain = start, start
+	t.now = func() time.Time { return *clock }
+	return t
+}
+
+func TestWindows(t *testing.T) {
+	ok := Event{Result: "success", BytesReceived: 100, BytesWritten: 80, Lines: 3, Streams: 1}
+	for _, tc := range []struct {
+		name   string
+		events []time.Duration // offsets from start of successful requests
+		at     time.Duration
+		want   map[string]uint64 // requests by window
+	}{
+		{
+			name:   "all in every window",
+			events: []time.Duration{0, 30 * time.Second, time.Minute},
+			at:     2 * time.Minute,
+			want:   map[string]uint64{"1h0m0s": 3, "10m0s": 3},
+		},
+		{
+			name:   "oldest bucket still in the window",
+			events: []time.Duration{0, 51 * time.Minute},
+			at:     59*time.Minute + 59*time.Second,
+			want:   map[string]uint64{"1h0m0s": 2, "10m0s": 1},
+		},
+		{
+			name:   "oldest bucket rolled out",
+			events: []time.Duration{0, 51 * time.Minute},
+			at:     time.Hour,
+			want:   map[string]uint64{"1h0m0s": 1, "10m0s": 1},
+		},
+		{
+			name:   "bucket reused a window later",
+			events: []time.Duration{0, time.Minute, time.Hour},
+			at:     time.Hour,
+			want:   map[string]uint64{"1h0m0s": 2, "10m0s": 1},
+		},
+		{
+			name:   "idle longer than every window",
+			events: []time.Duration{0, 5 * time.Minute},
+			at:     3 * time.Hour,
+			want:   map[string]uint64{"1h0m0s": 0, "10m0s": 0},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var clock time.Time
+			tr := testTracker(&clock, time.Hour, 10*time.Minute)
+			for _, off := range tc.events {
+				clock = start.Add(off)
+				tr.Record("a", ok)
+			}
+			clock = start.Add(tc.at)
+			rep := tr.Report("a").Tenants["a"]
+			for w, want := range tc.want {
+				c := rep.Windows[w]
+				if c.Requests != want || c.BytesReceived != 100*want || c.BytesWritten != 80*want ||
+					c.Lines != 3*want || c.Streams != want {
+					t.Errorf("window %s = %+v, want %d requests", w, c, want)
+				}
+			}
+			if rep.Total.Requests != uint64(len(tc.events)) {
+				t.Errorf("total requests = %d, want %d", rep.Total.Requests, len(tc.events))
+			}
+		})
+	}
+}
+
+func TestTotals(t *testing.T) {
+	var clock time.Time
+	tr := testTracker(&clock, time.Hour)
+	tr.Record("a", Event{Result: "success", BytesReceived: 10, BytesWritten: 10})
+	tr.Record("a", Event{Result: "rate_limited", BytesReceived: 5})
+	tr.Record("b", Event{Result: "too_large", BytesReceived: 7})
+	clock = start.Add(2 * time.Hour)
+	tr.Drain()
+	tr.Record("a", Event{Result: "rate_limited", BytesReceived: 5})
+
+	rep := tr.Report("")
+	if !rep.Since.Equal(start) || !rep.Now.Equal(clock) {
+		t.Errorf("report covers %v..%v, want %v..%v", rep.Since, rep.Now, start, clock)
+	}
+	want := Counters{
+		Requests:      3,
+		BytesReceived: 20,
+		BytesWritten:  10,
+		Rejections:    map[string]uint64{"rate_limited": 2},
+	}
+	if got := rep.Tenants["a"].Total; !reflect.DeepEqual(got, want) {
+		t.Errorf("total of a = %+v, want %+v", got, want)
+	}
+	if got := rep.Tenants["a"].Windows["1h0m0s"].Requests; got != 1 {
+		t.Errorf("window requests of a = %d, want 1", got)
+	}
+	if got := rep.Tenants["b"].Total.Rejections["too_large"]; got != 1 {
+		t.Errorf("too_large of b = %d, want 1", got)
+	}
+
+	// The report does not share maps with the tracker
+	rep.Tenants["a"].Total.Rejections["rate_limited"] = 100
+	if got := tr.Report("a"); len(got.Tenants) != 1 || got.Tenants["a"].Total.Rejections["rate_limited"] != 2 {
+		t.Errorf("Report(a) = %+v", got)
+	}
+}
+
+func TestDrainRestore(t *testing.T) {
+	var clock time.Time
+	tr := testTracker(&clock, time.Hour)
+	tr.Record("a", Event{Result: "success", BytesReceived: 10, Lines: 1})
+	tr.Record("a", Event{Result: "rate_limited", BytesReceived: 5})
+
+	t1 := start.Add(time.Minute)
+	clock = t1
+	recs := tr.Drain()
+	want := []Record{{Tenant: "a", Start: start, End: t1, Counters: Counters{
+		Requests: 2, BytesReceived: 15, Lines: 1, Rejections: map[string]uint64{"rate_limited": 1},
+	}}}
+	if !reflect.DeepEqual(recs, want) {
+		t.Fatalf("first drain = %+v, want %+v", recs, want)
+	}
+
+	// Publishing failed: the next drain reports the records again, merged
+	// with what came since and starting where they started
+	tr.Restore(recs)
+	tr.Record("a", Event{Result: "rate_limited", BytesReceived: 5})
+	tr.Record("b", Event{Result: "success", BytesReceived: 1})
+	t2 := start.Add(2 * time.Minute)
+	clock = t2
+	got := map[string]Record{}
+	for _, r := range tr.Drain() {
+		got[r.Tenant] = r
+	}
+	wantByTenant := map[string]Record{
+		"a": {Tenant: "a", Start: start, End: t2, Counters: Counters{
+			Requests: 3, BytesReceived: 20, Lines: 1, Rejections: map[string]uint64{"rate_limited": 2},
+		}},
+		"b": {Tenant: "b", Start: t1, End: t2, Counters: Counters{Requests: 1, BytesReceived: 1}},
+	}
+	if !reflect.DeepEqual(got, wantByTenant) {
+		t.Fatalf("drain after restore = %+v, want %+v", got, wantByTenant)
+	}
+
+	clock = start.Add(3 * time.Minute)
+	if recs := tr.Drain(); len(recs) != 0 {
+		t.Errorf("drain without requests = %+v, want none", recs)
+	}
+	// Restoring does not count toward the since-start totals
+	if got := tr.Report("a").Tenants["a"].Total.Requests; got != 3 {
+		t.Errorf("total requests of a = %d, want 3", got)
+	}
+
+	// A restored tenant without new requests starts at its restored record
+	tr.Restore([]Record{{Tenant: "c", Start: t1, End: t2, Counters: Counters{Requests: 4}}})
+	t4 := start.Add(4 * time.Minute)
+	clock = t4
+	want = []Record{{Tenant: "c", Start: t1, End: t4, Counters: Counters{Requests: 4}}}
+	if recs := tr.Drain(); !reflect.DeepEqual(recs, want) {
+		t.Errorf("drain of restored tenant = %+v, want %+v", recs, want)
+	}
+}
+
+func TestOtherTenant(t *testing.T) {
+	var clock time.Time
+	tr := testTracker(&clock)
+	for i := 0; i < maxTenants+5; i++ {
+		tr.Record(fmt.Sprint("t", i), Event{Result: "success"})
+	}
+	rep := tr.Report("")
+	if len(rep.Tenants) != maxTenants+1 {
+		t.Errorf("%d tenants, want %d", len(rep.Tenants), maxTenants+1)
+	}
+	if got := rep.Tenants[OtherTenant].Total.Requests; got != 5 {
+		t.Errorf("%s requests = %d, want 5", OtherTenant, got)
+	}
+}